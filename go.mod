@@ -19,6 +19,7 @@ require (
 	github.com/imdario/mergo v0.3.12
 	github.com/influxdata/influxdb1-client v0.0.0-20200827194710-b269163b24ab
 	github.com/logrusorgru/aurora v2.0.3+incompatible
+	github.com/mattn/go-sqlite3 v1.14.16 // indirect
 	github.com/mattn/go-zglob v0.0.3
 	github.com/mholt/archiver v3.1.1+incompatible
 	github.com/mitchellh/go-wordwrap v1.0.1
@@ -26,6 +27,7 @@ require (
 	github.com/msoap/byline v1.1.1
 	github.com/otiai10/copy v1.6.0
 	github.com/pborman/uuid v1.2.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/xid v1.3.0
 	github.com/stretchr/testify v1.7.0
 	github.com/syndtr/goleveldb v1.0.0
@@ -37,8 +39,9 @@ require (
 	github.com/whilp/git-urls v1.0.0
 	go.uber.org/zap v1.19.0
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4
-	golang.org/x/sys v0.0.0-20210809222454-d867a43fc93e
+	golang.org/x/sys v0.0.0-20211007075335-d3039528d8ac
 	k8s.io/api v0.22.2
 	k8s.io/apimachinery v0.22.2
 	k8s.io/client-go v0.22.2
+	modernc.org/sqlite v1.17.3
 )
@@ -67,11 +67,13 @@ type BuildOutput struct {
 
 	// Dependencies is a map of modules (as keys) to versions (as values),
 	// containing the collapsed transitive upstream dependency set of this
-	// build.
+	// build. Dependencies resolved from Git or from a local directory map to
+	// the commit they were built at.
 	Dependencies map[string]string
 }
 
-// DependencyTarget encapsulates the target and version of a dependency.
+// DependencyTarget encapsulates the source of a dependency: either a target
+// and version, a Git repository and ref, or a local path.
 type DependencyTarget struct {
 	// Target is the replacement dependency we want to use. It can be a different
 	// fork or some module if the builder supports it.
@@ -79,4 +81,20 @@ type DependencyTarget struct {
 
 	// Version is the version of the dependency we want to use.
 	Version string
+
+	// Git is the URL of the Git repository to fetch the dependency from.
+	Git string
+
+	// Ref is the branch, tag or commit to check out; empty means HEAD.
+	Ref string
+
+	// Path is the directory of the dependency, relative to the extra sources.
+	Path string
+}
+
+// IsLocal returns whether this dependency is resolved from sources, either
+// fetched from Git or shipped as extra sources, rather than from a published
+// version.
+func (d DependencyTarget) IsLocal() bool {
+	return d.Git != "" || d.Path != ""
 }
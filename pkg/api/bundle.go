@@ -0,0 +1,33 @@
+package api
+
+// ExportRequest is a request to export complete tasks as a bundle, which can
+// be imported into another daemon.
+//
+// A bundle is a tar archive holding:
+//
+//   - tasks.jsonl: the JSON documents of the tasks, one per line, oldest first.
+//   - logs/<task id>.out: the daemon log of each task, if any.
+//   - outputs/<task id>/<runner>/<plan>/<run id>/...: the outputs of each run
+//     collected on the daemon host, if requested.
+type ExportRequest struct {
+	// Filters select the tasks to export; only complete tasks are exported.
+	Filters TasksFilters `json:"filters"`
+	// Outputs includes the outputs of the runs in the bundle.
+	Outputs bool `json:"outputs"`
+}
+
+// ExportReport describes what was exported in a bundle.
+type ExportReport struct {
+	Tasks   []string `json:"tasks"`   // IDs of the tasks exported
+	Logs    int      `json:"logs"`    // Number of task logs exported
+	Outputs int      `json:"outputs"` // Number of output files exported
+}
+
+// ImportReport describes what was imported from a bundle. Tasks already
+// stored by the daemon are skipped, along with their logs and outputs.
+type ImportReport struct {
+	Imported []string `json:"imported"` // IDs of the tasks imported
+	Skipped  []string `json:"skipped"`  // IDs of the tasks already stored
+	Logs     int      `json:"logs"`     // Number of task logs imported
+	Outputs  int      `json:"outputs"`  // Number of output files imported
+}
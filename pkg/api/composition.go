@@ -13,6 +13,7 @@ import (
 var compositionValidator = func() *validator.Validate {
 	v := validator.New()
 	v.RegisterStructValidation(ValidateInstances, &Instances{})
+	_ = v.RegisterValidation("duration", validateDuration)
 	return v
 }()
 
@@ -35,6 +36,30 @@ func (gs Groups) Validate(c *Composition) error {
 		}
 	}
 
+	// Validate dependency overrides.
+	for _, g := range gs {
+		for _, d := range g.Build.Dependencies {
+			if err := d.Validate(); err != nil {
+				return fmt.Errorf("group %s: %w", g.ID, err)
+			}
+		}
+	}
+
+	// Dependency matrices are expanded from the global build definition.
+	for _, g := range gs {
+		if len(g.Build.DependencyMatrix) > 0 {
+			return fmt.Errorf("group %s: a dependency matrix can only be declared globally", g.ID)
+		}
+	}
+
+	// Validate instance overrides; bounds are only checked once instance
+	// counts have been calculated.
+	for _, g := range gs {
+		if err := g.validateInstanceOverrides(g.calculatedInstanceCnt); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -48,6 +73,11 @@ type Composition struct {
 	// Groups enumerates the instances groups that participate in this
 	// composition.
 	Groups Groups `toml:"groups" json:"groups" validate:"required,gt=0"`
+
+	// Stages turns this composition into a pipeline: each stage runs a test
+	// case, in order, against the artifacts built once for all stages. When
+	// stages are present, Global.Case is ignored.
+	Stages []Stage `toml:"stages" json:"stages,omitempty" validate:"dive"`
 }
 
 type Global struct {
@@ -89,6 +119,25 @@ type Global struct {
 
 	// DisableMetrics is used to disable metrics batching.
 	DisableMetrics bool `toml:"disable_metrics" json:"disable_metrics"`
+
+	// Timeout bounds the duration of the run phase, expressed as a
+	// time.Duration string (e.g. "2h"). For pipelines, it bounds all stages
+	// together. Runs exceeding it are stopped, and their outcome is "timeout".
+	Timeout string `toml:"timeout" json:"timeout,omitempty" validate:"omitempty,duration"`
+
+	// BuildTimeout bounds the duration of the build phase, expressed as a
+	// time.Duration string (e.g. "15m").
+	BuildTimeout string `toml:"build_timeout" json:"build_timeout,omitempty" validate:"omitempty,duration"`
+
+	// Retry is the policy to retry the build or run with when it fails
+	// because of an infrastructure error. Fields set here take precedence
+	// over the retry policy of the daemon.
+	Retry *RetryPolicy `toml:"retry" json:"retry,omitempty"`
+
+	// Matrix declares test parameter sweeps applying to all groups. A
+	// composition with a matrix is expanded into one composition per
+	// combination of values before being submitted. See ExpandMatrix.
+	Matrix Matrix `toml:"matrix" json:"matrix,omitempty"`
 }
 
 type Metadata struct {
@@ -97,6 +146,14 @@ type Metadata struct {
 
 	// Author is the author of this composition.
 	Author string `toml:"author" json:"author"`
+
+	// Coordinates records the matrix values this composition was expanded
+	// with, if it resulted from a matrix expansion.
+	Coordinates map[string]string `toml:"coordinates,omitempty" json:"coordinates,omitempty"`
+
+	// DependencyVariants records the group variants this composition was
+	// expanded into from a dependency matrix, if any.
+	DependencyVariants []DependencyVariant `toml:"dependency_variants,omitempty" json:"dependency_variants,omitempty"`
 }
 
 type Resources struct {
@@ -114,6 +171,10 @@ type Group struct {
 	// Instances defines the number of instances that belong to this group.
 	Instances Instances `toml:"instances" json:"instances"`
 
+	// InstanceOverrides assigns roles and test params to specific instances
+	// of this group.
+	InstanceOverrides []InstanceOverride `toml:"instance_overrides" json:"instance_overrides,omitempty"`
+
 	// Builder is the builder we're using.
 	Builder string `toml:"builder" json:"builder"`
 
@@ -123,9 +184,16 @@ type Group struct {
 	// Build specifies the build configuration for this group.
 	Build Build `toml:"build" json:"build"`
 
+	// RunConfig specifies the run configuration overrides for this group.
+	// They are applied on top of the global run configuration.
+	RunConfig map[string]interface{} `toml:"run_config" json:"run_config"`
+
 	// Run specifies the run configuration for this group.
 	Run Run `toml:"run" json:"run"`
 
+	// Matrix declares test parameter sweeps applying to this group only.
+	Matrix Matrix `toml:"matrix" json:"matrix,omitempty"`
+
 	// calculatedInstanceCnt caches the actual amount of instances in this
 	// group.
 	calculatedInstanceCnt uint
@@ -161,6 +229,12 @@ type Build struct {
 	// Dependencies specifies any upstream dependency overrides to apply to this
 	// build.
 	Dependencies Dependencies `toml:"dependencies" json:"dependencies"`
+
+	// DependencyMatrix declares upstream dependency versions to test against.
+	// It is only supported in the global build definition. A composition with
+	// a dependency matrix is expanded into one variant of each group per
+	// combination of versions. See ExpandDependencyMatrix.
+	DependencyMatrix DependencyMatrix `toml:"dependency_matrix" json:"dependency_matrix,omitempty"`
 }
 
 // BuildKey returns a composite key that identifies this build, suitable for
@@ -206,7 +280,7 @@ func (b Build) BuildKey() string {
 	})
 	sb.WriteString("dependencies=")
 	for _, d := range dependencies {
-		sb.WriteString(fmt.Sprintf("%s:%s|", d.Module, d.Version))
+		sb.WriteString(fmt.Sprintf("%s:%s:%s:%s:%s:%s|", d.Module, d.Target, d.Version, d.Git, d.Ref, d.Path))
 	}
 
 	return sb.String()
@@ -231,12 +305,9 @@ func (d Dependencies) ApplyDefaults(defaults Dependencies) Dependencies {
 	copy(ret[:], d)
 
 	into := d.AsMap()
-	for mod, ver := range defaults.AsMap() {
-		if _, present := into[mod]; !present {
-			ret = append(ret, Dependency{
-				Module:  mod,
-				Version: ver,
-			})
+	for _, dep := range defaults {
+		if _, present := into[dep.Module]; !present {
+			ret = append(ret, dep)
 		}
 	}
 	return ret
@@ -262,6 +333,10 @@ type Run struct {
 	Profiles map[string]string `toml:"profiles" json:"profiles"`
 }
 
+// Dependency overrides an upstream dependency of the test plan. It is resolved
+// from exactly one of: a published Version (of Target, if set), a Git
+// repository at a Ref, or a directory shipped via the manifest's extra
+// sources (Path).
 type Dependency struct {
 	// Module is the module name/path for the import to be overridden.
 	Module string `toml:"module" json:"module" validate:"required"`
@@ -270,7 +345,40 @@ type Dependency struct {
 	Target string `toml:"target" json:"target" validate:"target"`
 
 	// Version is the override version.
-	Version string `toml:"version" json:"version" validate:"required"`
+	Version string `toml:"version" json:"version"`
+
+	// Git is the URL of a Git repository to resolve the dependency from, at
+	// Ref.
+	Git string `toml:"git" json:"git,omitempty"`
+
+	// Ref is the branch, tag or commit of the Git repository to use. Defaults
+	// to the HEAD of the repository.
+	Ref string `toml:"ref" json:"ref,omitempty"`
+
+	// Path is the directory to resolve the dependency from, relative to the
+	// extra sources of the test plan (see TestPlanManifest.ExtraSources).
+	Path string `toml:"path" json:"path,omitempty"`
+}
+
+// Validate verifies that this dependency is resolved from exactly one source.
+func (d Dependency) Validate() error {
+	var sources int
+	for _, s := range []string{d.Version, d.Git, d.Path} {
+		if s != "" {
+			sources++
+		}
+	}
+	switch {
+	case d.Module == "":
+		return fmt.Errorf("dependency is missing a module")
+	case sources != 1:
+		return fmt.Errorf("dependency %s must set exactly one of version, git or path", d.Module)
+	case d.Ref != "" && d.Git == "":
+		return fmt.Errorf("dependency %s sets a ref without a git url", d.Module)
+	case d.Target != "" && d.Version == "":
+		return fmt.Errorf("dependency %s sets a target, which is only supported with a version", d.Module)
+	}
+	return nil
 }
 
 // ValidateForBuild validates that this Composition is correct for a build.
@@ -289,8 +397,15 @@ func (c *Composition) ValidateForBuild() error {
 
 // ValidateForRun validates that this Composition is correct for a run.
 func (c *Composition) ValidateForRun() error {
-	// Perform structural validation.
-	if err := compositionValidator.Struct(c); err != nil {
+	// Perform structural validation. Pipelines declare their test cases in
+	// their stages.
+	var err error
+	if len(c.Stages) > 0 {
+		err = compositionValidator.StructExcept(c, "Global.Case")
+	} else {
+		err = compositionValidator.Struct(c)
+	}
+	if err != nil {
 		return err
 	}
 
@@ -432,6 +547,11 @@ func (c Composition) PrepareForRun(manifest *TestPlanManifest) (*Composition, er
 		return nil, fmt.Errorf("test case %s not found in plan %s", c.Global.Case, manifest.Name)
 	}
 
+	// Validate the supplied test params before applying the defaults.
+	if err := c.ValidateTestParams(manifest); err != nil {
+		return nil, err
+	}
+
 	// Is the runner supported?
 	if manifest.Runners == nil || len(manifest.Runners) == 0 {
 		return nil, fmt.Errorf("plan supports no runners; review the manifest")
@@ -506,16 +626,11 @@ func (c Composition) PrepareForRun(manifest *TestPlanManifest) (*Composition, er
 	// the parameters that are absent.
 	defaults := make(map[string]string, len(tcase.Parameters))
 	for n, v := range tcase.Parameters {
-		switch dv := v.Default.(type) {
-		case string:
-			defaults[n] = dv
-		default:
-			data, err := json.Marshal(v.Default)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse test case parameter; ignoring; name=%s, value=%v, err=%w", n, v, err)
-			}
-			defaults[n] = string(data)
+		dv, err := v.DefaultValue()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse test case parameter; ignoring; name=%s, value=%v, err=%w", n, v, err)
 		}
+		defaults[n] = dv
 	}
 
 	for _, g := range c.Groups {
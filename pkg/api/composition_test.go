@@ -2,6 +2,7 @@ package api
 
 import (
 	"testing"
+	"time"
 
 	"github.com/testground/testground/pkg/config"
 
@@ -331,6 +332,9 @@ func TestDefaultTestParamsApplied(t *testing.T) {
 				Name:      "foo_case",
 				Instances: InstanceConstraints{Minimum: 1, Maximum: 100},
 				Parameters: map[string]Parameter{
+					"param1": {Type: "string"},
+					"param2": {Type: "string"},
+					"param3": {Type: "string"},
 					"param4": {
 						Type:    "string",
 						Default: "value4:default:manifest",
@@ -375,8 +379,8 @@ func TestDefaultBuildParamsApplied(t *testing.T) {
 			Build: &Build{
 				Selectors: []string{"default_selector_1", "default_selector_2"},
 				Dependencies: []Dependency{
-					{"dependency:a", "", "1.0.0.default"},
-					{"dependency:b", "", "2.0.0.default"},
+					{Module: "dependency:a", Target: "", Version: "1.0.0.default"},
+					{Module: "dependency:b", Target: "", Version: "2.0.0.default"},
 				},
 			},
 		},
@@ -388,9 +392,9 @@ func TestDefaultBuildParamsApplied(t *testing.T) {
 				ID: "dep_override",
 				Build: Build{
 					Dependencies: []Dependency{
-						{"dependency:a", "", "1.0.0.overridden"},
-						{"dependency:c", "", "1.0.0.locally_set"},
-						{"dependency:d", "remote/fork", "1.0.0.locally_set"},
+						{Module: "dependency:a", Target: "", Version: "1.0.0.overridden"},
+						{Module: "dependency:c", Target: "", Version: "1.0.0.locally_set"},
+						{Module: "dependency:d", Target: "remote/fork", Version: "1.0.0.locally_set"},
 					},
 				},
 			},
@@ -399,8 +403,8 @@ func TestDefaultBuildParamsApplied(t *testing.T) {
 				Build: Build{
 					Selectors: []string{"overridden"},
 					Dependencies: []Dependency{
-						{"dependency:a", "", "1.0.0.overridden"},
-						{"dependency:c", "", "1.0.0.locally_set"},
+						{Module: "dependency:a", Target: "", Version: "1.0.0.overridden"},
+						{Module: "dependency:c", Target: "", Version: "1.0.0.locally_set"},
 					},
 				},
 			},
@@ -429,23 +433,23 @@ func TestDefaultBuildParamsApplied(t *testing.T) {
 
 	// group no_local_settings.
 	require.EqualValues(t, []string{"default_selector_1", "default_selector_2"}, ret.Groups[0].Build.Selectors)
-	require.ElementsMatch(t, Dependencies{{"dependency:a", "", "1.0.0.default"}, {"dependency:b", "", "2.0.0.default"}}, ret.Groups[0].Build.Dependencies)
+	require.ElementsMatch(t, Dependencies{{Module: "dependency:a", Target: "", Version: "1.0.0.default"}, {Module: "dependency:b", Target: "", Version: "2.0.0.default"}}, ret.Groups[0].Build.Dependencies)
 
 	// group dep_override.
 	require.EqualValues(t, []string{"default_selector_1", "default_selector_2"}, ret.Groups[1].Build.Selectors)
 	require.ElementsMatch(t, Dependencies{
-		{"dependency:a", "", "1.0.0.overridden"},
-		{"dependency:b", "", "2.0.0.default"},
-		{"dependency:c", "", "1.0.0.locally_set"},
-		{"dependency:d", "remote/fork", "1.0.0.locally_set"},
+		{Module: "dependency:a", Target: "", Version: "1.0.0.overridden"},
+		{Module: "dependency:b", Target: "", Version: "2.0.0.default"},
+		{Module: "dependency:c", Target: "", Version: "1.0.0.locally_set"},
+		{Module: "dependency:d", Target: "remote/fork", Version: "1.0.0.locally_set"},
 	}, ret.Groups[1].Build.Dependencies)
 
 	// group selector_and_dep_override
 	require.EqualValues(t, []string{"overridden"}, ret.Groups[2].Build.Selectors)
 	require.ElementsMatch(t, Dependencies{
-		{"dependency:a", "", "1.0.0.overridden"},
-		{"dependency:b", "", "2.0.0.default"},
-		{"dependency:c", "", "1.0.0.locally_set"},
+		{Module: "dependency:a", Target: "", Version: "1.0.0.overridden"},
+		{Module: "dependency:b", Target: "", Version: "2.0.0.default"},
+		{Module: "dependency:c", Target: "", Version: "1.0.0.locally_set"},
 	}, ret.Groups[2].Build.Dependencies)
 }
 
@@ -629,3 +633,242 @@ func TestValidateForBuildVerifiesThatBuildersAreDefined(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, ret)
 }
+
+func TestExpandMatrix(t *testing.T) {
+	c := &Composition{
+		Metadata: Metadata{},
+		Global: Global{
+			Plan:    "foo_plan",
+			Case:    "foo_case",
+			Builder: "docker:go",
+			Runner:  "local:docker",
+			Matrix: Matrix{
+				{Param: "conn_count", Values: []string{"10", "50", "100"}},
+			},
+		},
+		Groups: []*Group{
+			{
+				ID:        "a",
+				Instances: Instances{Count: 1},
+				Run: Run{
+					TestParams: map[string]string{
+						"conn_count": "5",
+						"other":      "value",
+					},
+				},
+				Matrix: Matrix{
+					{Param: "data_size_kb", Values: []string{"1", "2"}},
+				},
+			},
+			{
+				ID:        "b",
+				Instances: Instances{Count: 1},
+			},
+		},
+	}
+
+	comps, err := c.ExpandMatrix()
+	require.NoError(t, err)
+	require.Len(t, comps, 6)
+
+	// the original composition is untouched.
+	require.Len(t, c.Global.Matrix, 1)
+	require.EqualValues(t, "5", c.Groups[0].Run.TestParams["conn_count"])
+	require.Nil(t, c.Metadata.Coordinates)
+
+	seen := make(map[string]struct{})
+	for _, comp := range comps {
+		require.Empty(t, comp.Global.Matrix)
+		require.Empty(t, comp.Groups[0].Matrix)
+
+		coords := comp.Metadata.Coordinates
+		require.Len(t, coords, 2)
+		seen[coords["conn_count"]+"/"+coords["a.data_size_kb"]] = struct{}{}
+
+		// global axes apply to all groups, overriding explicit values.
+		require.EqualValues(t, coords["conn_count"], comp.Groups[0].Run.TestParams["conn_count"])
+		require.EqualValues(t, coords["conn_count"], comp.Groups[1].Run.TestParams["conn_count"])
+
+		// group axes only apply to their group.
+		require.EqualValues(t, coords["a.data_size_kb"], comp.Groups[0].Run.TestParams["data_size_kb"])
+		require.NotContains(t, comp.Groups[1].Run.TestParams, "data_size_kb")
+
+		require.EqualValues(t, "value", comp.Groups[0].Run.TestParams["other"])
+	}
+	require.Len(t, seen, 6)
+
+	// a composition without a matrix expands to itself.
+	c = &Composition{Groups: []*Group{{ID: "a"}}}
+	comps, err = c.ExpandMatrix()
+	require.NoError(t, err)
+	require.Len(t, comps, 1)
+	require.Same(t, c, comps[0])
+
+	// axes must be unique.
+	c = &Composition{
+		Global: Global{
+			Matrix: Matrix{
+				{Param: "x", Values: []string{"1"}},
+				{Param: "x", Values: []string{"2"}},
+			},
+		},
+		Groups: []*Group{{ID: "a"}},
+	}
+	_, err = c.ExpandMatrix()
+	require.Error(t, err)
+
+	// a group axis can't sweep a param swept by a global axis.
+	c = &Composition{
+		Global: Global{
+			Matrix: Matrix{{Param: "x", Values: []string{"1", "2"}}},
+		},
+		Groups: []*Group{{ID: "a", Matrix: Matrix{{Param: "x", Values: []string{"3", "4"}}}}},
+	}
+	_, err = c.ExpandMatrix()
+	require.Error(t, err)
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:         "foo_plan",
+			Case:         "foo_case",
+			Builder:      "docker:go",
+			Runner:       "local:docker",
+			Timeout:      "2h",
+			BuildTimeout: "15m",
+		},
+		Groups: []*Group{
+			{ID: "single", Instances: Instances{Count: 1}},
+		},
+	}
+
+	require.NoError(t, c.ValidateForRun())
+	require.Equal(t, 2*time.Hour, c.Global.TimeoutDuration())
+	require.Equal(t, 15*time.Minute, c.Global.BuildTimeoutDuration())
+
+	c.Global.Timeout = "soon"
+	require.Error(t, c.ValidateForRun())
+
+	c.Global.Timeout = ""
+	c.Global.BuildTimeout = "-1m"
+	require.Error(t, c.ValidateForBuild())
+}
+
+func TestValidateDependencies(t *testing.T) {
+	valid := []Dependency{
+		{Module: "example.com/mod", Version: "v1.0.0"},
+		{Module: "example.com/mod", Target: "example.com/fork", Version: "v1.0.0"},
+		{Module: "example.com/mod", Git: "https://example.com/fork.git"},
+		{Module: "example.com/mod", Git: "https://example.com/fork.git", Ref: "feature"},
+		{Module: "example.com/mod", Path: "forks/mod"},
+	}
+	for _, d := range valid {
+		require.NoError(t, d.Validate(), "dependency: %+v", d)
+	}
+
+	invalid := []Dependency{
+		{Version: "v1.0.0"},
+		{Module: "example.com/mod"},
+		{Module: "example.com/mod", Version: "v1.0.0", Path: "forks/mod"},
+		{Module: "example.com/mod", Git: "https://example.com/fork.git", Path: "forks/mod"},
+		{Module: "example.com/mod", Version: "v1.0.0", Ref: "feature"},
+		{Module: "example.com/mod", Target: "example.com/fork", Git: "https://example.com/fork.git"},
+	}
+	for _, d := range invalid {
+		require.Error(t, d.Validate(), "dependency: %+v", d)
+	}
+
+	c := &Composition{
+		Global: Global{Plan: "foo_plan", Case: "foo_case", Builder: "docker:go", TotalInstances: 1},
+		Groups: []*Group{{
+			ID:        "a",
+			Instances: Instances{Count: 1},
+			Build:     Build{Dependencies: Dependencies{{Module: "example.com/mod", Version: "v1.0.0", Git: "https://example.com/fork.git"}}},
+		}},
+	}
+	require.Error(t, c.ValidateForBuild())
+}
+
+func TestExpandDependencyMatrix(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:           "foo_plan",
+			Case:           "foo_case",
+			Builder:        "docker:go",
+			Runner:         "local:docker",
+			TotalInstances: 10,
+			Build: &Build{
+				Dependencies: Dependencies{{Module: "example.com/other", Version: "v0.1.0"}},
+				DependencyMatrix: DependencyMatrix{
+					{Module: "example.com/a", Versions: []string{"v0.2.8", "v0.3.0", "git+https://example.com/a.git#master"}},
+					{Module: "example.com/b", Target: "example.com/b-fork", Versions: []string{"v1.0.0", "v2.0.0"}},
+				},
+			},
+		},
+		Groups: []*Group{
+			{ID: "dialer", Instances: Instances{Count: 2}, Build: Build{Dependencies: Dependencies{{Module: "example.com/a", Version: "v0.1.0"}}}},
+			{ID: "listener", Instances: Instances{Percentage: 0.8}},
+		},
+	}
+
+	exp, err := c.ExpandDependencyMatrix()
+	require.NoError(t, err)
+
+	// the receiver is left untouched.
+	require.Len(t, c.Groups, 2)
+	require.Len(t, c.Global.Build.DependencyMatrix, 2)
+
+	require.Nil(t, exp.Global.Build.DependencyMatrix)
+	require.Len(t, exp.Groups, 12)
+	require.EqualValues(t, 60, exp.Global.TotalInstances)
+	require.Len(t, exp.Metadata.DependencyVariants, 6)
+
+	require.Equal(t, DependencyVariant{
+		Versions: map[string]string{"example.com/a": "v0.2.8", "example.com/b": "v2.0.0"},
+		Groups:   []string{"dialer-2", "listener-2"},
+	}, exp.Metadata.DependencyVariants[1])
+	require.Equal(t, map[string]string{"example.com/a": "git+https://example.com/a.git#master", "example.com/b": "v1.0.0"}, exp.Metadata.DependencyVariants[4].Versions)
+
+	// the matrix takes precedence over the dependencies of the group.
+	d2 := exp.Groups[1]
+	require.Equal(t, "dialer-2", d2.ID)
+	require.EqualValues(t, 2, d2.Instances.Count)
+	require.Equal(t, Dependencies{
+		{Module: "example.com/a", Version: "v0.2.8"},
+		{Module: "example.com/b", Target: "example.com/b-fork", Version: "v2.0.0"},
+	}, d2.Build.Dependencies)
+
+	l5 := exp.Groups[10]
+	require.Equal(t, "listener-5", l5.ID)
+	require.EqualValues(t, 8, l5.Instances.Count)
+	require.Zero(t, l5.Instances.Percentage)
+	require.Equal(t, Dependency{Module: "example.com/a", Git: "https://example.com/a.git", Ref: "master"}, l5.Build.Dependencies[0])
+
+	require.NoError(t, exp.ValidateForRun())
+
+	// variants of different groups built against the same versions are
+	// built once; global dependencies still trickle down.
+	manifest := &TestPlanManifest{
+		Name:     "foo_plan",
+		Builders: map[string]config.ConfigMap{"docker:go": {}},
+	}
+	bcomp, err := exp.PrepareForBuild(manifest)
+	require.NoError(t, err)
+	require.Equal(t, bcomp.Groups[1].BuildKey(), bcomp.Groups[7].BuildKey())
+	require.NotEqual(t, bcomp.Groups[0].BuildKey(), bcomp.Groups[1].BuildKey())
+	require.Contains(t, bcomp.Groups[7].Build.Dependencies, Dependency{Module: "example.com/other", Version: "v0.1.0"})
+
+	// compositions without a dependency matrix are returned as-is.
+	same, err := exp.ExpandDependencyMatrix()
+	require.NoError(t, err)
+	require.Same(t, exp, same)
+
+	c.Global.Build.DependencyMatrix[1].Versions = []string{"git+https://example.com/b.git", "path:"}
+	_, err = c.ExpandDependencyMatrix()
+	require.Error(t, err)
+
+	c.Global.Build.DependencyMatrix[1] = c.Global.Build.DependencyMatrix[0]
+	_, err = c.ExpandDependencyMatrix()
+	require.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DependencyAxis is a dimension of a dependency matrix: an upstream module,
+// and the versions to test the plan against.
+type DependencyAxis struct {
+	// Module is the module name/path of the dependency to override.
+	Module string `toml:"module" json:"module" validate:"required"`
+
+	// Target is the override module for published versions, if other than
+	// Module.
+	Target string `toml:"target" json:"target,omitempty"`
+
+	// Versions enumerates the sources to resolve the dependency from, one per
+	// variant: published versions of Target (or Module), Git repositories as
+	// "git+URL[#ref]", or directories of the extra sources as "path:DIR".
+	Versions []string `toml:"versions" json:"versions" validate:"required,gt=0"`
+}
+
+// DependencyMatrix is a set of dependency axes. A composition carrying a
+// dependency matrix is expanded into the cartesian product of the versions of
+// all its axes.
+type DependencyMatrix []DependencyAxis
+
+// DependencyVariant records a combination of dependency versions of a
+// dependency matrix, and the group variants built against it.
+type DependencyVariant struct {
+	// Versions maps the module of each axis to its version in this variant,
+	// as declared in the matrix.
+	Versions map[string]string `toml:"versions" json:"versions"`
+
+	// Groups are the IDs of the group variants built against these versions.
+	Groups []string `toml:"groups" json:"groups"`
+}
+
+// ParseDependency parses the source of a dependency override of module: a Git
+// repository as "git+URL[#ref]", a directory of the extra sources as
+// "path:DIR", or else a published version.
+func ParseDependency(module, spec string) (Dependency, error) {
+	dep := Dependency{Module: module}
+	switch {
+	case strings.HasPrefix(spec, "git+"):
+		dep.Git = strings.TrimPrefix(spec, "git+")
+		if i := strings.LastIndex(dep.Git, "#"); i >= 0 {
+			dep.Git, dep.Ref = dep.Git[:i], dep.Git[i+1:]
+		}
+	case strings.HasPrefix(spec, "path:"):
+		dep.Path = strings.TrimPrefix(spec, "path:")
+	default:
+		dep.Version = spec
+	}
+	return dep, dep.Validate()
+}
+
+// ExpandDependencyMatrix expands the dependency matrix declared in the global
+// build definition of this composition. Every group is replaced by one variant
+// per point of the cartesian product of all axes, identified as "<group
+// id>-<n>", with n starting at 1. Variants carry the dependency overrides of
+// their point, which take precedence over those declared in the composition.
+//
+// Variants of different groups built against the same versions share a build
+// key, so they are built once. Groups sized by percentage are turned into
+// counts, and the total instance count is multiplied by the number of points.
+// The variants are recorded in Metadata.DependencyVariants.
+//
+// The returned composition carries no dependency matrix. If this composition
+// has none, the receiver is returned.
+//
+// This method doesn't modify the composition.
+func (c *Composition) ExpandDependencyMatrix() (*Composition, error) {
+	if c.Global.Build == nil || len(c.Global.Build.DependencyMatrix) == 0 {
+		return c, nil
+	}
+	axes := c.Global.Build.DependencyMatrix
+
+	total := 1
+	seen := make(map[string]struct{}, len(axes))
+	for _, a := range axes {
+		if a.Module == "" {
+			return nil, fmt.Errorf("dependency matrix axis without a module")
+		}
+		if len(a.Versions) == 0 {
+			return nil, fmt.Errorf("dependency matrix axis %s has no versions", a.Module)
+		}
+		if _, ok := seen[a.Module]; ok {
+			return nil, fmt.Errorf("dependency matrix axis %s declared more than once", a.Module)
+		}
+		seen[a.Module] = struct{}{}
+		total *= len(a.Versions)
+	}
+
+	// resolve the dependencies of each point; the last axis varies fastest.
+	points := make([]Dependencies, 0, total)
+	variants := make([]DependencyVariant, 0, total)
+	for n := 0; n < total; n++ {
+		var (
+			deps     = make(Dependencies, len(axes))
+			versions = make(map[string]string, len(axes))
+			rem      = n
+		)
+		for i := len(axes) - 1; i >= 0; i-- {
+			a := axes[i]
+			v := a.Versions[rem%len(a.Versions)]
+			rem /= len(a.Versions)
+
+			dep, err := ParseDependency(a.Module, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version %q in dependency matrix: %w", v, err)
+			}
+			if dep.Version != "" {
+				dep.Target = a.Target
+			}
+			deps[i] = dep
+			versions[a.Module] = v
+		}
+		points = append(points, deps)
+		variants = append(variants, DependencyVariant{Versions: versions})
+	}
+
+	cpy := *c
+	build := *c.Global.Build
+	build.DependencyMatrix = nil
+	cpy.Global.Build = &build
+	cpy.Metadata.DependencyVariants = variants
+
+	cpy.Groups = make(Groups, 0, len(c.Groups)*total)
+	for _, g := range c.Groups {
+		for n, deps := range points {
+			v := g.clone()
+			v.ID = fmt.Sprintf("%s-%d", g.ID, n+1)
+			v.Build.Dependencies = deps.ApplyDefaults(g.Build.Dependencies)
+			if v.Instances.Percentage > 0 && c.Global.TotalInstances > 0 {
+				v.Instances.Count = uint(math.Round(v.Instances.Percentage * float64(c.Global.TotalInstances)))
+				v.Instances.Percentage = 0
+			}
+			cpy.Groups = append(cpy.Groups, v)
+			variants[n].Groups = append(variants[n].Groups, v.ID)
+		}
+	}
+	cpy.Global.TotalInstances *= uint(total)
+
+	return &cpy, nil
+}
@@ -37,13 +37,39 @@ type UnpackedSources struct {
 	ExtraDir string `json:"extra_dir"`
 }
 
+// TasksOrder is the order tasks are listed in, by creation time.
+type TasksOrder string
+
+const (
+	TasksNewestFirst TasksOrder = "newest"
+	TasksOldestFirst TasksOrder = "oldest"
+)
+
+// TasksFilters selects the tasks to list. Empty fields match all tasks.
 type TasksFilters struct {
 	Types    []task.Type
 	States   []task.State
-	After    *time.Time
-	Before   *time.Time
+	Since    *time.Time // Created at or after
+	Until    *time.Time // Created before
 	TestPlan string
 	TestCase string
+	Runner   string
+	Outcome  task.Outcome
+	Repo     string
+	Branch   string
+	Commit   string
+	User     string
+
+	Order  TasksOrder // Newest first by default
+	Offset int        // Number of matching tasks to skip
+	Limit  int        // Maximum number of tasks to list; zero for no limit
+
+	// Deprecated: use Since and Until. Before is the lower bound of the
+	// creation time, and After the upper bound; they are kept with this
+	// meaning for clients written against earlier daemons, and are ignored
+	// when Since or Until are set respectively.
+	Before *time.Time
+	After  *time.Time
 }
 
 type Engine interface {
@@ -58,6 +84,14 @@ type Engine interface {
 	QueueBuild(request *BuildRequest, sources *UnpackedSources) (string, error)
 	QueueRun(request *RunRequest, sources *UnpackedSources) (string, error)
 
+	AddSchedule(request *ScheduleRequest, sources *UnpackedSources) error
+	DeleteSchedule(id string) error
+	Schedules() ([]Schedule, error)
+
+	// GC applies the retention policy of the daemon, and deletes the files
+	// no task refers to anymore.
+	GC(dryRun bool) (*GCReport, error)
+
 	DoBuildPurge(ctx context.Context, builder, plan string, ow *rpc.OutputWriter) error
 	DoCollectOutputs(ctx context.Context, runID string, ow *rpc.OutputWriter) error
 	DoTerminate(ctx context.Context, ctype ComponentType, ref string, ow *rpc.OutputWriter) error
@@ -73,4 +107,17 @@ type TasksManager interface {
 	Kill(taskId string) error
 	DeleteTask(taskId string) error
 	Logs(ctx context.Context, taskId string, follow bool, cancel bool, w io.Writer) (*task.Task, error)
+
+	// Branches summarizes the runs created from each branch of a repository.
+	Branches(repo string) ([]task.BranchRuns, error)
+	// LastGreen returns the most recent successful run created from a branch
+	// of a repository, and of the given test plan if any.
+	LastGreen(repo, branch, plan string) (*task.Task, error)
+
+	// ExportTasks writes a bundle of the complete tasks selected by the
+	// request to w. See ExportRequest for its format.
+	ExportTasks(req ExportRequest, w io.Writer) (*ExportReport, error)
+	// ImportTasks reads a bundle written by ExportTasks, and stores the tasks
+	// it holds, unless already stored.
+	ImportTasks(r io.Reader) (*ImportReport, error)
 }
@@ -0,0 +1,35 @@
+package api
+
+import "time"
+
+// GCRequest is a request to apply the retention policy of the daemon.
+type GCRequest struct {
+	// Apply deletes what is reclaimed. Otherwise, the request is a dry run
+	// that only reports what would be.
+	Apply bool `json:"apply"`
+}
+
+// GCReport describes what a garbage collection reclaimed, or would reclaim
+// if it was a dry run.
+type GCReport struct {
+	DryRun bool     `json:"dry_run"`
+	Tasks  []GCTask `json:"tasks"` // Complete tasks deleted
+	Paths  []GCPath `json:"paths"` // Files and directories deleted
+	Bytes  int64    `json:"bytes"` // Disk space freed by deleting Paths
+}
+
+// GCTask is a complete task deleted by a garbage collection.
+type GCTask struct {
+	ID        string    `json:"id"`
+	Plan      string    `json:"plan"`
+	Case      string    `json:"case"`
+	Completed time.Time `json:"completed"`
+	Reason    string    `json:"reason"`
+}
+
+// GCPath is a file or directory deleted by a garbage collection.
+type GCPath struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// InstanceOverride gives specific instances of a group, selected by their
+// index within the group, a role and/or their own test params.
+type InstanceOverride struct {
+	// Instances selects the instances this override applies to, as a
+	// comma-separated list of indices and inclusive ranges of indices within
+	// the group, e.g. "0", "2-4" or "0,5-7".
+	Instances string `toml:"instances" json:"instances" validate:"required"`
+
+	// Role is a label assigned to the selected instances. It is passed to the
+	// test plan as the instance role.
+	Role string `toml:"role" json:"role"`
+
+	// TestParams are test params that override those of the group for the
+	// selected instances.
+	TestParams map[string]string `toml:"test_params" json:"test_params"`
+}
+
+// Indices parses the instance selector of this override and returns the
+// selected indices, in the order they appear in the selector.
+func (o InstanceOverride) Indices() ([]int, error) {
+	var ret []int
+	for _, part := range strings.Split(o.Instances, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("invalid instance selector %q: empty element", o.Instances)
+		}
+
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = part[:i], part[i+1:]
+		}
+
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid instance selector %q: bad index %q", o.Instances, from)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid instance selector %q: bad range %q", o.Instances, part)
+		}
+
+		for i := start; i <= end; i++ {
+			ret = append(ret, i)
+		}
+	}
+	return ret, nil
+}
+
+// validateInstanceOverrides verifies that the instance selectors of this
+// group are well-formed, and, if count is not zero, that they only select
+// instances below count.
+func (g *Group) validateInstanceOverrides(count uint) error {
+	for _, o := range g.InstanceOverrides {
+		idxs, err := o.Indices()
+		if err != nil {
+			return fmt.Errorf("group %s: %w", g.ID, err)
+		}
+		if count == 0 {
+			continue
+		}
+		for _, i := range idxs {
+			if uint(i) >= count {
+				return fmt.Errorf("group %s: instance override selects instance %d, but the group only has %d instances", g.ID, i, count)
+			}
+		}
+	}
+	return nil
+}
+
+// ForInstance returns the role and test params of the instance at the given
+// index within this group, after applying the instance overrides that select
+// it. Overrides are applied in order; later overrides win. Selectors are
+// expected to have been validated.
+func (g *RunGroup) ForInstance(idx int) (role string, params map[string]string) {
+	params = g.Parameters
+	copied := false
+
+	for _, o := range g.InstanceOverrides {
+		idxs, _ := o.Indices()
+		selected := false
+		for _, i := range idxs {
+			if i == idx {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			continue
+		}
+
+		if o.Role != "" {
+			role = o.Role
+		}
+		if len(o.TestParams) == 0 {
+			continue
+		}
+		if !copied {
+			params = make(map[string]string, len(g.Parameters)+len(o.TestParams))
+			for k, v := range g.Parameters {
+				params[k] = v
+			}
+			copied = true
+		}
+		for k, v := range o.TestParams {
+			params[k] = v
+		}
+	}
+	return role, params
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceOverrideIndices(t *testing.T) {
+	idxs, err := InstanceOverride{Instances: "0, 2-4,7"}.Indices()
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 2, 3, 4, 7}, idxs)
+
+	for _, sel := range []string{"", "a", "3-1", "-1", "1,,2"} {
+		_, err := InstanceOverride{Instances: sel}.Indices()
+		require.Error(t, err, sel)
+	}
+}
+
+func TestInstanceOverridesValidatedForRun(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:    "foo_plan",
+			Case:    "foo_case",
+			Builder: "docker:go",
+			Runner:  "local:docker",
+		},
+		Groups: []*Group{
+			{
+				ID:        "miners",
+				Instances: Instances{Count: 3},
+				InstanceOverrides: []InstanceOverride{
+					{Instances: "2-3", Role: "bootstrap"},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, c.ValidateForBuild())
+	require.Error(t, c.ValidateForRun())
+
+	c.Groups[0].InstanceOverrides[0].Instances = "0"
+	require.NoError(t, c.ValidateForRun())
+}
+
+func TestRunGroupForInstance(t *testing.T) {
+	g := &RunGroup{
+		ID:         "miners",
+		Instances:  4,
+		Parameters: map[string]string{"bootstrap": "false", "rate": "10"},
+		InstanceOverrides: []InstanceOverride{
+			{Instances: "0", Role: "bootstrapper", TestParams: map[string]string{"bootstrap": "true"}},
+			{Instances: "0-1", TestParams: map[string]string{"rate": "20"}},
+		},
+	}
+
+	role, params := g.ForInstance(0)
+	require.Equal(t, "bootstrapper", role)
+	require.Equal(t, map[string]string{"bootstrap": "true", "rate": "20"}, params)
+
+	role, params = g.ForInstance(1)
+	require.Equal(t, "", role)
+	require.Equal(t, map[string]string{"bootstrap": "false", "rate": "20"}, params)
+
+	role, params = g.ForInstance(3)
+	require.Equal(t, "", role)
+	require.Equal(t, map[string]string{"bootstrap": "false", "rate": "10"}, params)
+
+	// the group parameters are left untouched.
+	require.Equal(t, "false", g.Parameters["bootstrap"])
+}
@@ -3,16 +3,21 @@ package api
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/testground/testground/pkg/config"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/mitchellh/go-wordwrap"
 )
 
 // TestPlanManifest represents a test plan known by the system.
 type TestPlanManifest struct {
 	Name      string
+	Defaults  ManifestDefaults            `toml:"defaults"`
 	Builders  map[string]config.ConfigMap `toml:"builders"`
 	Runners   map[string]config.ConfigMap `toml:"runners"`
 	TestCases []*TestCase                 `toml:"testcases"`
@@ -25,6 +30,13 @@ type TestPlanManifest struct {
 	ExtraSources map[string][]string `toml:"extra_sources"`
 }
 
+// ManifestDefaults are the builder and runner used for this test plan when
+// none is specified.
+type ManifestDefaults struct {
+	Builder string `toml:"builder"`
+	Runner  string `toml:"runner"`
+}
+
 // TestCase represents a configuration for a test case known by the system.
 type TestCase struct {
 	Name      string
@@ -39,12 +51,22 @@ type Parameter struct {
 	Description string `toml:"desc"`
 	Unit        string
 	Default     interface{}
+
+	// Options enumerates the allowed values of enum parameters.
+	Options []string
+
+	// Min and Max bound the values of int, float and duration parameters.
+	// Duration bounds are expressed as strings, e.g. "10s".
+	Min interface{}
+	Max interface{}
 }
 
 // InstanceConstraints expresses how many instances this test case can run.
 type InstanceConstraints struct {
 	Minimum int `toml:"min"`
 	Maximum int `toml:"max"`
+	// Default is the number of instances to run when none is specified.
+	Default int `toml:"default"`
 }
 
 // TestCaseByName returns a test case by name.
@@ -74,6 +96,228 @@ func (tp *TestPlanManifest) SupportedBuilders() []string {
 	return builders
 }
 
+// ManifestError is a problem found in a test plan manifest, located by the
+// path of the offending TOML key, e.g. `testcases[0].params.count.default`.
+type ManifestError struct {
+	Location string
+	Message  string
+}
+
+func (e *ManifestError) Error() string {
+	return e.Location + ": " + e.Message
+}
+
+// Validate verifies that this manifest is well-formed, and reports every
+// problem found as a *ManifestError, aggregated in a multierror.
+//
+// builders and runners are the IDs of the builders and runners known to the
+// system; keys referencing any other builder or runner are reported.
+func (tp *TestPlanManifest) Validate(builders, runners []string) error {
+	var merr *multierror.Error
+	report := func(loc string, format string, a ...interface{}) {
+		merr = multierror.Append(merr, &ManifestError{Location: loc, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if tp.Name == "" {
+		report("name", "test plan name is required")
+	}
+
+	if len(tp.Builders) == 0 {
+		report("builders", "no builders declared")
+	}
+	bs := tp.SupportedBuilders()
+	sort.Strings(bs)
+	for _, b := range bs {
+		if !contains(builders, b) {
+			report(tomlKey("builders", b), "unknown builder; known builders are: %s", strings.Join(builders, ", "))
+		}
+	}
+
+	if len(tp.Runners) == 0 {
+		report("runners", "no runners declared")
+	}
+	rs := make([]string, 0, len(tp.Runners))
+	for r := range tp.Runners {
+		rs = append(rs, r)
+	}
+	sort.Strings(rs)
+	for _, r := range rs {
+		if !contains(runners, r) {
+			report(tomlKey("runners", r), "unknown runner; known runners are: %s", strings.Join(runners, ", "))
+		}
+	}
+
+	// Extra sources are keyed by builder, with colons replaced by
+	// underscores, e.g. docker_go.
+	es := make([]string, 0, len(tp.ExtraSources))
+	for b := range tp.ExtraSources {
+		es = append(es, b)
+	}
+	sort.Strings(es)
+	for _, b := range es {
+		var found bool
+		for _, declared := range bs {
+			if strings.Replace(declared, ":", "_", -1) == b {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report(tomlKey("extra_sources", b), "builder is not declared in builders")
+		}
+	}
+
+	if b := tp.Defaults.Builder; b != "" {
+		if _, ok := tp.Builders[b]; !ok {
+			report("defaults.builder", "default builder %q is not declared in builders", b)
+		}
+	}
+	if r := tp.Defaults.Runner; r != "" {
+		if _, ok := tp.Runners[r]; !ok {
+			report("defaults.runner", "default runner %q is not declared in runners", r)
+		}
+	}
+
+	if len(tp.TestCases) == 0 {
+		report("testcases", "no test cases declared")
+	}
+	seen := make(map[string]int, len(tp.TestCases))
+	for i, tc := range tp.TestCases {
+		loc := fmt.Sprintf("testcases[%d]", i)
+		if tc == nil {
+			report(loc, "empty test case")
+			continue
+		}
+
+		switch prev, dup := seen[tc.Name]; {
+		case tc.Name == "":
+			report(loc+".name", "test case name is required")
+		case dup:
+			report(loc+".name", "duplicate test case name %q; also declared by testcases[%d]", tc.Name, prev)
+		default:
+			seen[tc.Name] = i
+		}
+
+		if errs := tc.Instances.validate(loc + ".instances"); errs != nil {
+			merr = multierror.Append(merr, errs...)
+		}
+
+		params := make([]string, 0, len(tc.Parameters))
+		for n := range tc.Parameters {
+			params = append(params, n)
+		}
+		sort.Strings(params)
+		for _, n := range params {
+			if errs := tc.Parameters[n].validate(tomlKey(loc+".params", n)); errs != nil {
+				merr = multierror.Append(merr, errs...)
+			}
+		}
+	}
+
+	return merr.ErrorOrNil()
+}
+
+// validate verifies that these instance constraints are consistent.
+func (ic InstanceConstraints) validate(loc string) (errs []error) {
+	report := func(loc string, format string, a ...interface{}) {
+		errs = append(errs, &ManifestError{Location: loc, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if ic.Minimum < 0 {
+		report(loc+".min", "minimum must not be negative; got %d", ic.Minimum)
+	}
+	if ic.Maximum < ic.Minimum {
+		report(loc, "minimum %d is greater than maximum %d", ic.Minimum, ic.Maximum)
+	}
+	if ic.Default != 0 && (ic.Default < ic.Minimum || ic.Default > ic.Maximum) {
+		report(loc+".default", "default %d is outside of the [%d, %d] range", ic.Default, ic.Minimum, ic.Maximum)
+	}
+	return errs
+}
+
+// validate verifies that this parameter declares a supported type, that its
+// bounds and options make sense for that type, and that its default value is
+// valid.
+func (p Parameter) validate(loc string) (errs []error) {
+	report := func(loc string, format string, a ...interface{}) {
+		errs = append(errs, &ManifestError{Location: loc, Message: fmt.Sprintf(format, a...)})
+	}
+
+	var parse func(interface{}) (float64, error)
+	switch p.Type {
+	case ParamTypeInt, ParamTypeFloat:
+		parse = parseFloatBound
+	case ParamTypeDuration:
+		parse = parseDurationBound
+	case ParamTypeEnum:
+		if len(p.Options) == 0 {
+			report(loc+".options", "enum parameter declares no options")
+		}
+	case "", ParamTypeBool, ParamTypeString, ParamTypeJSON:
+	default:
+		report(loc+".type", "unsupported type %q", p.Type)
+		return errs
+	}
+
+	if parse == nil {
+		if p.Min != nil {
+			report(loc+".min", "bounds are only supported by int, float and duration parameters")
+		}
+		if p.Max != nil {
+			report(loc+".max", "bounds are only supported by int, float and duration parameters")
+		}
+	} else {
+		var (
+			min, max       float64
+			minErr, maxErr error
+		)
+		if p.Min != nil {
+			if min, minErr = parse(p.Min); minErr != nil {
+				report(loc+".min", "invalid bound: %s", minErr)
+			}
+		}
+		if p.Max != nil {
+			if max, maxErr = parse(p.Max); maxErr != nil {
+				report(loc+".max", "invalid bound: %s", maxErr)
+			}
+		}
+		if p.Min != nil && p.Max != nil && minErr == nil && maxErr == nil && min > max {
+			report(loc, "min %v is greater than max %v", p.Min, p.Max)
+		}
+	}
+
+	if p.Default != nil {
+		v, err := p.DefaultValue()
+		if err == nil {
+			err = p.ValidateValue(v)
+		}
+		if err != nil {
+			report(loc+".default", "invalid default for type %q: %s", p.Type, err)
+		}
+	}
+	return errs
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// tomlKey appends key to the TOML path prefix, quoting it if it's not a bare
+// key.
+func tomlKey(prefix, key string) string {
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return prefix + "." + strconv.Quote(key)
+		}
+	}
+	return prefix + "." + key
+}
+
 func (tp *TestPlanManifest) Describe(w io.Writer) {
 	p := func(w io.Writer, f string, a ...interface{}) {
 		s := wordwrap.WrapString(fmt.Sprintf(f, a...), 120)
@@ -99,6 +343,10 @@ func (tp *TestPlanManifest) Describe(w io.Writer) {
 	}()
 	p(w, "It can be run with strategies: %v.", rs)
 
+	if tp.Defaults.Builder != "" || tp.Defaults.Runner != "" {
+		p(w, "It defaults to builder %q and runner %q.", tp.Defaults.Builder, tp.Defaults.Runner)
+	}
+
 	p(w, "It has %d test cases.", len(tp.TestCases))
 }
 
@@ -107,6 +355,9 @@ func (tc *TestCase) Describe(w io.Writer) {
 	_, _ = fmt.Fprintf(w, "  Instances:\n")
 	_, _ = fmt.Fprintf(w, "    minimum: %d\n", tc.Instances.Minimum)
 	_, _ = fmt.Fprintf(w, "    maximum: %d\n", tc.Instances.Maximum)
+	if tc.Instances.Default != 0 {
+		_, _ = fmt.Fprintf(w, "    default: %d\n", tc.Instances.Default)
+	}
 	_, _ = fmt.Fprintf(w, "  Parameters:\n")
 
 	tw := tabwriter.NewWriter(w, 1, 0, 1, ' ', tabwriter.Debug)
@@ -5,6 +5,8 @@ import (
 
 	"github.com/testground/testground/pkg/config"
 
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/go-multierror"
 	"github.com/stretchr/testify/require"
 )
 
@@ -22,3 +24,100 @@ func TestManifestHasBuilder(t *testing.T) {
 	require.False(t, m.HasBuilder("docker:rust"))
 	require.False(t, m.HasBuilder("anything"))
 }
+
+func TestManifestValidateReportsAllErrors(t *testing.T) {
+	const manifest = `
+name = "foo_plan"
+
+[defaults]
+builder = "docker:go"
+runner = "local:exec"
+
+[builders."exec:go"]
+enabled = true
+
+[builders."docker:rust"]
+enabled = true
+
+[runners."local:docker"]
+enabled = true
+
+[[testcases]]
+name = "foo_case"
+instances = { min = 10, max = 2 }
+
+  [testcases.params]
+  count = { type = "int", default = "many" }
+  ratio = { type = "float", min = 1.0, max = 0.5 }
+  mode = { type = "enum" }
+  size = { type = "bytes" }
+
+[[testcases]]
+name = "foo_case"
+instances = { min = 1, max = 2, default = 3 }
+`
+
+	var m TestPlanManifest
+	_, err := toml.Decode(manifest, &m)
+	require.NoError(t, err)
+
+	err = m.Validate([]string{"exec:go", "docker:go"}, []string{"local:exec", "local:docker"})
+	require.Error(t, err)
+
+	var locs []string
+	for _, e := range err.(*multierror.Error).Errors {
+		var merr *ManifestError
+		require.ErrorAs(t, e, &merr)
+		locs = append(locs, merr.Location)
+	}
+
+	require.Equal(t, []string{
+		`builders."docker:rust"`,
+		"defaults.builder",
+		"defaults.runner",
+		"testcases[0].instances",
+		"testcases[0].params.count.default",
+		"testcases[0].params.mode.options",
+		"testcases[0].params.ratio",
+		"testcases[0].params.size.type",
+		"testcases[1].name",
+		"testcases[1].instances.default",
+	}, locs)
+}
+
+func TestManifestValidateValid(t *testing.T) {
+	const manifest = `
+name = "foo_plan"
+
+[defaults]
+builder = "exec:go"
+runner = "local:exec"
+
+[builders."exec:go"]
+enabled = true
+
+[runners."local:exec"]
+enabled = true
+
+[extra_sources]
+exec_go = ["../sdk"]
+
+[[testcases]]
+name = "foo_case"
+instances = { min = 1, max = 10, default = 2 }
+
+  [testcases.params]
+  count = { type = "int", min = 1, max = 100, default = 10 }
+  latency = { type = "duration", min = "10ms", max = "1s", default = "100ms" }
+  mode = { type = "enum", options = ["fast", "slow"], default = "fast" }
+  payload = { type = "json", default = { a = 1 } }
+`
+
+	var m TestPlanManifest
+	_, err := toml.Decode(manifest, &m)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Validate([]string{"exec:go"}, []string{"local:exec"}))
+	require.Equal(t, ManifestDefaults{Builder: "exec:go", Runner: "local:exec"}, m.Defaults)
+	require.Equal(t, 2, m.TestCases[0].Instances.Default)
+}
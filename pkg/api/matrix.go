@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+)
+
+// MatrixAxis is a dimension of a parameter sweep: a test parameter, and the
+// values it takes in each expanded composition.
+type MatrixAxis struct {
+	// Param is the name of the test parameter this axis sweeps over.
+	Param string `toml:"param" json:"param" validate:"required"`
+
+	// Values enumerates the values the parameter takes, one per composition.
+	Values []string `toml:"values" json:"values" validate:"required,gt=0"`
+}
+
+// Matrix is a set of axes. A composition carrying a matrix is expanded into
+// the cartesian product of the values of all its axes.
+type Matrix []MatrixAxis
+
+// HasMatrix returns whether this composition declares any matrix axes, either
+// globally or in any of its groups.
+func (c *Composition) HasMatrix() bool {
+	if len(c.Global.Matrix) > 0 {
+		return true
+	}
+	for _, g := range c.Groups {
+		if len(g.Matrix) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandMatrix expands the matrix declared in this composition into one
+// concrete composition per point of the cartesian product of all axes.
+//
+// Global axes set the parameter on every group; group axes only set it on the
+// group declaring them, and can't sweep a parameter swept by a global axis. Values set through a matrix take precedence over test
+// params set explicitly in the composition. The coordinates of each point are
+// recorded in Metadata.Coordinates, keyed by parameter name for global axes,
+// and by "<group id>.<parameter>" for group axes.
+//
+// The returned compositions carry no matrix. If this composition has no
+// matrix, a single-element slice containing the receiver is returned.
+//
+// This method doesn't modify the composition.
+func (c *Composition) ExpandMatrix() ([]*Composition, error) {
+	if !c.HasMatrix() {
+		return []*Composition{c}, nil
+	}
+
+	type axis struct {
+		key   string
+		group int // -1 for global axes.
+		MatrixAxis
+	}
+
+	var axes []axis
+	seen := make(map[string]struct{})
+	add := func(key string, group int, a MatrixAxis) error {
+		if a.Param == "" {
+			return fmt.Errorf("matrix axis without a param")
+		}
+		if len(a.Values) == 0 {
+			return fmt.Errorf("matrix axis %s has no values", key)
+		}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("matrix axis %s declared more than once", key)
+		}
+		seen[key] = struct{}{}
+		axes = append(axes, axis{key, group, a})
+		return nil
+	}
+
+	for _, a := range c.Global.Matrix {
+		if err := add(a.Param, -1, a); err != nil {
+			return nil, err
+		}
+	}
+	for i, g := range c.Groups {
+		for _, a := range g.Matrix {
+			// the value of the global axis would be set over the one of the
+			// group axis.
+			if _, ok := seen[a.Param]; ok {
+				return nil, fmt.Errorf("matrix axis %s.%s sweeps a param already swept by a global axis", g.ID, a.Param)
+			}
+			if err := add(g.ID+"."+a.Param, i, a); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	total := 1
+	for _, a := range axes {
+		total *= len(a.Values)
+	}
+
+	ret := make([]*Composition, 0, total)
+	for n := 0; n < total; n++ {
+		comp := c.cloneWithoutMatrix()
+		comp.Metadata.Coordinates = make(map[string]string, len(axes))
+
+		// decompose n into one index per axis; the last axis varies fastest.
+		rem := n
+		for i := len(axes) - 1; i >= 0; i-- {
+			a := axes[i]
+			v := a.Values[rem%len(a.Values)]
+			rem /= len(a.Values)
+
+			comp.Metadata.Coordinates[a.key] = v
+			for j, g := range comp.Groups {
+				if a.group != -1 && a.group != j {
+					continue
+				}
+				if g.Run.TestParams == nil {
+					g.Run.TestParams = make(map[string]string)
+				}
+				g.Run.TestParams[a.Param] = v
+			}
+		}
+		ret = append(ret, comp)
+	}
+
+	return ret, nil
+}
+
+// cloneWithoutMatrix returns a copy of this composition whose groups and test
+// params can be mutated without affecting the receiver, and which carries no
+// matrix.
+func (c *Composition) cloneWithoutMatrix() *Composition {
+	cpy := c.clone()
+	cpy.Global.Matrix = nil
+	for _, g := range cpy.Groups {
+		g.Matrix = nil
+	}
+	return cpy
+}
+
+// clone returns a copy of this composition whose groups, and their test params
+// and profiles, can be mutated without affecting the receiver.
+func (c *Composition) clone() *Composition {
+	cpy := *c
+	cpy.Groups = make(Groups, 0, len(c.Groups))
+	for _, g := range c.Groups {
+		cpy.Groups = append(cpy.Groups, g.clone())
+	}
+	return &cpy
+}
+
+// clone returns a copy of this group whose test params and profiles can be
+// mutated without affecting the receiver.
+func (g *Group) clone() *Group {
+	copyMap := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		ret := make(map[string]string, len(m))
+		for k, v := range m {
+			ret[k] = v
+		}
+		return ret
+	}
+
+	grp := *g
+	grp.Run.TestParams = copyMap(g.Run.TestParams)
+	grp.Run.Profiles = copyMap(g.Run.Profiles)
+	return &grp
+}
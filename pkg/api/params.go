@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Supported test case parameter types.
+const (
+	ParamTypeInt      = "int"
+	ParamTypeFloat    = "float"
+	ParamTypeBool     = "bool"
+	ParamTypeDuration = "duration"
+	ParamTypeString   = "string"
+	ParamTypeJSON     = "json"
+	ParamTypeEnum     = "enum"
+)
+
+// ValidateValue verifies that the supplied value can be parsed as the type
+// declared by this parameter, that it is one of the allowed options for enum
+// parameters, and that it is within the declared bounds for numeric and
+// duration parameters.
+//
+// Parameters with an empty or unrecognised type accept any value.
+func (p Parameter) ValidateValue(value string) error {
+	switch p.Type {
+	case ParamTypeInt:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("value %q is not an int", value)
+		}
+		return p.checkBounds(float64(v), value, parseFloatBound)
+
+	case ParamTypeFloat:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("value %q is not a float", value)
+		}
+		return p.checkBounds(v, value, parseFloatBound)
+
+	case ParamTypeDuration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("value %q is not a duration", value)
+		}
+		return p.checkBounds(float64(v), value, parseDurationBound)
+
+	case ParamTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("value %q is not a bool", value)
+		}
+
+	case ParamTypeJSON:
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("value %q is not valid json", value)
+		}
+
+	case ParamTypeEnum:
+		for _, o := range p.Options {
+			if o == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("value %q is not one of the allowed options %v", value, p.Options)
+	}
+
+	return nil
+}
+
+// DefaultValue returns the default value of this parameter in the string form
+// that test params take. String defaults are returned as-is; other defaults
+// are encoded as JSON.
+func (p Parameter) DefaultValue() (string, error) {
+	if s, ok := p.Default.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(p.Default)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// checkBounds verifies that v lies within the [Min, Max] range of this
+// parameter, if any. Bounds are parsed with the supplied function.
+func (p Parameter) checkBounds(v float64, value string, parse func(interface{}) (float64, error)) error {
+	if p.Min != nil {
+		min, err := parse(p.Min)
+		if err != nil {
+			return fmt.Errorf("invalid min bound: %w", err)
+		}
+		if v < min {
+			return fmt.Errorf("value %s is lower than the minimum %v", value, p.Min)
+		}
+	}
+	if p.Max != nil {
+		max, err := parse(p.Max)
+		if err != nil {
+			return fmt.Errorf("invalid max bound: %w", err)
+		}
+		if v > max {
+			return fmt.Errorf("value %s is greater than the maximum %v", value, p.Max)
+		}
+	}
+	return nil
+}
+
+func parseFloatBound(b interface{}) (float64, error) {
+	switch v := b.(type) {
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("unexpected bound %v", b)
+	}
+}
+
+func parseDurationBound(b interface{}) (float64, error) {
+	s, ok := b.(string)
+	if !ok {
+		return 0, fmt.Errorf("duration bound %v must be a string", b)
+	}
+	d, err := time.ParseDuration(s)
+	return float64(d), err
+}
+
+// ValidateTestParams verifies that every test parameter supplied in this
+// composition, either globally, in a group or in an instance override, is
+// declared by the test case in the manifest, and that its value is valid for
+// the declared type. All problems are reported at once.
+//
+// For compositions with stages, the test params of each stage are validated
+// against the stage's test case.
+func (c *Composition) ValidateTestParams(manifest *TestPlanManifest) error {
+	if len(c.Stages) > 0 {
+		var merr *multierror.Error
+		for i, stage := range c.Stages {
+			comp, err := c.ForStage(i)
+			if err == nil {
+				err = comp.ValidateTestParams(manifest)
+			}
+			if err == nil {
+				continue
+			}
+			errs := []error{err}
+			if serr, ok := err.(*multierror.Error); ok {
+				errs = serr.Errors
+			}
+			for _, err := range errs {
+				merr = multierror.Append(merr, fmt.Errorf("stage %d (%s): %w", i+1, stage.Case, err))
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+
+	_, tcase, ok := manifest.TestCaseByName(c.Global.Case)
+	if !ok {
+		return fmt.Errorf("test case %s not found in plan %s", c.Global.Case, manifest.Name)
+	}
+
+	var merr *multierror.Error
+	check := func(scope string, params map[string]string) {
+		names := make([]string, 0, len(params))
+		for n := range params {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		for _, n := range names {
+			p, ok := tcase.Parameters[n]
+			if !ok {
+				merr = multierror.Append(merr, fmt.Errorf("%s: unknown test parameter %q for test case %s", scope, n, tcase.Name))
+				continue
+			}
+			if err := p.ValidateValue(params[n]); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("%s: invalid test parameter %q: %w", scope, n, err))
+			}
+		}
+	}
+
+	if c.Global.Run != nil {
+		check("global", c.Global.Run.TestParams)
+	}
+	for _, g := range c.Groups {
+		check("group "+g.ID, g.Run.TestParams)
+		for _, o := range g.InstanceOverrides {
+			check(fmt.Sprintf("group %s instances %s", g.ID, o.Instances), o.TestParams)
+		}
+	}
+
+	return merr.ErrorOrNil()
+}
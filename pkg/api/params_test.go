@@ -0,0 +1,116 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameterValidateValue(t *testing.T) {
+	const manifest = `
+name = "foo_plan"
+
+[[testcases]]
+name = "foo_case"
+instances = { min = 1, max = 10 }
+
+  [testcases.params]
+  count = { type = "int", min = 1, max = 100 }
+  ratio = { type = "float", min = 0, max = 1.0 }
+  flag = { type = "bool" }
+  latency = { type = "duration", min = "10ms", max = "1s" }
+  name = { type = "string" }
+  payload = { type = "json" }
+  mode = { type = "enum", options = ["fast", "slow"] }
+`
+
+	var m TestPlanManifest
+	_, err := toml.Decode(manifest, &m)
+	require.NoError(t, err)
+
+	params := m.TestCases[0].Parameters
+
+	cases := []struct {
+		param string
+		value string
+		ok    bool
+	}{
+		{"count", "10", true},
+		{"count", "abc", false},
+		{"count", "0", false},
+		{"count", "101", false},
+		{"ratio", "0.5", true},
+		{"ratio", "1.5", false},
+		{"flag", "true", true},
+		{"flag", "yes", false},
+		{"latency", "100ms", true},
+		{"latency", "1ms", false},
+		{"latency", "10", false},
+		{"name", "anything", true},
+		{"payload", `{"a": 1}`, true},
+		{"payload", `{"a": `, false},
+		{"mode", "fast", true},
+		{"mode", "medium", false},
+	}
+
+	for _, c := range cases {
+		err := params[c.param].ValidateValue(c.value)
+		if c.ok {
+			require.NoError(t, err, "%s=%s", c.param, c.value)
+		} else {
+			require.Error(t, err, "%s=%s", c.param, c.value)
+		}
+	}
+}
+
+func TestValidateTestParamsReportsAllErrors(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan: "foo_plan",
+			Case: "foo_case",
+			Run: &Run{
+				TestParams: map[string]string{
+					"conn_cout": "10",
+				},
+			},
+		},
+		Groups: []*Group{
+			{
+				ID: "a",
+				Run: Run{
+					TestParams: map[string]string{
+						"data_size_kb": "abc",
+					},
+				},
+			},
+			{
+				ID: "b",
+				Run: Run{
+					TestParams: map[string]string{
+						"data_size_kb": "128",
+					},
+				},
+			},
+		},
+	}
+
+	manifest := &TestPlanManifest{
+		Name: "foo_plan",
+		TestCases: []*TestCase{
+			{
+				Name: "foo_case",
+				Parameters: map[string]Parameter{
+					"conn_count":   {Type: "int"},
+					"data_size_kb": {Type: "int"},
+				},
+			},
+		},
+	}
+
+	err := c.ValidateTestParams(manifest)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown test parameter "conn_cout"`)
+	require.Contains(t, err.Error(), `group a: invalid test parameter "data_size_kb"`)
+	require.NotContains(t, err.Error(), "group b")
+}
@@ -0,0 +1,107 @@
+package api
+
+import "time"
+
+// Classes of infrastructure errors a task can be retried on. Errors of other
+// classes are attributed to the test plan, and never retried.
+const (
+	// RetryOnHealthcheck covers healthchecks of builders and runners that
+	// failed and couldn't be fixed, e.g. a sidecar that isn't ready.
+	RetryOnHealthcheck = "healthcheck"
+
+	// RetryOnRunnerDisabled covers runs on a runner disabled by config.
+	RetryOnRunnerDisabled = "runner_disabled"
+
+	// RetryOnDocker covers errors reaching or returned by the Docker daemon.
+	RetryOnDocker = "docker"
+
+	// RetryOnTimeout covers operations of the infrastructure that timed out,
+	// e.g. pulling an image. Builds and runs exceeding the timeouts of their
+	// composition are not covered.
+	RetryOnTimeout = "timeout"
+
+	// RetryOnSyncService covers failures to connect to the sync service.
+	RetryOnSyncService = "sync_service"
+)
+
+// RetryClasses enumerates all classes of errors a task can be retried on.
+var RetryClasses = []string{
+	RetryOnHealthcheck,
+	RetryOnRunnerDisabled,
+	RetryOnDocker,
+	RetryOnTimeout,
+	RetryOnSyncService,
+}
+
+// RetryPolicy declares how builds and runs failing because of an
+// infrastructure error are retried. Retried tasks are scheduled again once
+// their backoff elapses.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. Zero or one disable retries.
+	MaxAttempts int `toml:"max_attempts" json:"max_attempts,omitempty" validate:"min=0"`
+
+	// Backoff is the delay before the first retry, expressed as a
+	// time.Duration string (e.g. "30s"). It doubles on every retry.
+	Backoff string `toml:"backoff" json:"backoff,omitempty" validate:"omitempty,duration"`
+
+	// MaxBackoff caps the delay between retries, expressed as a time.Duration
+	// string (e.g. "10m").
+	MaxBackoff string `toml:"max_backoff" json:"max_backoff,omitempty" validate:"omitempty,duration"`
+
+	// On lists the classes of errors to retry on; see RetryClasses. All of
+	// them are retried on if empty.
+	On []string `toml:"on" json:"on,omitempty" validate:"omitempty,dive,oneof=healthcheck runner_disabled docker timeout sync_service"`
+}
+
+// ApplyDefaults returns a copy of this policy, with unset fields taken from
+// the supplied default policy.
+func (p RetryPolicy) ApplyDefaults(def RetryPolicy) RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.Backoff == "" {
+		p.Backoff = def.Backoff
+	}
+	if p.MaxBackoff == "" {
+		p.MaxBackoff = def.MaxBackoff
+	}
+	if len(p.On) == 0 {
+		p.On = def.On
+	}
+	return p
+}
+
+// RetriesOn returns whether this policy retries on errors of the class.
+func (p RetryPolicy) RetriesOn(class string) bool {
+	if class == "" {
+		return false
+	}
+	if len(p.On) == 0 {
+		return true
+	}
+	for _, c := range p.On {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// BackoffFor returns the delay before the given retry, starting at 1.
+func (p RetryPolicy) BackoffFor(retry int) time.Duration {
+	var (
+		d   = parseTimeout(p.Backoff)
+		max = parseTimeout(p.MaxBackoff)
+	)
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if max > 0 && d >= max {
+			break
+		}
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
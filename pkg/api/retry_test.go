@@ -0,0 +1,45 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	def := RetryPolicy{MaxAttempts: 3, Backoff: "10s", MaxBackoff: "30s", On: []string{RetryOnDocker}}
+
+	p := RetryPolicy{MaxAttempts: 5}.ApplyDefaults(def)
+	require.Equal(t, RetryPolicy{MaxAttempts: 5, Backoff: "10s", MaxBackoff: "30s", On: []string{RetryOnDocker}}, p)
+
+	require.True(t, p.RetriesOn(RetryOnDocker))
+	require.False(t, p.RetriesOn(RetryOnHealthcheck))
+	require.False(t, p.RetriesOn(""))
+	require.True(t, RetryPolicy{}.RetriesOn(RetryOnHealthcheck))
+
+	require.Equal(t, 10*time.Second, p.BackoffFor(1))
+	require.Equal(t, 20*time.Second, p.BackoffFor(2))
+	require.Equal(t, 30*time.Second, p.BackoffFor(3))
+	require.Equal(t, 30*time.Second, p.BackoffFor(10))
+	require.Zero(t, RetryPolicy{}.BackoffFor(2))
+
+	c := &Composition{
+		Global: Global{
+			Plan:           "foo_plan",
+			Case:           "foo_case",
+			Builder:        "docker:go",
+			Runner:         "local:docker",
+			TotalInstances: 1,
+			Retry:          &RetryPolicy{MaxAttempts: 3, Backoff: "10s", On: []string{RetryOnTimeout}},
+		},
+		Groups: []*Group{{ID: "a", Instances: Instances{Count: 1}}},
+	}
+	require.NoError(t, c.ValidateForRun())
+
+	c.Global.Retry.On = []string{"test_failure"}
+	require.Error(t, c.ValidateForRun())
+
+	c.Global.Retry.On, c.Global.Retry.Backoff = nil, "soon"
+	require.Error(t, c.ValidateForRun())
+}
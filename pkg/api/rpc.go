@@ -21,6 +21,14 @@ type BuildRequest struct {
 	Composition Composition      `json:"composition"`
 	Manifest    TestPlanManifest `json:"manifest"`
 	CreatedBy   CreatedBy        `json:"created_by"`
+
+	// DependsOn lists the tasks that must complete successfully before this
+	// build is scheduled.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Preemptible allows the build to be interrupted, and scheduled again, in
+	// favour of a higher priority task when all workers are busy.
+	Preemptible bool `json:"preemptible,omitempty"`
 }
 
 // RunRequest is the request struct for the `run` function.
@@ -30,10 +38,22 @@ type RunRequest struct {
 	Composition Composition      `json:"composition"`
 	Manifest    TestPlanManifest `json:"manifest"`
 	CreatedBy   CreatedBy        `json:"created_by"`
+	Sweep       *Sweep           `json:"sweep,omitempty"`
+
+	// DependsOn lists the tasks that must complete successfully before this
+	// run is scheduled. Groups without an artifact reuse the artifacts of
+	// prerequisite build tasks that built them.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Preemptible allows the run to be interrupted, and scheduled again, in
+	// favour of a higher priority task when all workers are busy.
+	Preemptible bool `json:"preemptible,omitempty"`
 }
 
 type CreatedBy task.CreatedBy
 
+type Sweep task.Sweep
+
 type OutputsRequest struct {
 	Runner string `json:"runner"`
 	RunID  string `json:"run_id"`
@@ -56,6 +76,16 @@ type BuildPurgeRequest struct {
 
 type TasksRequest = TasksFilters
 
+type BranchesRequest struct {
+	Repo string `json:"repo"`
+}
+
+type LastGreenRequest struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	Plan   string `json:"plan"`
+}
+
 type StatusRequest struct {
 	TaskID string `json:"task_id"`
 }
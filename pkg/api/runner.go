@@ -12,8 +12,9 @@ import (
 // test plan in executable form and schedules a run of a particular test case
 // within it.
 //
-// TODO cardinality: do we want to be able to run multiple test cases within a
-// test plan in a single call?
+// A runner runs a single test case per call. Compositions running several
+// test cases (see Composition.Stages) are executed by the engine as a
+// sequence of calls, one per stage.
 type Runner interface {
 	// ID returns the canonical identifier for this runner.
 	ID() string
@@ -79,9 +80,18 @@ type RunGroup struct {
 	// Parameters are the runtime parameters to the test case.
 	Parameters map[string]string
 
+	// InstanceOverrides assigns roles and parameters to specific instances of
+	// this group. Use ForInstance to resolve them.
+	InstanceOverrides []InstanceOverride
+
 	// Profiles specifies the profiles to capture. Refer to the docs
 	// on Run#Profiles for more info.
 	Profiles map[string]string
+
+	// RunnerConfig is the configuration of the runner for this group: the
+	// RunInput.RunnerConfig coalesced with the group's overrides. It has the
+	// same type as RunInput.RunnerConfig.
+	RunnerConfig interface{}
 }
 
 type RunOutput struct {
@@ -118,3 +128,52 @@ type CollectionInput struct {
 type Terminatable interface {
 	TerminateAll(context.Context, *rpc.OutputWriter) error
 }
+
+// Capacity is an amount of resources used by test instances. Zero values
+// denote no limit when expressing the capacity of a runner.
+type Capacity struct {
+	// CPUs is a number of CPU cores, possibly fractional.
+	CPUs float64 `json:"cpus"`
+
+	// Memory is an amount of memory, in bytes.
+	Memory int64 `json:"memory"`
+
+	// Instances is a number of test instances.
+	Instances int `json:"instances"`
+}
+
+// Add returns the sum of both capacities.
+func (c Capacity) Add(o Capacity) Capacity {
+	return Capacity{CPUs: c.CPUs + o.CPUs, Memory: c.Memory + o.Memory, Instances: c.Instances + o.Instances}
+}
+
+// Sub returns the difference of both capacities.
+func (c Capacity) Sub(o Capacity) Capacity {
+	return Capacity{CPUs: c.CPUs - o.CPUs, Memory: c.Memory - o.Memory, Instances: c.Instances - o.Instances}
+}
+
+// IsZero returns whether this capacity holds no resources.
+func (c Capacity) IsZero() bool {
+	return c == Capacity{}
+}
+
+// Admits returns whether the demand can be allocated within this capacity on
+// top of the resources already in use. Dimensions without a limit admit any
+// demand.
+func (c Capacity) Admits(used, demand Capacity) bool {
+	total := used.Add(demand)
+	return (c.CPUs <= 0 || total.CPUs <= c.CPUs) &&
+		(c.Memory <= 0 || total.Memory <= c.Memory) &&
+		(c.Instances <= 0 || total.Instances <= c.Instances)
+}
+
+// CapacityReporter is the interface to be implemented by runners that can
+// report the resources available to test instances. The engine only starts
+// runs on these runners once the resources they demand are available.
+type CapacityReporter interface {
+	// Capacity returns the resources available to test instances, and the
+	// resources an instance is allotted when its group doesn't request any,
+	// given the configuration of the runner (of the type returned by
+	// ConfigType).
+	Capacity(ctx context.Context, runnerConfig interface{}) (total Capacity, instance Capacity, err error)
+}
@@ -0,0 +1,62 @@
+package api
+
+import "time"
+
+// Sources of schedules.
+const (
+	// ScheduleSourceConfig denotes a schedule declared in the configuration
+	// of the daemon.
+	ScheduleSourceConfig = "config"
+
+	// ScheduleSourceAPI denotes a schedule registered through the API.
+	ScheduleSourceAPI = "api"
+)
+
+// ScheduleRequest is the request struct for the `schedule` function. It
+// registers a run request, to be queued on a cron expression.
+type ScheduleRequest struct {
+	ID   string     `json:"id"`
+	Cron string     `json:"cron"`
+	Run  RunRequest `json:"run"`
+}
+
+// ScheduleDeleteRequest is the request struct for the `schedule delete`
+// function.
+type ScheduleDeleteRequest struct {
+	ID string `json:"id"`
+}
+
+// Schedule describes a composition run on a recurring schedule.
+type Schedule struct {
+	ID     string `json:"id"`
+	Cron   string `json:"cron"`
+	Source string `json:"source"`
+	Plan   string `json:"plan"`
+	Case   string `json:"case"`
+
+	// Upcoming are the next times the schedule queues a run at.
+	Upcoming []time.Time `json:"upcoming"`
+
+	// Executions are the last times the schedule queued a run at, oldest
+	// first.
+	Executions []ScheduleExecution `json:"executions"`
+}
+
+// ScheduleExecution records a run queued by a schedule.
+type ScheduleExecution struct {
+	Time time.Time `json:"time"`
+
+	// TaskID is the ID of the run queued, if it was queued successfully.
+	TaskID string `json:"task_id,omitempty"`
+
+	// Error is the reason the run couldn't be queued, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// ScheduleCreatedBy returns the creator recorded on runs queued by the
+// schedule.
+func ScheduleCreatedBy(id string) CreatedBy {
+	return CreatedBy{User: "schedule:" + id}
+}
+
+type SchedulesResponse = []Schedule
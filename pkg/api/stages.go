@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stage failure policies.
+const (
+	// OnFailureAbort skips all subsequent stages when a stage fails. It is the
+	// default.
+	OnFailureAbort = "abort"
+
+	// OnFailureContinue proceeds with the next stage when a stage fails. The
+	// pipeline is still reported as failed.
+	OnFailureContinue = "continue"
+)
+
+// Stage is a step of a composition executed as a pipeline: a test case run
+// against the artifacts built for the composition.
+type Stage struct {
+	// Case is the test case to run in this stage.
+	Case string `toml:"case" json:"case" validate:"required"`
+
+	// OnFailure is the policy to apply when this stage fails: "abort"
+	// (default) or "continue".
+	OnFailure string `toml:"on_failure" json:"on_failure" validate:"omitempty,oneof=abort continue"`
+
+	// TestParams are test params applied to all groups for this stage only.
+	// They take precedence over global test params, but not over group ones.
+	TestParams map[string]string `toml:"test_params" json:"test_params"`
+
+	// Timeout bounds the duration of this stage, expressed as a time.Duration
+	// string (e.g. "30s"). A stage exceeding it is stopped, and its outcome
+	// is "timeout"; it is then handled like any other stage failure.
+	Timeout string `toml:"timeout" json:"timeout,omitempty" validate:"omitempty,duration"`
+}
+
+// ContinueOnFailure returns whether the pipeline proceeds when this stage
+// fails.
+func (s Stage) ContinueOnFailure() bool {
+	return s.OnFailure == OnFailureContinue
+}
+
+// TimeoutDuration returns the timeout of this stage, or zero if it has none.
+func (s Stage) TimeoutDuration() time.Duration {
+	return parseTimeout(s.Timeout)
+}
+
+// ForStage returns the composition to run for the stage at index i: a copy of
+// this composition with the stage's test case and test params, and no stages.
+//
+// This method doesn't modify the composition.
+func (c *Composition) ForStage(i int) (*Composition, error) {
+	if i < 0 || i >= len(c.Stages) {
+		return nil, fmt.Errorf("stage %d out of range; composition has %d stages", i, len(c.Stages))
+	}
+	stage := c.Stages[i]
+
+	comp := c.clone()
+	comp.Stages = nil
+	comp.Global.Case = stage.Case
+
+	if len(stage.TestParams) > 0 {
+		run := Run{}
+		if c.Global.Run != nil {
+			run = *c.Global.Run
+		}
+		run.TestParams = make(map[string]string, len(run.TestParams)+len(stage.TestParams))
+		if c.Global.Run != nil {
+			for k, v := range c.Global.Run.TestParams {
+				run.TestParams[k] = v
+			}
+		}
+		for k, v := range stage.TestParams {
+			run.TestParams[k] = v
+		}
+		comp.Global.Run = &run
+	}
+
+	return comp, nil
+}
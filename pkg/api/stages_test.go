@@ -0,0 +1,46 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForStage(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:    "foo_plan",
+			Builder: "docker:go",
+			Runner:  "local:docker",
+			Run: &Run{
+				TestParams: map[string]string{"a": "global", "b": "global"},
+			},
+		},
+		Groups: []*Group{
+			{ID: "single", Instances: Instances{Count: 1}},
+		},
+		Stages: []Stage{
+			{Case: "setup"},
+			{Case: "soak", OnFailure: OnFailureContinue, TestParams: map[string]string{"b": "soak"}},
+		},
+	}
+
+	// a pipeline doesn't need a global test case.
+	require.NoError(t, c.ValidateForRun())
+
+	comp, err := c.ForStage(1)
+	require.NoError(t, err)
+	require.Equal(t, "soak", comp.Global.Case)
+	require.Empty(t, comp.Stages)
+	require.Equal(t, map[string]string{"a": "global", "b": "soak"}, comp.Global.Run.TestParams)
+
+	// the original composition is untouched.
+	require.Equal(t, "global", c.Global.Run.TestParams["b"])
+	require.NotSame(t, c.Groups[0], comp.Groups[0])
+
+	_, err = c.ForStage(2)
+	require.Error(t, err)
+
+	c.Stages[0].OnFailure = "retry"
+	require.Error(t, c.ValidateForRun())
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// TimeoutDuration returns the timeout of the run phase, or zero if none is
+// set. The timeout is expected to have been validated.
+func (g Global) TimeoutDuration() time.Duration {
+	return parseTimeout(g.Timeout)
+}
+
+// BuildTimeoutDuration returns the timeout of the build phase, or zero if
+// none is set. The timeout is expected to have been validated.
+func (g Global) BuildTimeoutDuration() time.Duration {
+	return parseTimeout(g.BuildTimeout)
+}
+
+func parseTimeout(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, _ := time.ParseDuration(s)
+	return d
+}
+
+// validateDuration validates that a field holds a positive time.Duration
+// string.
+func validateDuration(fl validator.FieldLevel) bool {
+	d, err := time.ParseDuration(fl.Field().String())
+	return err == nil && d > 0
+}
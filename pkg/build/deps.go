@@ -0,0 +1,163 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// localDependency is a dependency resolved from sources: either fetched from
+// a Git repository, or shipped with the extra sources of the test plan.
+type localDependency struct {
+	// Module is the module (or package) being overridden.
+	Module string
+
+	// Dir is the directory holding the sources of the dependency. It is always
+	// under the base directory of the build, so that it's part of the docker
+	// build context.
+	Dir string
+
+	// Commit is the commit the sources are at, or "local" if the sources are
+	// not under version control.
+	Commit string
+}
+
+// resolveLocalDependencies makes the sources of every dependency resolved from
+// Git or from the extra sources available under the base directory of the
+// build. Git repositories are cloned under <base>/deps. Dependencies resolved
+// from a published version are left to the builder.
+//
+// Dependencies are returned sorted by module.
+func resolveLocalDependencies(ctx context.Context, in *api.BuildInput, ow *rpc.OutputWriter) ([]localDependency, error) {
+	mods := make([]string, 0, len(in.Dependencies))
+	for mod, dep := range in.Dependencies {
+		if dep.IsLocal() {
+			mods = append(mods, mod)
+		}
+	}
+	sort.Strings(mods)
+
+	ret := make([]localDependency, 0, len(mods))
+	for _, mod := range mods {
+		var (
+			dep = in.Dependencies[mod]
+			ld  = localDependency{Module: mod}
+			err error
+		)
+
+		switch {
+		case dep.Git != "":
+			ld.Dir = filepath.Join(in.UnpackedSources.BaseDir, "deps", sanitizeModule(mod))
+			ow.Infow("fetching dependency from git", "module", mod, "git", dep.Git, "ref", dep.Ref)
+			ld.Commit, err = cloneAtRef(ctx, dep.Git, dep.Ref, ld.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch dependency %s from %s: %w", mod, dep.Git, err)
+			}
+
+		case dep.Path != "":
+			if in.UnpackedSources.ExtraDir == "" {
+				return nil, fmt.Errorf("dependency %s points at path %s, but no extra sources were shipped", mod, dep.Path)
+			}
+			ld.Dir = filepath.Join(in.UnpackedSources.ExtraDir, filepath.Clean("/"+dep.Path))
+			if fi, err := os.Stat(ld.Dir); err != nil || !fi.IsDir() {
+				return nil, fmt.Errorf("dependency %s points at path %s, which is not a directory of the extra sources", mod, dep.Path)
+			}
+			ld.Commit = "local"
+			if repo, err := git.PlainOpenWithOptions(ld.Dir, &git.PlainOpenOptions{DetectDotGit: true}); err == nil {
+				if head, err := repo.Head(); err == nil {
+					ld.Commit = head.Hash().String()
+				}
+			}
+		}
+
+		ow.Infow("resolved dependency", "module", mod, "dir", ld.Dir, "commit", ld.Commit)
+		ret = append(ret, ld)
+	}
+	return ret, nil
+}
+
+// cloneAtRef clones the Git repository at url into dir, checks out ref (a
+// branch, tag or commit; HEAD if empty), and returns the commit checked out.
+// Any previous clone in dir, such as that of an earlier attempt at the same
+// build, possibly interrupted, is replaced.
+func cloneAtRef(ctx context.Context, url, ref, dir string) (string, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+
+	repo, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{URL: url})
+	if err != nil {
+		return "", err
+	}
+
+	if ref == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return "", err
+		}
+		return head.Hash().String(), nil
+	}
+
+	var hash *plumbing.Hash
+	for _, rev := range []string{ref, "refs/remotes/origin/" + ref, "refs/tags/" + ref} {
+		if hash, err = repo.ResolveRevision(plumbing.Revision(rev)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ref %s: %w", ref, err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+	return hash.String(), nil
+}
+
+// sanitizeModule turns a module path into a directory name.
+func sanitizeModule(mod string) string {
+	return strings.NewReplacer("/", "_", "@", "_", ":", "_").Replace(mod)
+}
+
+// relativeDir returns the path of dir relative to base, in the form expected
+// by go.mod replace directives and npm file specs, i.e. starting with ./ or
+// ../.
+func relativeDir(base, dir string) (string, error) {
+	rel, err := filepath.Rel(base, dir)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel, nil
+}
+
+// recordLocalDependencies records the commit of dependencies resolved from
+// sources in the dependency set of a build.
+func recordLocalDependencies(deps map[string]string, local []localDependency) map[string]string {
+	if len(local) == 0 {
+		return deps
+	}
+	if deps == nil {
+		deps = make(map[string]string, len(local))
+	}
+	for _, ld := range local {
+		deps[ld.Module] = ld.Commit
+	}
+	return deps
+}
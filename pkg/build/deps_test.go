@@ -0,0 +1,134 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// initRepo creates a Git repository in dir with one commit on the default
+// branch, and one on the "feature" branch. It returns the hashes of both.
+func initRepo(t *testing.T, dir string) (master, feature string) {
+	t.Helper()
+
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+
+	commit := func(content string) string {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(content), 0644))
+		_, err := wt.Add("go.mod")
+		require.NoError(t, err)
+		h, err := wt.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+		return h.String()
+	}
+
+	master = commit("module example.com/dep\n")
+	require.NoError(t, wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true}))
+	feature = commit("module example.com/dep\n\ngo 1.16\n")
+	return master, feature
+}
+
+func TestResolveLocalDependencies(t *testing.T) {
+	var (
+		base  = t.TempDir()
+		extra = filepath.Join(base, "extra")
+		repo  = t.TempDir()
+	)
+	master, feature := initRepo(t, repo)
+	require.NoError(t, os.MkdirAll(filepath.Join(extra, "forks", "lib"), 0755))
+
+	in := &api.BuildInput{
+		UnpackedSources: &api.UnpackedSources{BaseDir: base, PlanDir: filepath.Join(base, "plan"), ExtraDir: extra},
+		Dependencies: map[string]api.DependencyTarget{
+			"example.com/published": {Version: "v1.0.0"},
+			"example.com/feature":   {Git: repo, Ref: "feature"},
+			"example.com/pinned":    {Git: repo, Ref: master},
+			"example.com/lib":       {Path: "forks/lib"},
+		},
+	}
+
+	local, err := resolveLocalDependencies(context.Background(), in, rpc.NewFileOutputWriter(ioutil.Discard))
+	require.NoError(t, err)
+	require.Len(t, local, 3)
+
+	require.Equal(t, "example.com/feature", local[0].Module)
+	require.Equal(t, feature, local[0].Commit)
+	require.Equal(t, filepath.Join(base, "deps", "example.com_feature"), local[0].Dir)
+
+	require.Equal(t, "example.com/lib", local[1].Module)
+	require.Equal(t, "local", local[1].Commit)
+	require.Equal(t, filepath.Join(extra, "forks", "lib"), local[1].Dir)
+
+	require.Equal(t, "example.com/pinned", local[2].Module)
+	require.Equal(t, master, local[2].Commit)
+
+	rel, err := relativeDir(in.UnpackedSources.PlanDir, local[0].Dir)
+	require.NoError(t, err)
+	require.Equal(t, "../deps/example.com_feature", rel)
+
+	deps := recordLocalDependencies(map[string]string{"example.com/published": "v1.0.0"}, local)
+	require.Equal(t, feature, deps["example.com/feature"])
+	require.Equal(t, "v1.0.0", deps["example.com/published"])
+
+	// resolving again, as when retrying the build on the same sources,
+	// replaces the previous clones.
+	in.Dependencies["example.com/feature"] = api.DependencyTarget{Git: repo, Ref: master}
+	again, err := resolveLocalDependencies(context.Background(), in, rpc.NewFileOutputWriter(ioutil.Discard))
+	require.NoError(t, err)
+	require.Len(t, again, 3)
+	require.Equal(t, master, again[0].Commit)
+	require.Equal(t, local[0].Dir, again[0].Dir)
+
+	// paths can't escape the extra sources.
+	in.Dependencies = map[string]api.DependencyTarget{"example.com/lib": {Path: "../plan"}}
+	_, err = resolveLocalDependencies(context.Background(), in, rpc.NewFileOutputWriter(ioutil.Discard))
+	require.Error(t, err)
+}
+
+func TestWriteNpmOverrides(t *testing.T) {
+	base := t.TempDir()
+	plan := filepath.Join(base, "plan")
+	require.NoError(t, os.MkdirAll(plan, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(plan, "package.json"), []byte(`{"name": "plan", "overrides": {"foo": "1.0.0"}}`), 0644))
+
+	deps := map[string]api.DependencyTarget{
+		"bar": {Version: "2.0.0"},
+		"baz": {Target: "baz-fork", Version: "3.0.0"},
+		"qux": {Path: "qux"},
+	}
+	local := []localDependency{{Module: "qux", Dir: filepath.Join(base, "extra", "qux")}}
+	require.NoError(t, writeNpmOverrides(plan, deps, local))
+
+	data, err := ioutil.ReadFile(filepath.Join(plan, "package.json"))
+	require.NoError(t, err)
+
+	var pkg struct {
+		Name      string
+		Overrides map[string]string
+	}
+	require.NoError(t, json.Unmarshal(data, &pkg))
+	require.Equal(t, "plan", pkg.Name)
+	require.Equal(t, map[string]string{
+		"foo": "1.0.0",
+		"bar": "2.0.0",
+		"baz": "npm:baz-fork@3.0.0",
+		"qux": "file:../extra/qux",
+	}, pkg.Overrides)
+}
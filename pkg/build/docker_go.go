@@ -117,6 +117,7 @@ type DockerGoBuilderConfig struct {
 
 type DockerfileTemplateVars struct {
 	WithSDK              bool
+	LocalModules         []string
 	RuntimeImage         string
 	DockerfileExtensions DockerfileExtensions
 	SkipRuntimeImage     bool
@@ -153,6 +154,21 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 		ow.Warnf("warning while setting up the go proxy: %s", warn)
 	}
 
+	// Fetch dependencies resolved from sources. Their go.mod files are copied
+	// before downloading modules, like the SDK's.
+	local, err := resolveLocalDependencies(ctx, in, ow)
+	if err != nil {
+		return nil, err
+	}
+	localModules := make([]string, 0, len(local))
+	for _, ld := range local {
+		rel, err := filepath.Rel(baseSrc, ld.Dir)
+		if err != nil {
+			return nil, err
+		}
+		localModules = append(localModules, filepath.ToSlash(rel))
+	}
+
 	// Write the Dockerfile.
 	dockerfileDst := filepath.Join(baseSrc, "Dockerfile")
 	f, err := os.Create(dockerfileDst)
@@ -167,6 +183,7 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 
 	vars := &DockerfileTemplateVars{
 		WithSDK:              sdkSrc != "",
+		LocalModules:         localModules,
 		RuntimeImage:         cfg.RuntimeImage,
 		DockerfileExtensions: cfg.DockerfileExtensions,
 		SkipRuntimeImage:     cfg.SkipRuntimeImage,
@@ -222,11 +239,21 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 	// If we have version overrides, apply them.
 	var replaces []string
 	for mod, ver := range in.Dependencies {
+		if ver.IsLocal() {
+			continue
+		}
 		if ver.Target == "" {
 			ver.Target = mod
 		}
 		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", mod, ver.Target, ver.Version))
 	}
+	for _, ld := range local {
+		rel, err := relativeDir(planSrc, ld.Dir)
+		if err != nil {
+			return nil, err
+		}
+		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s", ld.Module, rel))
+	}
 
 	// Inject replace directives for the SDK modules.
 	if sdkSrc != "" {
@@ -343,7 +370,7 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 
 	out := &api.BuildOutput{
 		ArtifactPath: imageID,
-		Dependencies: deps,
+		Dependencies: recordLocalDependencies(deps, local),
 	}
 
 	// Testplan image tag
@@ -630,6 +657,10 @@ COPY /plan/${PLAN_PATH}/${MODFILE_SUM} ${PLAN_DIR}/go.sum
 COPY /sdk/go.mod /sdk/go.mod
 {{end}}
 
+{{range .LocalModules}}
+COPY /{{.}}/go.mod /{{.}}/go.mod
+{{end}}
+
 # Download deps.
 RUN echo "Using go proxy: ${GO_PROXY}" \
     && cd ${PLAN_DIR} \
@@ -2,6 +2,7 @@ package build
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -43,6 +44,21 @@ func (d DockerNodeBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rp
 		return nil, err
 	}
 
+	// Apply dependency overrides as npm overrides. npm ci refuses to install
+	// when package.json and the lockfile disagree, so fall back to npm
+	// install in that case.
+	local, err := resolveLocalDependencies(ctx, in, ow)
+	if err != nil {
+		return nil, err
+	}
+	npmCommand := "ci"
+	if len(in.Dependencies) > 0 {
+		if err := writeNpmOverrides(in.UnpackedSources.PlanDir, in.Dependencies, local); err != nil {
+			return nil, fmt.Errorf("failed to apply dependency overrides: %w", err)
+		}
+		npmCommand = "install"
+	}
+
 	// Write the Dockerfile.
 	dockerfileDst := filepath.Join(basesrc, "Dockerfile")
 	err = ioutil.WriteFile(dockerfileDst, []byte(NodeDockerfileTemplate), 0644)
@@ -57,7 +73,8 @@ func (d DockerNodeBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rp
 
 	// build args
 	var args = map[string]*string{
-		"BASE_IMAGE": &cfg.BaseImage,
+		"BASE_IMAGE":  &cfg.BaseImage,
+		"NPM_COMMAND": &npmCommand,
 	}
 
 	opts := types.ImageBuildOptions{
@@ -87,8 +104,19 @@ func (d DockerNodeBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rp
 
 	ow.Infow("got docker image id", "image_id", imageID)
 
+	var deps map[string]string
+	for mod, dep := range in.Dependencies {
+		if !dep.IsLocal() {
+			if deps == nil {
+				deps = make(map[string]string, len(in.Dependencies))
+			}
+			deps[mod] = dep.Version
+		}
+	}
+
 	out := &api.BuildOutput{
 		ArtifactPath: imageID,
+		Dependencies: recordLocalDependencies(deps, local),
 	}
 
 	// Testplan image tag
@@ -115,13 +143,58 @@ type DockerNodeBuilderConfig struct {
 	BaseImage string `toml:"base_image"`
 }
 
+// writeNpmOverrides adds the dependency overrides to the overrides of the
+// package.json in planDir. Published versions are pinned, aliasing the target
+// package if any; dependencies resolved from sources point at their directory.
+func writeNpmOverrides(planDir string, deps map[string]api.DependencyTarget, local []localDependency) error {
+	file := filepath.Join(planDir, "package.json")
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var pkg map[string]interface{}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	overrides, _ := pkg["overrides"].(map[string]interface{})
+	if overrides == nil {
+		overrides = make(map[string]interface{}, len(deps))
+	}
+	for mod, dep := range deps {
+		switch {
+		case dep.IsLocal():
+			continue
+		case dep.Target != "":
+			overrides[mod] = fmt.Sprintf("npm:%s@%s", dep.Target, dep.Version)
+		default:
+			overrides[mod] = dep.Version
+		}
+	}
+	for _, ld := range local {
+		rel, err := relativeDir(planDir, ld.Dir)
+		if err != nil {
+			return err
+		}
+		overrides[ld.Module] = "file:" + rel
+	}
+	pkg["overrides"] = overrides
+
+	if data, err = json.MarshalIndent(pkg, "", "  "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
 const NodeDockerfileTemplate = `
 ARG BASE_IMAGE
 FROM ${BASE_IMAGE} AS builder
+ARG NPM_COMMAND=ci
 ENV PLAN_DIR /plan
 WORKDIR /plan
 COPY . /
-RUN npm ci
+RUN npm ${NPM_COMMAND}
 EXPOSE 6060
 ENTRYPOINT [ "npm", "start"]
 `
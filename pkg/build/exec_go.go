@@ -63,11 +63,27 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 		}
 	}
 
+	// Fetch dependencies resolved from sources.
+	local, err := resolveLocalDependencies(ctx, in, ow)
+	if err != nil {
+		return nil, err
+	}
+
 	// If we have version overrides, apply them.
 	var replaces []string
 	for mod, ver := range in.Dependencies {
+		if ver.IsLocal() {
+			continue
+		}
 		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", mod, ver.Target, ver.Version))
 	}
+	for _, ld := range local {
+		rel, err := relativeDir(plansrc, ld.Dir)
+		if err != nil {
+			return nil, err
+		}
+		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s", ld.Module, rel))
+	}
 
 	if sdksrc != "" {
 		// Inject replace directives for the SDK modules.
@@ -111,7 +127,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 
 	return &api.BuildOutput{
 		ArtifactPath: path,
-		Dependencies: parseDependencies(string(out)),
+		Dependencies: recordLocalDependencies(parseDependencies(string(out)), local),
 	}, nil
 }
 
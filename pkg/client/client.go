@@ -68,6 +68,43 @@ func (c *Client) Run(ctx context.Context, r *api.RunRequest, plandir string, sdk
 	return c.runBuild(ctx, r, "/run", plandir, sdkdir, extraSrcs)
 }
 
+// Schedule sends a `schedule` request to the daemon, registering the run
+// request to be queued on a cron expression. The sources are submitted like
+// for a `run` request, and kept by the daemon for every execution.
+//
+// The Body in the response implements an io.ReadCloser and it's up to the
+// caller to close it.
+func (c *Client) Schedule(ctx context.Context, r *api.ScheduleRequest, plandir string, sdkdir string, extraSrcs []string) (io.ReadCloser, error) {
+	return c.runBuild(ctx, r, "/schedules", plandir, sdkdir, extraSrcs)
+}
+
+// ListSchedules sends a `schedule list` request to the daemon.
+func (c *Client) ListSchedules(ctx context.Context) (io.ReadCloser, error) {
+	return c.request(ctx, "POST", "/schedules/list", nil)
+}
+
+// DeleteSchedule sends a `schedule delete` request to the daemon.
+func (c *Client) DeleteSchedule(ctx context.Context, r *api.ScheduleDeleteRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/schedules/delete", bytes.NewReader(body.Bytes()))
+}
+
+// GC sends a `gc` request to the daemon.
+func (c *Client) GC(ctx context.Context, r *api.GCRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/gc", bytes.NewReader(body.Bytes()))
+}
+
 // runBuild sends a multipart request to the daemon on a certain path.
 //
 // A build (or run) request comprises the following parts:
@@ -278,6 +315,44 @@ func (c *Client) Tasks(ctx context.Context, r *api.TasksRequest) (io.ReadCloser,
 	return c.request(ctx, "POST", "/tasks", bytes.NewReader(body.Bytes()))
 }
 
+func (c *Client) Branches(ctx context.Context, r *api.BranchesRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/tasks/branches", bytes.NewReader(body.Bytes()))
+}
+
+func (c *Client) LastGreen(ctx context.Context, r *api.LastGreenRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/tasks/last-green", bytes.NewReader(body.Bytes()))
+}
+
+// ExportTasks sends a `tasks export` request to the daemon. The bundle is
+// streamed back in binary chunks; see ParseExportTasksResponse.
+func (c *Client) ExportTasks(ctx context.Context, r *api.ExportRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/tasks/export", bytes.NewReader(body.Bytes()))
+}
+
+// ImportTasks sends a `tasks import` request to the daemon, uploading the
+// bundle read from r.
+func (c *Client) ImportTasks(ctx context.Context, bundle io.Reader) (io.ReadCloser, error) {
+	return c.request(ctx, "POST", "/tasks/import", bundle, "Content-Type", "application/x-tar")
+}
+
 func (c *Client) Status(ctx context.Context, r *api.StatusRequest) (io.ReadCloser, error) {
 	var body bytes.Buffer
 	err := json.NewEncoder(&body).Encode(r)
@@ -432,6 +507,94 @@ func ParseBuildResponse(r io.ReadCloser) (string, error) {
 	return resp, err
 }
 
+// ParseScheduleResponse parses a response from a `schedule` call
+func ParseScheduleResponse(r io.ReadCloser) (string, error) {
+	var resp string
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		func(result interface{}) error {
+			var ok bool
+			resp, ok = result.(string)
+			if !ok {
+				return errors.New("result should be string")
+			}
+			return nil
+		},
+	)
+	return resp, err
+}
+
+// ParseSchedulesResponse parses a response from a `schedule list` call
+func ParseSchedulesResponse(r io.ReadCloser) (api.SchedulesResponse, error) {
+	var resp api.SchedulesResponse
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParseDeleteScheduleResponse parses a response from a `schedule delete` call
+func ParseDeleteScheduleResponse(r io.ReadCloser) error {
+	return parseGeneric(
+		r,
+		printProgress,
+		nil,
+		func(result interface{}) error {
+			return nil
+		},
+	)
+}
+
+// ParseGCResponse parses a response from a `gc` call
+func ParseGCResponse(r io.ReadCloser) (*api.GCReport, error) {
+	var resp api.GCReport
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return &resp, err
+}
+
+// ParseExportTasksResponse parses a response from a `tasks export` call,
+// writing the bundle to file.
+func ParseExportTasksResponse(r io.ReadCloser, file io.Writer) (*api.ExportReport, error) {
+	var resp api.ExportReport
+	err := parseGeneric(
+		r,
+		printProgress,
+		func(payload interface{}) error {
+			m, err := base64.StdEncoding.DecodeString(payload.(string))
+			if err != nil {
+				return err
+			}
+
+			_, err = file.Write(m)
+			return err
+		},
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return &resp, err
+}
+
+// ParseImportTasksResponse parses a response from a `tasks import` call
+func ParseImportTasksResponse(r io.ReadCloser) (*api.ImportReport, error) {
+	var resp api.ImportReport
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return &resp, err
+}
+
 // ParseBuildPurgeResponse parses a response from 'build/purge' call.
 func ParseBuildPurgeResponse(r io.ReadCloser) error {
 	return parseGeneric(
@@ -482,6 +645,30 @@ func ParseTasksRequest(r io.ReadCloser) ([]*task.Task, error) {
 	return resp, err
 }
 
+// ParseBranchesResponse parses a response from a 'tasks branches' call
+func ParseBranchesResponse(r io.ReadCloser) ([]task.BranchRuns, error) {
+	var resp []task.BranchRuns
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParseLastGreenResponse parses a response from a 'tasks last-green' call
+func ParseLastGreenResponse(r io.ReadCloser) (*task.Task, error) {
+	var resp *task.Task
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
 // ParseStatusResponse parses a response from a 'status' call
 func ParseStatusResponse(r io.ReadCloser) (api.StatusResponse, error) {
 	var resp api.StatusResponse
@@ -38,6 +38,10 @@ var BuildCommand = cli.Command{
 					Usage:    "path to a `COMPOSITION`",
 					Required: true,
 				},
+				&cli.StringSliceFlag{
+					Name:  "overlay",
+					Usage: "path to a composition `OVERLAY` merged on top of the composition; can be repeated, applied in order",
+				},
 				&cli.BoolFlag{
 					Name:    "write-artifacts",
 					Aliases: []string{"w"},
@@ -51,6 +55,14 @@ var BuildCommand = cli.Command{
 					Name:  "wait",
 					Usage: "wait for the task to complete",
 				},
+				&cli.StringSliceFlag{
+					Name:  "depends-on",
+					Usage: "`TASK_ID` of a task that must complete successfully before this one is scheduled; can be repeated",
+				},
+				&cli.BoolFlag{
+					Name:  "preemptible",
+					Usage: "allow the task to be interrupted and scheduled again in favour of higher priority tasks",
+				},
 			},
 		},
 		&cli.Command{
@@ -64,15 +76,15 @@ var BuildCommand = cli.Command{
 					Usage: "set a build config parameter",
 				},
 				&cli.StringFlag{
-					Name:     "builder",
-					Aliases:  []string{"b"},
-					Usage:    "specifies the builder to use; values include: 'docker:go', 'exec:go'",
-					Required: true,
+					Name:        "builder",
+					Aliases:     []string{"b"},
+					Usage:       "specifies the builder to use; values include: 'docker:go', 'exec:go'",
+					DefaultText: "the plan's default builder",
 				},
 				&cli.StringSliceFlag{
 					Name:    "dep",
 					Aliases: []string{"d"},
-					Usage:   "set a dependency mapping",
+					Usage:   "set a dependency mapping, as `MODULE=SOURCE`; the source is one of target@version, git+URL[#ref] or path:DIR (relative to the extra sources)",
 				},
 				&cli.StringFlag{
 					Name:  "link-sdk",
@@ -88,6 +100,14 @@ var BuildCommand = cli.Command{
 					Name:  "wait",
 					Usage: "Wait for the task to complete",
 				},
+				&cli.StringSliceFlag{
+					Name:  "depends-on",
+					Usage: "`TASK_ID` of a task that must complete successfully before this one is scheduled; can be repeated",
+				},
+				&cli.BoolFlag{
+					Name:  "preemptible",
+					Usage: "allow the task to be interrupted and scheduled again in favour of higher priority tasks",
+				},
 			},
 		},
 		&cli.Command{
@@ -119,12 +139,27 @@ func buildCompositionCmd(c *cli.Context) (err error) {
 		return fmt.Errorf("no composition file supplied")
 	}
 
-	comp, err := loadComposition(file)
+	overlays := c.StringSlice("overlay")
+	if c.Bool("write-artifacts") && isDerivedComposition(file, overlays) {
+		return fmt.Errorf("cannot write artifacts to a composition that uses extends or overlays")
+	}
+
+	comps, err := loadComposition(file, overlays...)
 
 	if err != nil {
 		return fmt.Errorf("failed to load composition file: %w", err)
 	}
 
+	// A matrix only sweeps over test parameters, so every point of the matrix
+	// results in the same build; we build the first one.
+	comp := comps[0]
+	if len(comps) > 1 {
+		if c.Bool("write-artifacts") {
+			return fmt.Errorf("cannot write artifacts to a composition with a matrix")
+		}
+		logging.S().Infof("composition expands to %d matrix points; building once for all of them", len(comps))
+	}
+
 	if err = comp.ValidateForBuild(); err != nil {
 		return fmt.Errorf("invalid composition file: %w", err)
 	}
@@ -212,6 +247,8 @@ func doBuild(c *cli.Context, comp *api.Composition) error {
 		CreatedBy: api.CreatedBy{
 			User: cfg.Client.User,
 		},
+		DependsOn:   c.StringSlice("depends-on"),
+		Preemptible: c.Bool("preemptible"),
 	}
 
 	if wait {
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/task"
+
+	"github.com/urfave/cli/v2"
+)
+
+// TasksExportCommand is the specification of the `tasks export` command.
+var TasksExportCommand = cli.Command{
+	Name:   "export",
+	Usage:  "export complete tasks, with their logs, to a bundle that can be imported into another daemon",
+	Action: tasksExportCommand,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "write the bundle to `FILE`",
+			Value:   "tasks.tar",
+		},
+		&cli.BoolFlag{
+			Name:  "outputs",
+			Usage: "include the outputs of the runs collected on the daemon host",
+		},
+		&cli.StringSliceFlag{
+			Name:  "type",
+			Usage: "only export tasks of this `TYPE` (build, run); can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "plan",
+			Usage: "only export tasks of this test `PLAN`",
+		},
+		&cli.StringFlag{
+			Name:  "case",
+			Usage: "only export tasks of this test `CASE`",
+		},
+		&cli.StringFlag{
+			Name:  "runner",
+			Usage: "only export tasks run by this `RUNNER`",
+		},
+		&cli.StringFlag{
+			Name:  "outcome",
+			Usage: "only export tasks with this `OUTCOME` (success, failure, canceled, timeout, unknown)",
+		},
+		&cli.StringFlag{
+			Name:  "repo",
+			Usage: "only export tasks created from this `REPO`",
+		},
+		&cli.StringFlag{
+			Name:  "branch",
+			Usage: "only export tasks created from this `BRANCH`",
+		},
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "only export tasks created by this `USER`",
+		},
+		&cli.StringFlag{
+			Name:  "after",
+			Usage: "only export tasks created at or after `TIME`; an RFC3339 timestamp, or a duration ago such as 24h",
+		},
+		&cli.StringFlag{
+			Name:  "before",
+			Usage: "only export tasks created before `TIME`; an RFC3339 timestamp, or a duration ago such as 24h",
+		},
+	},
+}
+
+// TasksImportCommand is the specification of the `tasks import` command.
+var TasksImportCommand = cli.Command{
+	Name:      "import",
+	Usage:     "import the tasks of a bundle written by `tasks export`, skipping those already stored",
+	ArgsUsage: "BUNDLE",
+	Action:    tasksImportCommand,
+}
+
+func tasksExportCommand(c *cli.Context) (err error) {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	req := &api.ExportRequest{
+		Filters: api.TasksFilters{
+			TestPlan: c.String("plan"),
+			TestCase: c.String("case"),
+			Runner:   c.String("runner"),
+			Outcome:  task.Outcome(c.String("outcome")),
+			Repo:     c.String("repo"),
+			Branch:   c.String("branch"),
+			User:     c.String("user"),
+		},
+		Outputs: c.Bool("outputs"),
+	}
+	for _, tp := range c.StringSlice("type") {
+		req.Filters.Types = append(req.Filters.Types, task.Type(tp))
+	}
+	if req.Filters.Since, err = parseTimeFlag(c, "after"); err != nil {
+		return err
+	}
+	if req.Filters.Until, err = parseTimeFlag(c, "before"); err != nil {
+		return err
+	}
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.ExportTasks(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	path := c.String("output")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	report, err := client.ParseExportTasksResponse(r, f)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("exported %d tasks, %d logs and %d output files to %s\n", len(report.Tasks), report.Logs, report.Outputs, path)
+	return nil
+}
+
+func tasksImportCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		return errors.New("missing bundle to import")
+	}
+
+	f, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.ImportTasks(ctx, f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	report, err := client.ParseImportTasksResponse(r)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range report.Skipped {
+		fmt.Printf("skipped %s: already stored\n", id)
+	}
+	fmt.Printf("imported %d tasks, %d logs and %d output files; skipped %d tasks\n", len(report.Imported), report.Logs, report.Outputs, len(report.Skipped))
+	return nil
+}
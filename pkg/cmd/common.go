@@ -103,22 +103,25 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	comp.Groups[0].Build.Dependencies = make([]api.Dependency, 0, len(dependencies))
 
 	for name, target := range deps {
-		parts := strings.Split(target, "@")
-		if (len(parts)) != 2 {
-			return nil, fmt.Errorf("invalid target-version: %s", target)
+		dep, err := parseDependency(name, target)
+		if err != nil {
+			return nil, err
 		}
+		comp.Groups[0].Build.Dependencies = append(comp.Groups[0].Build.Dependencies, dep)
+	}
 
-		dep := api.Dependency{
-			Module:  name,
-			Target:  parts[0],
-			Version: parts[1],
-		}
+	cmd := strings.Fields(c.Command.FullName())[0]
 
-		comp.Groups[0].Build.Dependencies = append(comp.Groups[0].Build.Dependencies, dep)
+	// Fall back to the defaults declared in the test plan manifest for
+	// anything not supplied on the command line.
+	if builder == "" || (cmd == "run" && (runner == "" || instances == 0)) {
+		if err := applyManifestDefaults(comp, cmd == "run"); err != nil {
+			return nil, err
+		}
 	}
 
 	// Validate the composition before returning it.
-	switch c := strings.Fields(c.Command.FullName()); c[0] {
+	switch cmd {
 	case "build":
 		err = comp.ValidateForBuild()
 	case "run":
@@ -130,6 +133,70 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	return comp, err
 }
 
+// parseDependency parses the source of a dependency override supplied on the
+// command line, in one of these forms:
+//
+//	target@version      a published version of the target module.
+//	git+URL[#ref]       a Git repository, at a branch, tag or commit.
+//	path:DIR            a directory of the plan's extra sources.
+func parseDependency(module, spec string) (api.Dependency, error) {
+	if strings.HasPrefix(spec, "git+") || strings.HasPrefix(spec, "path:") {
+		return api.ParseDependency(module, spec)
+	}
+	parts := strings.Split(spec, "@")
+	if (len(parts)) != 2 {
+		return api.Dependency{Module: module}, fmt.Errorf("invalid target-version: %s", spec)
+	}
+	dep := api.Dependency{Module: module, Target: parts[0], Version: parts[1]}
+	return dep, dep.Validate()
+}
+
+// applyManifestDefaults fills in the builder of a singleton composition and,
+// if it's going to be run, its runner and instance count, with the defaults
+// declared in the manifest of its test plan, when they are not set.
+func applyManifestDefaults(comp *api.Composition, run bool) error {
+	cfg := &config.EnvConfig{}
+	if err := cfg.Load(); err != nil {
+		return err
+	}
+	_, manifest, err := resolveTestPlan(cfg, comp.Global.Plan)
+	if err != nil {
+		return fmt.Errorf("failed to resolve test plan: %w", err)
+	}
+
+	if comp.Global.Builder == "" {
+		if comp.Global.Builder = manifest.Defaults.Builder; comp.Global.Builder == "" {
+			return fmt.Errorf("no builder specified, and plan %s declares no default builder", manifest.Name)
+		}
+	}
+
+	if !run {
+		return nil
+	}
+
+	if comp.Global.Runner == "" {
+		if comp.Global.Runner = manifest.Defaults.Runner; comp.Global.Runner == "" {
+			return fmt.Errorf("no runner specified, and plan %s declares no default runner", manifest.Name)
+		}
+	}
+
+	if comp.Global.TotalInstances == 0 {
+		_, tcase, ok := manifest.TestCaseByName(comp.Global.Case)
+		if !ok {
+			return fmt.Errorf("test case %s not found in plan %s", comp.Global.Case, manifest.Name)
+		}
+		n := uint(tcase.Instances.Default)
+		if n == 0 {
+			return fmt.Errorf("no instance count specified, and test case %s declares no default instance count", tcase.Name)
+		}
+		comp.Global.TotalInstances = n
+		for _, g := range comp.Groups {
+			g.Instances.Count = n
+		}
+	}
+	return nil
+}
+
 // resolveTestPlan resolves a test plan, returning its root directory and its
 // parsed manifest.
 func resolveTestPlan(cfg *config.EnvConfig, name string) (string, *api.TestPlanManifest, error) {
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+const defaultsTestManifest = `
+name = "bar_plan"
+
+[defaults]
+builder = "exec:go"
+runner = "local:exec"
+
+[builders."exec:go"]
+enabled = true
+
+[runners."local:exec"]
+enabled = true
+
+[[testcases]]
+name = "bar_case"
+instances = { min = 1, max = 10, default = 3 }
+`
+
+func TestApplyManifestDefaults(t *testing.T) {
+	cfg := setupCompositionTestEnv(t)
+
+	dir := filepath.Join(cfg.Dirs().Plans(), "bar_plan")
+	require.NoError(t, os.MkdirAll(dir, 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "manifest.toml"), []byte(defaultsTestManifest), 0644))
+
+	singleton := func(plan, tcase string) *api.Composition {
+		return &api.Composition{
+			Global: api.Global{Plan: plan, Case: tcase},
+			Groups: []*api.Group{{ID: "single"}},
+		}
+	}
+
+	comp := singleton("bar_plan", "bar_case")
+	require.NoError(t, applyManifestDefaults(comp, true))
+	require.Equal(t, "exec:go", comp.Global.Builder)
+	require.Equal(t, "local:exec", comp.Global.Runner)
+	require.EqualValues(t, 3, comp.Global.TotalInstances)
+	require.EqualValues(t, 3, comp.Groups[0].Instances.Count)
+	require.NoError(t, comp.ValidateForRun())
+
+	// Values supplied on the command line take precedence.
+	comp = singleton("bar_plan", "bar_case")
+	comp.Global.Runner = "local:docker"
+	comp.Global.TotalInstances = 5
+	comp.Groups[0].Instances.Count = 5
+	require.NoError(t, applyManifestDefaults(comp, true))
+	require.Equal(t, "local:docker", comp.Global.Runner)
+	require.EqualValues(t, 5, comp.Global.TotalInstances)
+
+	// Builds don't need a runner nor an instance count.
+	comp = singleton("bar_plan", "bar_case")
+	require.NoError(t, applyManifestDefaults(comp, false))
+	require.Equal(t, "exec:go", comp.Global.Builder)
+	require.Empty(t, comp.Global.Runner)
+
+	// foo_plan declares no defaults.
+	err := applyManifestDefaults(singleton("foo_plan", "foo_case"), true)
+	require.EqualError(t, err, "no builder specified, and plan foo_plan declares no default builder")
+}
+
+func TestParseDependency(t *testing.T) {
+	dep, err := parseDependency("example.com/mod", "example.com/fork@v1.2.3")
+	require.NoError(t, err)
+	require.Equal(t, api.Dependency{Module: "example.com/mod", Target: "example.com/fork", Version: "v1.2.3"}, dep)
+
+	dep, err = parseDependency("example.com/mod", "git+https://example.com/fork.git#feature")
+	require.NoError(t, err)
+	require.Equal(t, api.Dependency{Module: "example.com/mod", Git: "https://example.com/fork.git", Ref: "feature"}, dep)
+
+	dep, err = parseDependency("example.com/mod", "git+git@example.com:fork.git")
+	require.NoError(t, err)
+	require.Equal(t, api.Dependency{Module: "example.com/mod", Git: "git@example.com:fork.git"}, dep)
+
+	dep, err = parseDependency("example.com/mod", "path:forks/mod")
+	require.NoError(t, err)
+	require.Equal(t, api.Dependency{Module: "example.com/mod", Path: "forks/mod"}, dep)
+
+	_, err = parseDependency("example.com/mod", "v1.2.3")
+	require.Error(t, err)
+
+	_, err = parseDependency("example.com/mod", "path:")
+	require.Error(t, err)
+}
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-playground/validator/v10"
+	"github.com/hashicorp/go-multierror"
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+var compositionFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "file",
+		Aliases:  []string{"f"},
+		Usage:    "path to a `COMPOSITION`",
+		Required: true,
+	},
+	&cli.StringSliceFlag{
+		Name:  "overlay",
+		Usage: "path to a composition `OVERLAY` merged on top of the composition; can be repeated, applied in order",
+	},
+}
+
+// CompositionCommand is the specification of the `composition` command.
+var CompositionCommand = cli.Command{
+	Name:  "composition",
+	Usage: "inspect compositions offline, without contacting the daemon",
+	Subcommands: cli.Commands{
+		&cli.Command{
+			Name:   "validate",
+			Usage:  "validate a composition against the manifest of its test plan, reporting every error",
+			Action: validateCompositionCmd,
+			Flags:  compositionFlags,
+		},
+		&cli.Command{
+			Name:   "render",
+			Usage:  "print a composition as the daemon would resolve it, with all defaults applied",
+			Action: renderCompositionCmd,
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "output `FORMAT`; values include: 'toml', 'json'",
+					Value: "toml",
+				},
+			}, compositionFlags...),
+		},
+	},
+}
+
+func validateCompositionCmd(c *cli.Context) error {
+	comps, errs, err := loadAndResolveCompositions(c)
+	if err != nil {
+		return err
+	}
+
+	var invalid int
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		invalid++
+		if len(comps) > 1 {
+			fmt.Printf("matrix point %d/%d (%s):\n", i+1, len(comps), formatCoordinates(comps[i].Metadata.Coordinates))
+		}
+		for _, e := range flattenErrors(err) {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("composition is invalid")
+	}
+
+	fmt.Println("composition is valid")
+	return nil
+}
+
+func renderCompositionCmd(c *cli.Context) error {
+	format := c.String("format")
+	if format != "toml" && format != "json" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	comps, errs, err := loadAndResolveCompositions(c)
+	if err != nil {
+		return err
+	}
+
+	var merr *multierror.Error
+	for _, err := range errs {
+		if err != nil {
+			merr = multierror.Append(merr, flattenErrors(err)...)
+		}
+	}
+	if err := merr.ErrorOrNil(); err != nil {
+		return fmt.Errorf("failed to resolve composition: %w", err)
+	}
+
+	return renderCompositions(os.Stdout, format, comps)
+}
+
+// loadAndResolveCompositions loads the composition referenced by the command
+// line, expands its matrix, and resolves every resulting composition against
+// the manifest of its test plan. It returns the resolved compositions along
+// with the validation error of each of them, if any. The returned error is
+// only set if the composition could not be loaded at all.
+func loadAndResolveCompositions(c *cli.Context) ([]*api.Composition, []error, error) {
+	cfg := &config.EnvConfig{}
+	if err := cfg.Load(); err != nil {
+		return nil, nil, err
+	}
+
+	comps, err := loadComposition(c.String("file"), c.StringSlice("overlay")...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load composition file: %w", err)
+	}
+
+	errs := make([]error, len(comps))
+	for i, comp := range comps {
+		if resolved, err := resolveComposition(cfg, comp); err != nil {
+			errs[i] = err
+		} else {
+			comps[i] = resolved
+		}
+	}
+	return comps, errs, nil
+}
+
+// resolveComposition runs the composition through the same preparation and
+// validation steps that the daemon applies when building and running it, and
+// returns the resolved composition. It stops at the first error of the steps
+// the others depend on (run validation, test plan resolution, build
+// preparation); the errors of the build validation and of the run preparation
+// of each stage are reported at once.
+func resolveComposition(cfg *config.EnvConfig, comp *api.Composition) (*api.Composition, error) {
+	// Client-side validation, as performed by `run composition`. This also
+	// calculates the instance counts of each group.
+	if err := comp.ValidateForRun(); err != nil {
+		return nil, err
+	}
+
+	_, manifest, err := resolveTestPlan(cfg, comp.Global.Plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve test plan: %w", err)
+	}
+
+	var merr *multierror.Error
+
+	bcomp, err := comp.PrepareForBuild(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := bcomp.ValidateForBuild(); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+
+	// Pipelines are resolved stage by stage, as the daemon runs them; the
+	// composition is rendered with its stages.
+	if len(bcomp.Stages) > 0 {
+		for i, stage := range bcomp.Stages {
+			scomp, err := bcomp.ForStage(i)
+			if err == nil {
+				_, err = resolveRunComposition(scomp, manifest)
+			}
+			if err == nil {
+				continue
+			}
+			for _, err := range flattenErrors(err) {
+				merr = multierror.Append(merr, fmt.Errorf("stage %d (%s): %w", i+1, stage.Case, err))
+			}
+		}
+		return bcomp, merr.ErrorOrNil()
+	}
+
+	rcomp, err := resolveRunComposition(bcomp, manifest)
+	if err != nil {
+		merr = multierror.Append(merr, err)
+		return nil, merr
+	}
+	return rcomp, merr.ErrorOrNil()
+}
+
+// resolveRunComposition applies the run preparation and validation steps to a
+// composition prepared for build.
+func resolveRunComposition(bcomp *api.Composition, manifest *api.TestPlanManifest) (*api.Composition, error) {
+	rcomp, err := bcomp.PrepareForRun(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return rcomp, rcomp.ValidateForRun()
+}
+
+// renderCompositions writes the compositions to w in the given format. When
+// there is more than one composition, they are the points of a matrix: TOML
+// output separates them with a comment, JSON output is an array.
+func renderCompositions(w io.Writer, format string, comps []*api.Composition) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if len(comps) == 1 {
+			return enc.Encode(comps[0])
+		}
+		return enc.Encode(comps)
+	}
+
+	for i, comp := range comps {
+		if len(comps) > 1 {
+			if i > 0 {
+				_, _ = fmt.Fprintln(w)
+			}
+			_, _ = fmt.Fprintf(w, "# matrix point %d/%d (%s)\n", i+1, len(comps), formatCoordinates(comp.Metadata.Coordinates))
+		}
+		if err := toml.NewEncoder(w).Encode(comp); err != nil {
+			return fmt.Errorf("failed to encode composition: %w", err)
+		}
+	}
+	return nil
+}
+
+// flattenErrors unwraps multierrors and struct validation errors into a flat
+// list of individual errors.
+func flattenErrors(err error) []error {
+	var (
+		merr *multierror.Error
+		verr validator.ValidationErrors
+	)
+	switch {
+	case errors.As(err, &merr):
+		var ret []error
+		for _, e := range merr.Errors {
+			ret = append(ret, flattenErrors(e)...)
+		}
+		return ret
+	case errors.As(err, &verr):
+		ret := make([]error, 0, len(verr))
+		for _, e := range verr {
+			ret = append(ret, e)
+		}
+		return ret
+	default:
+		return []error{err}
+	}
+}
+
+// formatCoordinates formats the coordinates of a matrix point as a sorted,
+// comma-separated list of key=value pairs.
+func formatCoordinates(coords map[string]string) string {
+	keys := make([]string, 0, len(coords))
+	for k := range coords {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+coords[k])
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+const compositionTestManifest = `
+name = "foo_plan"
+
+[builders."docker:go"]
+enabled = true
+
+[runners."local:docker"]
+enabled = true
+
+[[testcases]]
+name = "foo_case"
+instances = { min = 1, max = 10 }
+
+  [testcases.params]
+  conn_count = { type = "int", default = 5 }
+  data_size_kb = { type = "int", default = 128 }
+`
+
+func setupCompositionTestEnv(t *testing.T) *config.EnvConfig {
+	t.Helper()
+
+	home := t.TempDir()
+	prev, ok := os.LookupEnv(config.EnvTestgroundHomeDir)
+	_ = os.Setenv(config.EnvTestgroundHomeDir, home)
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(config.EnvTestgroundHomeDir, prev)
+		} else {
+			_ = os.Unsetenv(config.EnvTestgroundHomeDir)
+		}
+	})
+
+	cfg := &config.EnvConfig{}
+	require.NoError(t, cfg.Load())
+
+	dir := filepath.Join(cfg.Dirs().Plans(), "foo_plan")
+	require.NoError(t, os.MkdirAll(dir, 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "manifest.toml"), []byte(compositionTestManifest), 0644))
+	return cfg
+}
+
+func testComposition(params map[string]string) *api.Composition {
+	return &api.Composition{
+		Global: api.Global{
+			Plan:    "foo_plan",
+			Case:    "foo_case",
+			Builder: "docker:go",
+			Runner:  "local:docker",
+		},
+		Groups: []*api.Group{
+			{
+				ID:        "single",
+				Instances: api.Instances{Count: 2},
+				Run:       api.Run{TestParams: params},
+			},
+		},
+	}
+}
+
+func TestResolveCompositionAppliesDefaults(t *testing.T) {
+	cfg := setupCompositionTestEnv(t)
+
+	comp, err := resolveComposition(cfg, testComposition(map[string]string{"conn_count": "10"}))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, comp.Global.TotalInstances)
+	require.Equal(t, "10", comp.Groups[0].Run.TestParams["conn_count"])
+	require.Equal(t, "128", comp.Groups[0].Run.TestParams["data_size_kb"])
+}
+
+func TestResolveCompositionReportsAllErrors(t *testing.T) {
+	cfg := setupCompositionTestEnv(t)
+
+	_, err := resolveComposition(cfg, testComposition(map[string]string{
+		"conn_cout":    "10",
+		"data_size_kb": "abc",
+	}))
+	require.Error(t, err)
+	require.Len(t, flattenErrors(err), 2)
+}
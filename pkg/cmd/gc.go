@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+
+	"github.com/urfave/cli/v2"
+)
+
+// GCCommand is the specification of the `gc` command.
+var GCCommand = cli.Command{
+	Name:   "gc",
+	Usage:  "report the complete tasks to delete per the retention policy of the daemon, along with their logs, outputs and sources, and how much disk it would free",
+	Action: gcCommand,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "apply",
+			Usage: "delete what is reported, rather than only reporting it",
+		},
+	},
+}
+
+func gcCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.GC(ctx, &api.GCRequest{Apply: c.Bool("apply")})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	report, err := client.ParseGCResponse(r)
+	if err != nil {
+		return err
+	}
+
+	verb := "deleted"
+	if report.DryRun {
+		verb = "would delete"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	if len(report.Tasks) > 0 {
+		fmt.Fprintln(w, "TASK\tTEST PLAN\tTEST CASE\tCOMPLETED\tREASON")
+		for _, t := range report.Tasks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Plan, t.Case, t.Completed.Local().Format(time.RFC3339), t.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(report.Paths) > 0 {
+		fmt.Fprintln(w, "PATH\tSIZE\tREASON")
+		for _, p := range report.Paths {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.Path, humanize.Bytes(uint64(p.Bytes)), p.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "%s %d tasks and %d paths, freeing %s\n", verb, len(report.Tasks), len(report.Paths), humanize.Bytes(uint64(report.Bytes)))
+	if report.DryRun {
+		fmt.Fprintln(w, "run with --apply to delete them")
+	}
+
+	return w.Flush()
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/engine"
 	"github.com/testground/testground/pkg/logging"
 
 	ttmpl "github.com/testground/plan-templates/templates"
@@ -98,6 +99,19 @@ var PlanCommand = cli.Command{
 			},
 			Action: rmCommand,
 		},
+		&cli.Command{
+			Name:  "lint",
+			Usage: "validate the manifest of a test plan, reporting every problem",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "plan",
+					Aliases:  []string{"p"},
+					Usage:    "specifies the `NAME` of the plan to lint",
+					Required: true,
+				},
+			},
+			Action: lintCommand,
+		},
 		&cli.Command{
 			Name:   "list",
 			Usage:  "enumerate all test plans or test cases known to the client",
@@ -292,6 +306,87 @@ func rmCommand(c *cli.Context) error {
 	return nil
 }
 
+func lintCommand(c *cli.Context) error {
+	cfg := &config.EnvConfig{}
+	if err := cfg.Load(); err != nil {
+		return err
+	}
+
+	dir, _, err := resolveTestPlan(cfg, c.String("plan"))
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, "manifest.toml")
+	errs, err := lintManifest(file)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		fmt.Printf("%s:\n", file)
+		for _, e := range errs {
+			fmt.Printf("  - %s\n", e)
+		}
+		return fmt.Errorf("manifest is invalid; %d problems found", len(errs))
+	}
+
+	fmt.Println("manifest is valid")
+	return nil
+}
+
+// lintManifest decodes the manifest file at path and returns every problem
+// found in it: keys that are not understood, and therefore ignored, as well as
+// validation errors. The returned error is only set if the file could not be
+// decoded at all.
+func lintManifest(path string) ([]error, error) {
+	var manifest api.TestPlanManifest
+	md, err := toml.DecodeFile(path, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest file at %s: %w", path, err)
+	}
+
+	// Builder and runner configurations, and parameter defaults, are
+	// free-form, so their contents are never reported. Only the outermost
+	// unknown key of a table is.
+	undecoded := make(map[string]struct{})
+	for _, key := range md.Undecoded() {
+		undecoded[key.String()] = struct{}{}
+	}
+
+	var errs []error
+	for _, key := range md.Undecoded() {
+		switch {
+		case key[0] == "builders" || key[0] == "runners":
+			continue
+		case len(key) > 4 && key[0] == "testcases" && key[1] == "params" && key[3] == "default":
+			continue
+		}
+
+		var nested bool
+		for i := 1; i < len(key); i++ {
+			if _, nested = undecoded[key[:i].String()]; nested {
+				break
+			}
+		}
+		if !nested {
+			errs = append(errs, &api.ManifestError{Location: key.String(), Message: "unknown key; it is ignored"})
+		}
+	}
+
+	var builders, runners []string
+	for _, b := range engine.AllBuilders {
+		builders = append(builders, b.ID())
+	}
+	for _, r := range engine.AllRunners {
+		runners = append(runners, r.ID())
+	}
+	if err := manifest.Validate(builders, runners); err != nil {
+		errs = append(errs, flattenErrors(err)...)
+	}
+	return errs, nil
+}
+
 func listCommand(c *cli.Context) error {
 	cfg := &config.EnvConfig{}
 	if err := cfg.Load(); err != nil {
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattn/go-zglob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintBundledPlans(t *testing.T) {
+	manifests, err := zglob.Glob("../../plans/**/manifest.toml")
+	require.NoError(t, err)
+	require.NotEmpty(t, manifests)
+
+	for _, m := range manifests {
+		errs, err := lintManifest(m)
+		require.NoError(t, err, m)
+		require.Empty(t, errs, m)
+	}
+}
+
+func TestLintManifestReportsUnknownKeys(t *testing.T) {
+	const manifest = `
+name = "foo_plan"
+
+[builders."exec:go"]
+enabled = true
+
+[runners."local:exec"]
+enabled = true
+
+[[testcases]]
+name = "foo_case"
+instance = { min = 1, max = 2 }
+
+  [testcases.params]
+  payload = { type = "json", default = { a = 1 } }
+`
+
+	path := filepath.Join(t.TempDir(), "manifest.toml")
+	require.NoError(t, os.WriteFile(path, []byte(manifest), 0644))
+
+	errs, err := lintManifest(path)
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), "testcases.instance: unknown key")
+}
@@ -11,6 +11,7 @@ var RootCommands = cli.CommandsByName{
 	&RunCommand,
 	&PlanCommand,
 	&BuildCommand,
+	&CompositionCommand,
 	&DescribeCommand,
 	&SidecarCommand,
 	&DaemonCommand,
@@ -20,6 +21,8 @@ var RootCommands = cli.CommandsByName{
 	&TasksCommand,
 	&StatusCommand,
 	&LogsCommand,
+	&ScheduleCommand,
+	&GCCommand,
 	&VersionCommand,
 }
 
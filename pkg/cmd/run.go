@@ -4,15 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/mitchellh/mapstructure"
+	"github.com/rs/xid"
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/data"
 	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
 
 	"github.com/BurntSushi/toml"
 	"github.com/urfave/cli/v2"
@@ -78,14 +83,13 @@ var RunCommand = cli.Command{
 					Name:        "instances",
 					Aliases:     []string{"i"},
 					Usage:       "number of instances of the test case to run",
-					Required:    true,
-					DefaultText: "none",
+					DefaultText: "the test case's default instance count",
 				},
 				&cli.StringFlag{
-					Name:     "runner",
-					Aliases:  []string{"r"},
-					Usage:    "runner to use; values include: 'local:exec', 'local:docker', 'cluster:k8s'",
-					Required: true,
+					Name:        "runner",
+					Aliases:     []string{"r"},
+					Usage:       "runner to use; values include: 'local:exec', 'local:docker', 'cluster:k8s'",
+					DefaultText: "the plan's default runner",
 				},
 				&cli.StringSliceFlag{
 					Name:  "run-cfg",
@@ -134,17 +138,34 @@ func runCompositionCmd(c *cli.Context) (err error) {
 		return fmt.Errorf("no composition file supplied")
 	}
 
-	comp, err := loadComposition(file)
+	overlays := c.StringSlice("overlay")
+	if c.Bool("write-artifacts") && isDerivedComposition(file, overlays) {
+		return fmt.Errorf("cannot write artifacts to a composition that uses extends or overlays")
+	}
+
+	comps, err := loadComposition(file, overlays...)
 
 	if err != nil {
 		return fmt.Errorf("failed to load composition file: %w", err)
 	}
 
-	if err = comp.ValidateForRun(); err != nil {
-		return fmt.Errorf("invalid composition file: %w", err)
+	for _, comp := range comps {
+		if err = comp.ValidateForRun(); err != nil {
+			return fmt.Errorf("invalid composition file: %w", err)
+		}
 	}
 
-	err = run(c, comp)
+	if len(comps) > 1 {
+		if c.Bool("write-artifacts") {
+			return fmt.Errorf("cannot write artifacts to a composition with a matrix")
+		}
+		if c.String("collect-file") != "" {
+			return fmt.Errorf("cannot use --collect-file with a composition with a matrix; outputs are written to <run_id>.tgz")
+		}
+		logging.S().Infof("composition expands to %d matrix points; queueing one run for each", len(comps))
+	}
+
+	err = run(c, comps...)
 	if err != nil {
 		return err
 	}
@@ -161,7 +182,51 @@ func runSingleCmd(c *cli.Context) (err error) {
 	return run(c, comp)
 }
 
-func run(c *cli.Context, comp *api.Composition) (err error) {
+// resolveRunSources returns the indices of the groups of the composition the
+// daemon needs to build, and the plan directory, linked SDK directory and
+// extra sources to submit to build them with. No sources are returned if no
+// group needs to be built.
+func resolveRunSources(c *cli.Context, cfg *config.EnvConfig, comp *api.Composition, planDir string, manifest *api.TestPlanManifest) (buildIdx []int, _ string, sdkDir string, extraSrcs []string, err error) {
+	ignore := c.Bool("ignore-artifacts")
+	for i, grp := range comp.Groups {
+		if grp.Run.Artifact == "" || ignore {
+			buildIdx = append(buildIdx, i)
+		}
+	}
+
+	if len(buildIdx) == 0 {
+		return nil, "", "", nil, nil
+	}
+
+	// Resolve the linked SDK directory, if one has been supplied.
+	if sdk := c.String("link-sdk"); sdk != "" {
+		sdkDir, err = resolveSDK(cfg, sdk)
+		if err != nil {
+			return nil, "", "", nil, fmt.Errorf("failed to resolve linked SDK directory: %w", err)
+		}
+		logging.S().Infof("linking with sdk at: %s", sdkDir)
+	}
+	// if there are extra sources to include for this builder, contextualize
+	// them to the plan's dir.
+	builder := strings.Replace(comp.Global.Builder, ":", "_", -1)
+	extraSrcs = manifest.ExtraSources[builder]
+	for i, dir := range extraSrcs {
+		if !filepath.IsAbs(dir) {
+			// follow any symlinks in the plan dir.
+			evalPlanDir, err := filepath.EvalSymlinks(planDir)
+			if err != nil {
+				return nil, "", "", nil, fmt.Errorf("failed to follow symlinks in plan dir: %w", err)
+			}
+			extraSrcs[i] = filepath.Clean(filepath.Join(evalPlanDir, dir))
+		}
+	}
+	return buildIdx, planDir, sdkDir, extraSrcs, nil
+}
+
+// run queues a run for each of the supplied compositions. When more than one
+// composition is supplied, they are expected to be the result of a matrix
+// expansion, and they are linked together as a sweep.
+func run(c *cli.Context, comps ...*api.Composition) (err error) {
 	cl, cfg, err := setupClient(c)
 	if err != nil {
 		return err
@@ -170,6 +235,10 @@ func run(c *cli.Context, comp *api.Composition) (err error) {
 	ctx, cancel := context.WithCancel(ProcessContext())
 	defer cancel()
 
+	// All compositions in a sweep share the plan and groups, only test
+	// parameters vary; use the first one to resolve the shared bits.
+	comp := comps[0]
+
 	// Resolve the test plan and its manifest.
 	planDir, manifest, err := resolveTestPlan(cfg, comp.Global.Plan)
 	if err != nil {
@@ -177,129 +246,149 @@ func run(c *cli.Context, comp *api.Composition) (err error) {
 	}
 
 	// Check if the daemon needs to build the test plan.
-	ignore := c.Bool("ignore-artifacts")
-	var buildIdx []int
-	for i, grp := range comp.Groups {
-		if grp.Run.Artifact == "" || ignore {
-			buildIdx = append(buildIdx, i)
-		}
+	buildIdx, planDir, sdkDir, extraSrcs, err := resolveRunSources(c, cfg, comp, planDir, manifest)
+	if err != nil {
+		return err
 	}
 
 	var (
-		sdkDir    string
-		extraSrcs []string
 		collectOpt = c.Bool("collect")
-		wait      = c.Bool("wait") || collectOpt // we always wait if we are collecting.
+		wait       = c.Bool("wait") || collectOpt // we always wait if we are collecting.
 	)
 
-	if len(buildIdx) > 0 {
-		// Resolve the linked SDK directory, if one has been supplied.
-		if sdk := c.String("link-sdk"); sdk != "" {
-			var err error
-			sdkDir, err = resolveSDK(cfg, sdk)
-			if err != nil {
-				return fmt.Errorf("failed to resolve linked SDK directory: %w", err)
-			}
-			logging.S().Infof("linking with sdk at: %s", sdkDir)
+	var sweepID string
+	if len(comps) > 1 {
+		sweepID = xid.New().String()
+	}
+
+	ids := make([]string, 0, len(comps))
+	for i, comp := range comps {
+		req := &api.RunRequest{
+			BuildGroups: buildIdx,
+			Composition: *comp,
+			Manifest:    *manifest,
+			CreatedBy: api.CreatedBy{
+				User:   cfg.Client.User,
+				Repo:   c.String("metadata-repo"),
+				Branch: c.String("metadata-branch"),
+				Commit: c.String("metadata-commit"),
+			},
+			DependsOn:   c.StringSlice("depends-on"),
+			Preemptible: c.Bool("preemptible"),
 		}
-		// if there are extra sources to include for this builder, contextualize
-		// them to the plan's dir.
-		builder := strings.Replace(comp.Global.Builder, ":", "_", -1)
-		extraSrcs = manifest.ExtraSources[builder]
-		for i, dir := range extraSrcs {
-			if !filepath.IsAbs(dir) {
-				// follow any symlinks in the plan dir.
-				evalPlanDir, err := filepath.EvalSymlinks(planDir)
-				if err != nil {
-					return fmt.Errorf("failed to follow symlinks in plan dir: %w", err)
-				}
-				extraSrcs[i] = filepath.Clean(filepath.Join(evalPlanDir, dir))
+
+		if sweepID != "" {
+			req.Sweep = &api.Sweep{
+				ID:          sweepID,
+				Index:       i,
+				Total:       len(comps),
+				Coordinates: comp.Metadata.Coordinates,
 			}
 		}
-	} else {
-		planDir = ""
-	}
 
-	req := &api.RunRequest{
-		BuildGroups: buildIdx,
-		Composition: *comp,
-		Manifest:    *manifest,
-		CreatedBy: api.CreatedBy{
-			User:   cfg.Client.User,
-			Repo:   c.String("metadata-repo"),
-			Branch: c.String("metadata-branch"),
-			Commit: c.String("metadata-commit"),
-		},
+		if wait {
+			req.Priority = 1
+		}
+
+		resp, err := cl.Run(ctx, req, planDir, sdkDir, extraSrcs)
+		switch err {
+		case nil:
+			// noop
+		case context.Canceled:
+			return fmt.Errorf("interrupted")
+		default:
+			return err
+		}
+
+		id, err := client.ParseRunResponse(resp)
+		resp.Close()
+		if err != nil {
+			return err
+		}
+
+		if sweepID != "" {
+			logging.S().Infow("run is queued", "id", id, "sweep", sweepID, "coordinates", comp.Metadata.Coordinates)
+		} else {
+			logging.S().Infof("run is queued with ID: %s", id)
+		}
+		ids = append(ids, id)
 	}
 
-	if wait {
-		req.Priority = 1
+	if !wait {
+		return nil
 	}
 
-	resp, err := cl.Run(ctx, req, planDir, sdkDir, extraSrcs)
-	switch err {
-	case nil:
-		// noop
-	case context.Canceled:
-		return fmt.Errorf("interrupted")
-	default:
+	if sweepID == "" {
+		_, err = awaitRun(ctx, c, cl, comp, ids[0])
 		return err
 	}
 
-	defer resp.Close()
-
-	id, err := client.ParseRunResponse(resp)
-	if err != nil {
-		return err
+	// Wait for every run in the sweep, and report the outcome of each
+	// point side by side.
+	tsks := make([]*task.Task, len(ids))
+	var failed int
+	for i, id := range ids {
+		tsk, err := awaitRun(ctx, c, cl, comps[i], id)
+		if err != nil {
+			logging.S().Warnw("matrix point failed", "id", id, "coordinates", comps[i].Metadata.Coordinates, "err", err)
+			failed++
+		}
+		tsks[i] = tsk
 	}
 
-	logging.S().Infof("run is queued with ID: %s", id)
+	printSweep(os.Stdout, comps, ids, tsks)
 
-	if !wait {
-		return nil
+	if failed > 0 {
+		return fmt.Errorf("%d out of %d matrix points failed", failed, len(ids))
 	}
+	return nil
+}
 
+// awaitRun follows the logs of the given run until it completes, writing
+// artifacts back and collecting outputs if requested. It returns the final
+// task, and an error if the run did not succeed.
+func awaitRun(ctx context.Context, c *cli.Context, cl *client.Client, comp *api.Composition, id string) (*task.Task, error) {
 	r, err := cl.Logs(ctx, &api.LogsRequest{
 		TaskID:            id,
 		Follow:            true,
 		CancelWithContext: true,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer r.Close()
 
 	tsk, err := client.ParseLogsRequest(os.Stdout, r)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if tsk.Error != "" {
-		return errors.New(tsk.Error)
+		return &tsk, errors.New(tsk.Error)
 	}
 
 	var composition api.Composition
 	err = mapstructure.Decode(tsk.Composition, &composition)
 	if err != nil {
-		return err
+		return &tsk, err
 	}
 
 	if file := c.String("file"); file != "" && c.Bool("write-artifacts") {
 		f, err := os.OpenFile(file, os.O_WRONLY, 0644)
 		if err != nil {
-			return fmt.Errorf("failed to write composition to file: %w", err)
+			return &tsk, fmt.Errorf("failed to write composition to file: %w", err)
 		}
 		enc := toml.NewEncoder(f)
 		if err := enc.Encode(composition); err != nil {
-			return fmt.Errorf("failed to encode composition into file: %w", err)
+			return &tsk, fmt.Errorf("failed to encode composition into file: %w", err)
 		}
 	}
 
 	logging.S().Infof("finished run with ID: %s", id)
 
-	// if the `collect` flag is not set, we are done	
-	if !collectOpt {
-		return data.IsTaskOutcomeInError(&tsk)
+	// if the `collect` flag is not set, we are done
+	if !c.Bool("collect") {
+		return &tsk, data.IsTaskOutcomeInError(&tsk)
 	}
 
 	collectFile := c.String("collect-file")
@@ -310,8 +399,27 @@ func run(c *cli.Context, comp *api.Composition) (err error) {
 	err = collect(ctx, cl, comp.Global.Runner, id, collectFile)
 
 	if err != nil {
-		return cli.Exit(err.Error(), 3)
+		return &tsk, cli.Exit(err.Error(), 3)
+	}
+
+	return &tsk, data.IsTaskOutcomeInError(&tsk)
+}
+
+// printSweep prints a table with the coordinates and outcome of every run in a
+// sweep.
+func printSweep(w io.Writer, comps []*api.Composition, ids []string, tsks []*task.Task) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(tw, "ID\tCOORDINATES\tOUTCOME")
+	for i, id := range ids {
+		outcome := task.OutcomeUnknown
+		if tsks[i] != nil {
+			if o, err := data.DecodeTaskOutcome(tsks[i]); err == nil {
+				outcome = o
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", id, formatCoordinates(comps[i].Metadata.Coordinates), outcome)
 	}
 
-	return data.IsTaskOutcomeInError(&tsk)
+	tw.Flush()
 }
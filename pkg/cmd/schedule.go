@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/logging"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ScheduleCommand is the specification of the `schedule` command.
+var ScheduleCommand = cli.Command{
+	Name:  "schedule",
+	Usage: "manage compositions the daemon runs on a recurring schedule",
+	Subcommands: cli.Commands{
+		&cli.Command{
+			Name:   "create",
+			Usage:  "run a composition on a cron expression",
+			Action: scheduleCreateCmd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "id",
+					Usage:    "`ID` of the schedule; runs are recorded as created by schedule:ID",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "cron",
+					Usage:    "cron `EXPRESSION` to run the composition on, e.g. '0 2 * * *' or '@daily'",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "file",
+					Aliases:  []string{"f"},
+					Usage:    "path to a `COMPOSITION`",
+					Required: true,
+				},
+				&cli.StringSliceFlag{
+					Name:  "overlay",
+					Usage: "path to a composition `OVERLAY` merged on top of the composition; can be repeated, applied in order",
+				},
+				&cli.StringFlag{
+					Name:  "link-sdk",
+					Usage: linkSdkUsage,
+				},
+				&cli.BoolFlag{
+					Name:    "ignore-artifacts",
+					Aliases: []string{"i"},
+					Usage:   "ignore any build artifacts present in the composition file",
+				},
+				&cli.BoolFlag{
+					Name:  "preemptible",
+					Usage: "allow the runs to be interrupted and scheduled again in favour of higher priority tasks",
+				},
+			},
+		},
+		&cli.Command{
+			Name:   "list",
+			Usage:  "list schedules, along with their upcoming and last executions",
+			Action: scheduleListCmd,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "list all upcoming and recorded executions of each schedule",
+				},
+			},
+		},
+		&cli.Command{
+			Name:      "delete",
+			Usage:     "delete a schedule created with `schedule create`",
+			ArgsUsage: "[id]",
+			Action:    scheduleDeleteCmd,
+		},
+	},
+}
+
+func scheduleCreateCmd(c *cli.Context) error {
+	comps, err := loadComposition(c.String("file"), c.StringSlice("overlay")...)
+	if err != nil {
+		return fmt.Errorf("failed to load composition file: %w", err)
+	}
+	if len(comps) > 1 {
+		return fmt.Errorf("composition expands to %d matrix points; only single runs can be scheduled", len(comps))
+	}
+
+	comp := comps[0]
+	if err = comp.ValidateForRun(); err != nil {
+		return fmt.Errorf("invalid composition file: %w", err)
+	}
+
+	cl, cfg, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	planDir, manifest, err := resolveTestPlan(cfg, comp.Global.Plan)
+	if err != nil {
+		return fmt.Errorf("failed to resolve test plan: %w", err)
+	}
+
+	buildIdx, planDir, sdkDir, extraSrcs, err := resolveRunSources(c, cfg, comp, planDir, manifest)
+	if err != nil {
+		return err
+	}
+
+	req := &api.ScheduleRequest{
+		ID:   c.String("id"),
+		Cron: c.String("cron"),
+		Run: api.RunRequest{
+			BuildGroups: buildIdx,
+			Composition: *comp,
+			Manifest:    *manifest,
+			Preemptible: c.Bool("preemptible"),
+		},
+	}
+
+	resp, err := cl.Schedule(ctx, req, planDir, sdkDir, extraSrcs)
+	switch err {
+	case nil:
+		// noop
+	case context.Canceled:
+		return fmt.Errorf("interrupted")
+	default:
+		return err
+	}
+	defer resp.Close()
+
+	id, err := client.ParseScheduleResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	logging.S().Infof("composition is scheduled with ID: %s", id)
+	return nil
+}
+
+func scheduleListCmd(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.ListSchedules(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	schedules, err := client.ParseSchedulesResponse(r)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("all") {
+		for _, s := range schedules {
+			printSchedule(os.Stdout, s)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "ID\tSOURCE\tCRON\tTEST PLAN\tTEST CASE\tNEXT\tLAST\tLAST TASK")
+
+	for _, s := range schedules {
+		var next, last, lastTask string
+		if len(s.Upcoming) > 0 {
+			next = s.Upcoming[0].Local().Format(time.RFC3339)
+		}
+		if n := len(s.Executions); n > 0 {
+			exec := s.Executions[n-1]
+			last, lastTask = exec.Time.Local().Format(time.RFC3339), exec.TaskID
+			if exec.Error != "" {
+				lastTask = "failed to queue"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Source, s.Cron, s.Plan, s.Case, next, last, lastTask)
+	}
+
+	return w.Flush()
+}
+
+// printSchedule prints the schedule, along with all its upcoming and recorded
+// executions.
+func printSchedule(w io.Writer, s api.Schedule) {
+	fmt.Fprintf(w, "Schedule: %s (%s)\n", s.ID, s.Source)
+	fmt.Fprintf(w, "Cron: %s\n", s.Cron)
+	fmt.Fprintf(w, "Test plan: %s\n", s.Plan)
+	fmt.Fprintf(w, "Test case: %s\n", s.Case)
+
+	fmt.Fprintln(w, "Upcoming:")
+	for _, t := range s.Upcoming {
+		fmt.Fprintf(w, "  %s\n", t.Local().Format(time.RFC3339))
+	}
+
+	fmt.Fprintln(w, "Executions:")
+	for _, exec := range s.Executions {
+		if exec.Error != "" {
+			fmt.Fprintf(w, "  %s  failed to queue: %s\n", exec.Time.Local().Format(time.RFC3339), exec.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  %s  %s\n", exec.Time.Local().Format(time.RFC3339), exec.TaskID)
+	}
+	fmt.Fprintln(w)
+}
+
+func scheduleDeleteCmd(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("missing schedule id")
+	}
+
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.DeleteSchedule(ctx, &api.ScheduleDeleteRequest{ID: c.Args().First()})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := client.ParseDeleteScheduleResponse(r); err != nil {
+		return err
+	}
+
+	logging.S().Infof("schedule %s deleted", c.Args().First())
+	return nil
+}
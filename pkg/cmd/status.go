@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/client"
@@ -73,6 +75,9 @@ func statusCommand(c *cli.Context) error {
 	return nil
 }
 
+// maxAhead is the maximum number of tasks ahead of a scheduled task printed.
+const maxAhead = 10
+
 func printTask(tsk task.Task) {
 	outcome, err := data.DecodeTaskOutcome(&tsk)
 	outcomeStr := string(outcome)
@@ -88,4 +93,59 @@ func printTask(tsk task.Task) {
 	fmt.Printf("Status:\t\t%s\n", tsk.State().State)
 	fmt.Printf("Outcome:\t%s\n", outcomeStr)
 	fmt.Printf("Last update:\t%s\n", tsk.State().Created)
+	if tsk.Preemptible {
+		fmt.Printf("Preemptible:\tyes (preempted %d times)\n", tsk.Preemptions())
+	}
+	if tsk.Waiting != "" {
+		fmt.Printf("Waiting:\t%s\n", tsk.Waiting)
+	}
+	if q := tsk.Queue; q != nil {
+		fmt.Printf("Position:\t%d (%d tasks ahead)\n", q.Position, len(q.Ahead))
+		if n := len(q.Ahead); n > maxAhead {
+			fmt.Printf("Ahead:\t\t%s, and %d more\n", strings.Join(q.Ahead[:maxAhead], ", "), n-maxAhead)
+		} else if n > 0 {
+			fmt.Printf("Ahead:\t\t%s\n", strings.Join(q.Ahead, ", "))
+		}
+		if !q.EstimatedStart.IsZero() {
+			fmt.Printf("ETA:\t\tstarts %s (in %s), completes %s (in %s)\n",
+				q.EstimatedStart.Local().Format(time.RFC3339), time.Until(q.EstimatedStart).Truncate(time.Second),
+				q.EstimatedEnd.Local().Format(time.RFC3339), time.Until(q.EstimatedEnd).Truncate(time.Second))
+		} else {
+			fmt.Printf("ETA:\t\tunknown; no history for the tasks ahead\n")
+		}
+	}
+	if len(tsk.Attempts) > 1 || tsk.Retries() > 0 {
+		fmt.Printf("Attempts:\n")
+		for i, a := range tsk.Attempts {
+			fmt.Printf("  %d.\t%s\t%s\t%s", i+1, a.Started.Format(time.RFC3339), a.Ended.Sub(a.Started).Truncate(time.Second), a.State)
+			if a.ErrorClass != "" {
+				fmt.Printf("\t%s", a.ErrorClass)
+			}
+			if a.Error != "" {
+				fmt.Printf("\t%s", a.Error)
+			}
+			fmt.Println()
+		}
+	}
+	if len(tsk.DependsOn) > 0 {
+		fmt.Printf("Depends on:\t%s\n", strings.Join(tsk.DependsOn, ", "))
+	}
+	if tsk.Sweep != nil {
+		fmt.Printf("Sweep:\t\t%s (%d/%d)\n", tsk.Sweep.ID, tsk.Sweep.Index+1, tsk.Sweep.Total)
+		fmt.Printf("Coordinates:\t%v\n", tsk.Sweep.Coordinates)
+	}
+	if tsk.Type == task.TypeRun {
+		if res := data.DecodeRunnerResult(tsk.Result); len(res.Stages) > 0 {
+			fmt.Printf("Stages:\n")
+			for i, s := range res.Stages {
+				fmt.Printf("  %d.\t%s\t%s\t%s\n", i+1, s.Case, s.RunID, s.Outcome)
+			}
+		}
+		if res := data.DecodeRunnerResult(tsk.Result); len(res.DependencyMatrix) > 0 {
+			fmt.Printf("Dependency matrix:\n")
+			for _, m := range res.DependencyMatrix {
+				fmt.Printf("  %s\t%s\n", formatCoordinates(m.Versions), m.Outcome)
+			}
+		}
+	}
 }
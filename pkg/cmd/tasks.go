@@ -3,20 +3,120 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/client"
 	"github.com/testground/testground/pkg/task"
+
 	"github.com/urfave/cli/v2"
-	"os"
-	"text/tabwriter"
 )
 
 var TasksCommand = cli.Command{
 	Name:   "tasks",
 	Usage:  "get a list of the existing tasks",
 	Action: tasksCommand,
-	Flags:  []cli.Flag{
-		// TODO(hac): add filters (type of task, date, state, etc)
+	Subcommands: cli.Commands{
+		&TasksExportCommand,
+		&TasksImportCommand,
+		&cli.Command{
+			Name:   "branches",
+			Usage:  "summarize the runs created from each branch of a repository",
+			Action: branchesCommand,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "repo",
+					Usage:    "the `REPO` the runs were created from",
+					Required: true,
+				},
+			},
+		},
+		&cli.Command{
+			Name:   "last-green",
+			Usage:  "show the most recent successful run created from a branch",
+			Action: lastGreenCommand,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "repo",
+					Usage:    "the `REPO` the runs were created from",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "branch",
+					Usage:    "the `BRANCH` the runs were created from",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "plan",
+					Usage: "only consider runs of this test `PLAN`",
+				},
+			},
+		},
+	},
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "type",
+			Usage: "only list tasks of this `TYPE` (build, run); can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "state",
+			Usage: "only list tasks in this `STATE` (scheduled, processing, complete); can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "plan",
+			Usage: "only list tasks of this test `PLAN`",
+		},
+		&cli.StringFlag{
+			Name:  "case",
+			Usage: "only list tasks of this test `CASE`",
+		},
+		&cli.StringFlag{
+			Name:  "runner",
+			Usage: "only list tasks run by this `RUNNER`",
+		},
+		&cli.StringFlag{
+			Name:  "outcome",
+			Usage: "only list tasks with this `OUTCOME` (success, failure, canceled, timeout, unknown)",
+		},
+		&cli.StringFlag{
+			Name:  "repo",
+			Usage: "only list tasks created from this `REPO`",
+		},
+		&cli.StringFlag{
+			Name:  "branch",
+			Usage: "only list tasks created from this `BRANCH`",
+		},
+		&cli.StringFlag{
+			Name:  "commit",
+			Usage: "only list tasks created from this `COMMIT`",
+		},
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "only list tasks created by this `USER`",
+		},
+		&cli.StringFlag{
+			Name:  "after",
+			Usage: "only list tasks created at or after `TIME`; an RFC3339 timestamp, or a duration ago such as 24h",
+		},
+		&cli.StringFlag{
+			Name:  "before",
+			Usage: "only list tasks created before `TIME`; an RFC3339 timestamp, or a duration ago such as 24h",
+		},
+		&cli.StringFlag{
+			Name:  "order",
+			Usage: "list the `newest` or `oldest` tasks first",
+			Value: string(api.TasksNewestFirst),
+		},
+		&cli.IntFlag{
+			Name:  "offset",
+			Usage: "skip the first `N` matching tasks",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "list at most `N` tasks; 0 lists all matching tasks",
+		},
 	},
 }
 
@@ -24,14 +124,37 @@ func tasksCommand(c *cli.Context) error {
 	ctx, cancel := context.WithCancel(ProcessContext())
 	defer cancel()
 
-	cl, _, err := setupClient(c)
-	if err != nil {
+	req := &api.TasksRequest{
+		TestPlan: c.String("plan"),
+		TestCase: c.String("case"),
+		Runner:   c.String("runner"),
+		Outcome:  task.Outcome(c.String("outcome")),
+		Repo:     c.String("repo"),
+		Branch:   c.String("branch"),
+		Commit:   c.String("commit"),
+		User:     c.String("user"),
+		Order:    api.TasksOrder(c.String("order")),
+		Offset:   c.Int("offset"),
+		Limit:    c.Int("limit"),
+	}
+	for _, tp := range c.StringSlice("type") {
+		req.Types = append(req.Types, task.Type(tp))
+	}
+	for _, state := range c.StringSlice("state") {
+		req.States = append(req.States, task.State(state))
+	}
+
+	var err error
+	if req.Since, err = parseTimeFlag(c, "after"); err != nil {
+		return err
+	}
+	if req.Until, err = parseTimeFlag(c, "before"); err != nil {
 		return err
 	}
 
-	req := &api.TasksRequest{
-		Types:  []task.Type{task.TypeBuild, task.TypeRun},
-		States: []task.State{task.StateScheduled, task.StateProcessing, task.StateComplete},
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
 	}
 
 	r, err := cl.Tasks(ctx, req)
@@ -50,10 +173,95 @@ func tasksCommand(c *cli.Context) error {
 	fmt.Fprintln(w, "ID\tDATE\tTEST PLAN\tTEST CASE\tDURATION\tSTATE\tTYPE")
 
 	for _, tsk := range tsks {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tsk.ID, tsk.Created().String(), tsk.Plan, tsk.Case, tsk.Took(), tsk.State().State, tsk.Type)
+		state := string(tsk.State().State)
+		if tsk.Queue != nil {
+			state = fmt.Sprintf("%s (#%d)", state, tsk.Queue.Position)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tsk.ID, tsk.Created().String(), tsk.Plan, tsk.Case, tsk.Took(), state, tsk.Type)
 	}
 
 	w.Flush()
 
 	return err
 }
+
+func branchesCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.Branches(ctx, &api.BranchesRequest{Repo: c.String("repo")})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	branches, err := client.ParseBranchesResponse(r)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "BRANCH\tRUNS\tSUCCEEDED\tFAILED\tLAST RUN\tLAST COMMIT")
+
+	for _, b := range branches {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", b.Branch, b.Runs, b.Succeeded, b.Failed, b.LastRun.String(), b.LastCommit)
+	}
+
+	return w.Flush()
+}
+
+func lastGreenCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.LastGreen(ctx, &api.LastGreenRequest{
+		Repo:   c.String("repo"),
+		Branch: c.String("branch"),
+		Plan:   c.String("plan"),
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tsk, err := client.ParseLastGreenResponse(r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("ID:\t\t%s\n", tsk.ID)
+	fmt.Printf("Commit:\t\t%s\n", tsk.CreatedBy.Commit)
+	fmt.Printf("Test plan:\t%s\n", tsk.Plan)
+	fmt.Printf("Test case:\t%s\n", tsk.Case)
+	fmt.Printf("Created:\t%s\n", tsk.Created().String())
+	return nil
+}
+
+// parseTimeFlag parses the named flag as an RFC3339 timestamp, or as a
+// duration before now. It returns nil if the flag is not set.
+func parseTimeFlag(c *cli.Context, name string) (*time.Time, error) {
+	v := c.String(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: expected an RFC3339 timestamp or a duration: %s", name, v)
+	}
+	t := time.Now().Add(-d)
+	return &t, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 
@@ -62,7 +63,11 @@ func compileCompositionTemplate(path string, input *compositionData) (*bytes.Buf
 	return buff, nil
 }
 
-func loadComposition(path string) (*api.Composition, error) {
+// loadComposition loads the composition at the given path, compiling it as a
+// template, resolving the compositions it extends, applying the supplied
+// overlays in order, and expanding any matrix and dependency matrix it
+// declares. A composition without a matrix results in a single-element slice.
+func loadComposition(path string, overlays ...string) ([]*api.Composition, error) {
 	data := &compositionData{Env: map[string]string{}}
 
 	// Build a map of environment variables
@@ -71,9 +76,24 @@ func loadComposition(path string) (*api.Composition, error) {
 		data.Env[s[0]] = s[1]
 	}
 
-	buff, err := compileCompositionTemplate(path, data)
+	tree, err := loadCompositionTree(path, data, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process composition template: %w", err)
+		return nil, err
+	}
+
+	for _, o := range overlays {
+		overlay, err := loadCompositionTree(o, data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load overlay %s: %w", o, err)
+		}
+		tree = mergeCompositionTrees(tree, overlay)
+	}
+
+	// Round-trip the merged tree through TOML, so that it is decoded exactly
+	// like a regular composition file.
+	buff := &bytes.Buffer{}
+	if err := toml.NewEncoder(buff).Encode(tree); err != nil {
+		return nil, fmt.Errorf("failed to process composition file: %w", err)
 	}
 
 	comp := new(api.Composition)
@@ -81,5 +101,163 @@ func loadComposition(path string) (*api.Composition, error) {
 		return nil, fmt.Errorf("failed to process composition file: %w", err)
 	}
 
-	return comp, nil
+	comps, err := comp.ExpandMatrix()
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand composition matrix: %w", err)
+	}
+
+	for i, c := range comps {
+		if comps[i], err = c.ExpandDependencyMatrix(); err != nil {
+			return nil, fmt.Errorf("failed to expand dependency matrix: %w", err)
+		}
+	}
+
+	return comps, nil
+}
+
+// extendsDirective matches an extends directive in a raw composition file.
+var extendsDirective = regexp.MustCompile(`(?m)^\s*extends\s*=`)
+
+// isDerivedComposition returns whether the composition at the given path is
+// assembled from other files, through an extends directive or overlays.
+// Writing such a composition back to disk would flatten it.
+func isDerivedComposition(path string, overlays []string) bool {
+	if len(overlays) > 0 {
+		return true
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && extendsDirective.Match(data)
+}
+
+// loadCompositionTree compiles the composition template at the given path and
+// decodes it into a generic tree. If the composition extends another one, the
+// base composition is loaded (recursively) and the composition is merged on
+// top of it. Paths in extends directives are relative to the file declaring
+// them. visited tracks the chain of files being loaded, to detect cycles.
+func loadCompositionTree(path string, data *compositionData, visited []string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range visited {
+		if v == abs {
+			return nil, fmt.Errorf("cyclic extends: %s", strings.Join(append(visited, abs), " -> "))
+		}
+	}
+	visited = append(visited, abs)
+
+	buff, err := compileCompositionTemplate(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process composition template: %w", err)
+	}
+
+	var tree map[string]interface{}
+	if _, err = toml.Decode(buff.String(), &tree); err != nil {
+		return nil, fmt.Errorf("failed to process composition file %s: %w", path, err)
+	}
+
+	ext, ok := tree["extends"]
+	if !ok {
+		return tree, nil
+	}
+	delete(tree, "extends")
+
+	basePath, ok := ext.(string)
+	if !ok || basePath == "" {
+		return nil, fmt.Errorf("invalid extends directive in %s: expected a path", path)
+	}
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(path), basePath)
+	}
+
+	base, err := loadCompositionTree(basePath, data, visited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load base composition of %s: %w", path, err)
+	}
+
+	return mergeCompositionTrees(base, tree), nil
+}
+
+// mergeCompositionTrees deep-merges the overlay composition tree on top of
+// the base one, and returns the result. The merge semantics are:
+//
+//   - tables are merged recursively; keys present in the overlay win.
+//   - groups are matched by ID: a group in the overlay with the same ID as a
+//     group in the base is merged into it; other groups are appended, in the
+//     order they appear in the overlay.
+//   - any other value, including arrays, is replaced wholesale.
+//
+// The base tree may be modified.
+func mergeCompositionTrees(base, overlay map[string]interface{}) map[string]interface{} {
+	for k, v := range overlay {
+		if k == "groups" {
+			if merged, ok := mergeGroups(base[k], v); ok {
+				base[k] = merged
+				continue
+			}
+		}
+		base[k] = mergeValues(base[k], v)
+	}
+	return base
+}
+
+func mergeValues(base, overlay interface{}) interface{} {
+	bm, ok1 := base.(map[string]interface{})
+	om, ok2 := overlay.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return overlay
+	}
+	for k, v := range om {
+		bm[k] = mergeValues(bm[k], v)
+	}
+	return bm
+}
+
+// mergeGroups merges two arrays of groups, matching them by ID. It returns
+// false if either value is not an array of tables.
+func mergeGroups(base, overlay interface{}) ([]map[string]interface{}, bool) {
+	bgrps, ok1 := toTables(base)
+	ogrps, ok2 := toTables(overlay)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+
+	idx := make(map[interface{}]int, len(bgrps))
+	for i, g := range bgrps {
+		if id, ok := g["id"]; ok {
+			idx[id] = i
+		}
+	}
+
+	for _, g := range ogrps {
+		if i, ok := idx[g["id"]]; ok && g["id"] != nil {
+			bgrps[i] = mergeValues(bgrps[i], g).(map[string]interface{})
+			continue
+		}
+		bgrps = append(bgrps, g)
+	}
+	return bgrps, true
+}
+
+// toTables converts an array of tables, as decoded by the TOML library, into a
+// slice of maps. A nil value results in an empty slice.
+func toTables(v interface{}) ([]map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case []map[string]interface{}:
+		return v, true
+	case []interface{}:
+		ret := make([]map[string]interface{}, 0, len(v))
+		for _, e := range v {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, m)
+		}
+		return ret, true
+	default:
+		return nil, false
+	}
 }
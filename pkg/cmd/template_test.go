@@ -56,3 +56,47 @@ func TestLoadCompositionWithMissingResourcesFail(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, buff)
 }
+
+func TestLoadCompositionExtends(t *testing.T) {
+	comps, err := loadComposition("fixtures/templates/extends-base.toml")
+	require.NoError(t, err)
+	require.Len(t, comps, 1)
+
+	comp := comps[0]
+	require.Equal(t, "derived", comp.Metadata.Name)
+	require.Equal(t, "plan", comp.Global.Plan)
+	require.Equal(t, "cluster:k8s", comp.Global.Runner)
+	require.EqualValues(t, 6, comp.Global.TotalInstances)
+
+	// global test params are merged key by key.
+	require.Equal(t, "10", comp.Global.Run.TestParams["conn_count"])
+	require.Equal(t, "1024", comp.Global.Run.TestParams["data_size_kb"])
+
+	// groups are matched by ID; new groups are appended.
+	require.Len(t, comp.Groups, 3)
+	require.Equal(t, "providers", comp.Groups[0].ID)
+	require.EqualValues(t, 1, comp.Groups[0].Instances.Count)
+	require.Equal(t, "provider", comp.Groups[0].Run.TestParams["role"])
+	require.Equal(t, "requesters", comp.Groups[1].ID)
+	require.EqualValues(t, 4, comp.Groups[1].Instances.Count)
+	require.Equal(t, "observers", comp.Groups[2].ID)
+}
+
+func TestLoadCompositionOverlays(t *testing.T) {
+	comps, err := loadComposition("fixtures/templates/extends-base.toml", "fixtures/templates/overlay.toml")
+	require.NoError(t, err)
+	require.Len(t, comps, 1)
+
+	comp := comps[0]
+	require.EqualValues(t, 7, comp.Global.TotalInstances)
+	require.Equal(t, "cluster:k8s", comp.Global.Runner)
+	require.Len(t, comp.Groups, 3)
+	require.EqualValues(t, 2, comp.Groups[0].Instances.Count)
+	require.Equal(t, "provider", comp.Groups[0].Run.TestParams["role"])
+}
+
+func TestLoadCompositionExtendsCycleFails(t *testing.T) {
+	_, err := loadComposition("fixtures/templates/extends-cycle-a.toml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cyclic extends")
+}
@@ -43,6 +43,46 @@ type DaemonConfig struct {
 	GithubRepoStatusToken string          `toml:"github_repo_status_token"`
 	RootURL               string          `toml:"root_url"`
 	InfluxDBEndpoint      string          `toml:"influxdb_endpoint"`
+
+	// Schedules are compositions the daemon runs on a recurring schedule.
+	Schedules []ScheduleConfig `toml:"schedules"`
+
+	// Retention is the policy to delete complete tasks, along with their
+	// logs and outputs, with.
+	Retention RetentionConfig `toml:"retention"`
+}
+
+// RetentionConfig is the policy to delete complete tasks, along with their
+// logs, outputs and sources, with. The daemon applies it periodically when
+// MaxAge or MaxPerPlan is set.
+type RetentionConfig struct {
+	// MaxAge is how long complete tasks are kept for after completing (e.g.
+	// "720h"). Zero keeps them regardless of their age.
+	MaxAge string `toml:"max_age"`
+	// MaxPerPlan is the number of most recent complete tasks kept for each
+	// test plan. Zero keeps them regardless of their number.
+	MaxPerPlan int `toml:"max_per_plan"`
+	// FailedMaxAge is how long failed tasks are kept for after completing,
+	// regardless of MaxAge and MaxPerPlan, so that they can be investigated;
+	// it can't be shorter than MaxAge. Zero applies the same policy as other
+	// tasks.
+	FailedMaxAge string `toml:"failed_max_age"`
+	// Interval is how often the policy is applied; one hour by default.
+	Interval string `toml:"interval"`
+}
+
+// ScheduleConfig is a composition the daemon runs on a recurring schedule.
+type ScheduleConfig struct {
+	// ID identifies the schedule. Runs queued by the schedule are recorded as
+	// created by "schedule:<id>".
+	ID string `toml:"id"`
+	// Cron is the cron expression to queue runs on, with five fields (e.g.
+	// "0 2 * * *"), or a descriptor such as "@daily".
+	Cron string `toml:"cron"`
+	// Composition is the path to the composition file to run. Its test plan
+	// is resolved under the plans directory, and its sources are read every
+	// time a run is queued. Templates, extends and matrices aren't supported.
+	Composition string `toml:"composition"`
 }
 
 type SchedulerConfig struct {
@@ -50,6 +90,64 @@ type SchedulerConfig struct {
 	QueueSize      int    `toml:"queue_size"`
 	TaskRepoType   string `toml:"task_repo_type"`
 	TaskTimeoutMin int    `toml:"task_timeout_min"`
+
+	// Capacity overrides the resources available to test instances on each
+	// runner, keyed by runner ID. Runs are only started once the resources
+	// they demand are available.
+	Capacity map[string]CapacityConfig `toml:"capacity"`
+
+	// Limits caps the number of tasks processed at once.
+	Limits LimitsConfig `toml:"limits"`
+
+	// Retry is the default policy to retry tasks failing because of an
+	// infrastructure error with. Compositions can override it.
+	Retry RetryConfig `toml:"retry"`
+}
+
+// RetryConfig is a policy to retry tasks failing because of an
+// infrastructure error with.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. Zero or one disable retries.
+	MaxAttempts int `toml:"max_attempts"`
+	// Backoff is the delay before the first retry (e.g. "30s"). It doubles on
+	// every retry.
+	Backoff string `toml:"backoff"`
+	// MaxBackoff caps the delay between retries (e.g. "10m").
+	MaxBackoff string `toml:"max_backoff"`
+	// On lists the classes of errors to retry on; all of them if empty.
+	On []string `toml:"on"`
+}
+
+// LimitsConfig caps the number of tasks processed at once. Zero values denote
+// no limit.
+type LimitsConfig struct {
+	// PerRunner is the maximum number of tasks processed at once by each
+	// runner, keyed by runner ID.
+	PerRunner map[string]int `toml:"per_runner"`
+	// PerUser is the maximum number of tasks processed at once for each user.
+	PerUser int `toml:"per_user"`
+	// PerRepo is the maximum number of tasks processed at once for each
+	// repository.
+	PerRepo int `toml:"per_repo"`
+}
+
+// CapacityConfig is the capacity of a runner. Fields left unset fall back to
+// the capacity reported by the runner, if any; otherwise, they're unlimited.
+type CapacityConfig struct {
+	// CPUs is the number of CPU cores available to test instances.
+	CPUs float64 `toml:"cpus"`
+	// Memory is the memory available to test instances, as a quantity (e.g.
+	// "64Gi").
+	Memory string `toml:"memory"`
+	// Instances is the maximum number of test instances running at once.
+	Instances int `toml:"instances"`
+	// InstanceCPUs is the number of CPU cores an instance is allotted when
+	// its group requests none.
+	InstanceCPUs float64 `toml:"instance_cpus"`
+	// InstanceMemory is the memory an instance is allotted when its group
+	// requests none.
+	InstanceMemory string `toml:"instance_memory"`
 }
 
 type ClientConfig struct {
@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) exportTasksHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Infow("handle request", "command", "tasks export")
+		defer log.Infow("request handled", "command", "tasks export")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.ExportRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("tasks export json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// the bundle is streamed in binary chunks of the buffer size, rather
+		// than one per tar block.
+		bw := bufio.NewWriterSize(tgw.BinaryWriter(), 1<<20)
+		report, err := engine.ExportTasks(req, bw)
+		if err == nil {
+			err = bw.Flush()
+		}
+		if err != nil {
+			tgw.WriteError("could not export tasks", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(report)
+	}
+}
+
+func (d *Daemon) importTasksHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Infow("handle request", "command", "tasks import")
+		defer log.Infow("request handled", "command", "tasks import")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		report, err := engine.ImportTasks(r.Body)
+		if err != nil {
+			tgw.WriteError("could not import tasks", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(report)
+	}
+}
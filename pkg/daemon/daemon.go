@@ -97,8 +97,16 @@ func New(cfg *config.EnvConfig) (srv *Daemon, err error) {
 	r.HandleFunc("/terminate", srv.terminateHandler(engine)).Methods("POST")
 	r.HandleFunc("/healthcheck", srv.healthcheckHandler(engine)).Methods("POST")
 	r.HandleFunc("/tasks", srv.tasksHandler(engine)).Methods("POST")
+	r.HandleFunc("/tasks/branches", srv.branchesHandler(engine)).Methods("POST")
+	r.HandleFunc("/tasks/last-green", srv.lastGreenHandler(engine)).Methods("POST")
+	r.HandleFunc("/tasks/export", srv.exportTasksHandler(engine)).Methods("POST")
+	r.HandleFunc("/tasks/import", srv.importTasksHandler(engine)).Methods("POST")
 	r.HandleFunc("/status", srv.statusHandler(engine)).Methods("POST")
 	r.HandleFunc("/logs", srv.logsHandler(engine)).Methods("POST")
+	r.HandleFunc("/schedules", srv.scheduleHandler(engine)).Methods("POST")
+	r.HandleFunc("/schedules/list", srv.listSchedulesHandler(engine)).Methods("POST")
+	r.HandleFunc("/schedules/delete", srv.deleteScheduleHandler(engine)).Methods("POST")
+	r.HandleFunc("/gc", srv.gcHandler(engine)).Methods("POST")
 
 	srv.doneCh = make(chan struct{})
 	srv.server = &http.Server{
@@ -0,0 +1,37 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) gcHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Infow("handle request", "command", "gc")
+		defer log.Infow("request handled", "command", "gc")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.GCRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("gc json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		report, err := engine.GC(!req.Apply)
+		if err != nil {
+			tgw.WriteError("could not collect garbage", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(report)
+	}
+}
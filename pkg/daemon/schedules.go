@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) scheduleHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ruid := r.Header.Get("X-Request-ID")
+		log := logging.S().With("req_id", ruid)
+
+		log.Infow("handle request", "command", "schedule")
+		defer log.Infow("request handled", "command", "schedule")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		// Create a packing directory under the workdir; the engine keeps a
+		// copy of the sources, so it's removed once done.
+		dir := filepath.Join(engine.EnvConfig().Dirs().Work(), "requests", ruid)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tgw.WriteError("failed to create temp directory to unpack request", "err", err)
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		var request *api.ScheduleRequest
+		sources, err := consumeRunBuildRequest(r, &request, dir)
+		if err != nil {
+			tgw.WriteError("failed to consume request", "err", err)
+			return
+		}
+
+		if len(request.Run.BuildGroups) > 0 && sources == nil {
+			tgw.WriteError("failed to consume request", "err", errors.New("plan dir required for build"))
+			return
+		}
+
+		if err := engine.AddSchedule(request, sources); err != nil {
+			tgw.WriteError(fmt.Sprintf("engine schedule error: %s", err))
+			return
+		}
+
+		tgw.WriteResult(request.ID)
+	}
+}
+
+func (d *Daemon) listSchedulesHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "schedule list")
+		defer log.Debugw("request handled", "command", "schedule list")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		schedules, err := engine.Schedules()
+		if err != nil {
+			tgw.WriteError("could not list schedules", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(schedules)
+	}
+}
+
+func (d *Daemon) deleteScheduleHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "schedule delete")
+		defer log.Debugw("request handled", "command", "schedule delete")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.ScheduleDeleteRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("schedule delete json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := engine.DeleteSchedule(req.ID); err != nil {
+			tgw.WriteError("could not delete schedule", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult("schedule deleted")
+	}
+}
@@ -3,8 +3,11 @@ package daemon
 import (
 	"encoding/json"
 	"fmt"
+	"html"
 	"html/template"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -21,6 +24,7 @@ const (
 	EmojiSuccess    string = "&#9989;"
 	EmojiCanceled   string = "&#9898;"
 	EmojiFailure    string = "&#10060;"
+	EmojiTimeout    string = "&#9201;"
 	EmojiInProgress string = "&#9203;"
 	EmojiScheduled  string = "&#128338;"
 )
@@ -39,7 +43,7 @@ func (d *Daemon) tasksHandler(engine api.Engine) func(w http.ResponseWriter, r *
 
 		tasks, err := engine.Tasks(req)
 		if err != nil {
-			tgw.WriteError("tasks json decode", "err", err.Error())
+			tgw.WriteError("could not list tasks", "err", err.Error())
 			return
 		}
 
@@ -47,6 +51,50 @@ func (d *Daemon) tasksHandler(engine api.Engine) func(w http.ResponseWriter, r *
 	}
 }
 
+func (d *Daemon) branchesHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.BranchesRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("branches json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		branches, err := engine.Branches(req.Repo)
+		if err != nil {
+			tgw.WriteError("could not summarize branches", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(branches)
+	}
+}
+
+func (d *Daemon) lastGreenHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.LastGreenRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("last green json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tsk, err := engine.LastGreen(req.Repo, req.Branch, req.Plan)
+		if err != nil {
+			tgw.WriteError("could not find the last green run", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(tsk)
+	}
+}
+
 func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
@@ -56,11 +104,11 @@ func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter,
 
 		w.Header().Set("Content-Type", "text/html")
 
-		before := time.Now().Add(-7 * 24 * time.Hour)
+		since := time.Now().Add(-7 * 24 * time.Hour)
 		req := api.TasksRequest{
 			Types:  []task.Type{task.TypeBuild, task.TypeRun},
 			States: []task.State{task.StateScheduled, task.StateProcessing, task.StateComplete},
-			Before: &before,
+			Since:  &since,
 		}
 
 		tasks, err := engine.Tasks(req)
@@ -106,6 +154,7 @@ func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter,
 				Updated   string
 				Took      string
 				Outcomes  string
+				Matrix    string
 				Status    string
 				Error     string
 				Actions   string
@@ -117,6 +166,7 @@ func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter,
 				t.State().Created.Format(tf),
 				t.Took().String(),
 				result.StringOutcomes(),
+				dependencyMatrixHTML(result),
 				"",
 				t.Error,
 				"",
@@ -125,14 +175,7 @@ func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter,
 
 			switch t.State().State {
 			case task.StateComplete:
-				switch outcome {
-				case task.OutcomeSuccess:
-					currentTask.Status = EmojiSuccess
-				case task.OutcomeFailure:
-					currentTask.Status = EmojiFailure
-				default:
-					currentTask.Status = EmojiFailure
-				}
+				currentTask.Status = outcomeEmoji(outcome)
 			case task.StateCanceled:
 				currentTask.Status = EmojiCanceled
 			case task.StateProcessing:
@@ -142,6 +185,12 @@ func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter,
 			case task.StateScheduled:
 				currentTask.Status = EmojiScheduled
 				currentTask.Took = ""
+				if q := t.Queue; q != nil {
+					currentTask.Status += fmt.Sprintf("<br/>#%d in queue", q.Position)
+					if !q.EstimatedStart.IsZero() {
+						currentTask.Status += fmt.Sprintf("<br/>ETA %s", q.EstimatedStart.Format(tf))
+					}
+				}
 			}
 
 			tdata.Tasks = append(tdata.Tasks, currentTask)
@@ -170,6 +219,40 @@ func (d *Daemon) redirect() func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// outcomeEmoji returns the emoji representing the outcome of a completed task.
+func outcomeEmoji(outcome task.Outcome) string {
+	switch outcome {
+	case task.OutcomeSuccess:
+		return EmojiSuccess
+	case task.OutcomeTimeout:
+		return EmojiTimeout
+	case task.OutcomeCanceled:
+		return EmojiCanceled
+	default:
+		return EmojiFailure
+	}
+}
+
+// dependencyMatrixHTML renders the dependency matrix report of a run, one
+// combination of versions per line, or an empty string if it has none.
+func dependencyMatrixHTML(result *runner.Result) string {
+	lines := make([]string, 0, len(result.DependencyMatrix))
+	for _, m := range result.DependencyMatrix {
+		mods := make([]string, 0, len(m.Versions))
+		for mod := range m.Versions {
+			mods = append(mods, mod)
+		}
+		sort.Strings(mods)
+
+		versions := make([]string, 0, len(mods))
+		for _, mod := range mods {
+			versions = append(versions, html.EscapeString(mod+"@"+m.Versions[mod]))
+		}
+		lines = append(lines, outcomeEmoji(m.Outcome)+" "+strings.Join(versions, ", "))
+	}
+	return strings.Join(lines, "<br/>")
+}
+
 func unescape(s string) template.HTML {
 	return template.HTML(s)
 }
@@ -41,7 +41,11 @@ func DecodeTaskOutcome(t *task.Task) (task.Outcome, error) {
 
 	switch t.Type {
 	case task.TypeBuild:
-		// As of today a build that completed is successful. No need to check the result.
+		// A build that completed is successful, unless it timed out; the
+		// result of successful builds is the list of their artifacts.
+		if res, ok := t.Result.(map[string]interface{}); ok {
+			return DecodeRunnerResult(res).Outcome, nil
+		}
 		return task.OutcomeSuccess, nil
 	case task.TypeRun:
 		return DecodeRunnerResult(t.Result).Outcome, nil
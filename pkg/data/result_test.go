@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -119,3 +120,29 @@ func TestDecodeTaskOutcomeWithLocalExecRunner(t *testing.T) {
 	assert.Equal(t, task.OutcomeSuccess, r)
 	assert.Nil(t, e)
 }
+
+func TestDecodeResultWithStages(t *testing.T) {
+	result := &runner.Result{
+		Outcome: task.OutcomeFailure,
+		Stages: []*runner.StageResult{
+			{Case: "setup", RunID: "c0ab-0", Outcome: task.OutcomeSuccess},
+			{Case: "soak", RunID: "c0ab-1", Outcome: task.OutcomeFailure, Error: "boom"},
+			{Case: "teardown", RunID: "c0ab-2", Outcome: runner.OutcomeSkipped},
+		},
+	}
+
+	// results are persisted as JSON, and decoded as generic maps.
+	b, err := json.Marshal(result)
+	assert.Nil(t, err)
+	var generic interface{}
+	assert.Nil(t, json.Unmarshal(b, &generic))
+
+	for _, in := range []interface{}{result, generic} {
+		r := DecodeRunnerResult(in)
+		assert.Equal(t, task.OutcomeFailure, r.Outcome)
+		assert.Len(t, r.Stages, 3)
+		assert.Equal(t, "c0ab-1", r.Stages[1].RunID)
+		assert.Equal(t, "boom", r.Stages[1].Error)
+		assert.Equal(t, runner.OutcomeSkipped, r.Stages[2].Outcome)
+	}
+}
@@ -0,0 +1,300 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// capacityTTL is how long the capacity reported by a runner is cached for.
+const capacityTTL = 30 * time.Second
+
+// errCapacityPending is returned while the capacity of a runner is fetched
+// for the first time.
+var errCapacityPending = errors.New("capacity of runner not known yet")
+
+// cachedCapacity is the capacity reported by a runner for a configuration, or
+// the error reporting it.
+type cachedCapacity struct {
+	total    api.Capacity
+	instance api.Capacity
+	err      error
+	expires  time.Time
+}
+
+// admission admits run tasks once the runner they target has the resources
+// they demand available. Resources are reserved when a task is admitted, and
+// released when it completes.
+//
+// Build tasks, and runs targeting runners with no known capacity, are always
+// admitted.
+//
+// Admit is called with the queue locked, so it never waits on runners: the
+// capacity they report is cached, and refreshed in the background.
+type admission struct {
+	e *Engine
+
+	lk           sync.Mutex
+	reserved     map[string]api.Capacity // resources reserved, by runner
+	reservations map[string]api.Capacity // resources reserved, by task
+	capacities   map[string]cachedCapacity
+	refreshing   map[string]bool // configurations whose capacity is being fetched
+	refreshes    sync.WaitGroup
+}
+
+var _ task.Admission = (*admission)(nil)
+
+func newAdmission(e *Engine) *admission {
+	return &admission{
+		e:            e,
+		reserved:     make(map[string]api.Capacity),
+		reservations: make(map[string]api.Capacity),
+		capacities:   make(map[string]cachedCapacity),
+		refreshing:   make(map[string]bool),
+	}
+}
+
+// Admit admits the task if the resources it demands fit within the capacity
+// of its runner, on top of those reserved by the tasks already admitted. A
+// task is always admitted on an idle runner, even if it demands more than
+// the runner's capacity, so that it doesn't wait forever; the runner decides
+// whether it can proceed.
+func (a *admission) Admit(tsk *task.Task) bool {
+	if tsk.Type != task.TypeRun {
+		return true
+	}
+
+	total, demand, err := a.demand(tsk)
+	if errors.Is(err, errCapacityPending) {
+		logging.S().Debugw("task not admitted; waiting for the capacity of its runner", "task_id", tsk.ID, "runner", tsk.Runner)
+		return false
+	}
+	if err != nil {
+		logging.S().Warnw("could not determine demand of task; admitting", "task_id", tsk.ID, "runner", tsk.Runner, "err", err)
+		return true
+	}
+	if total.IsZero() || demand.IsZero() {
+		return true
+	}
+
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	reserved := a.reserved[tsk.Runner]
+	if !reserved.IsZero() && !total.Admits(reserved, demand) {
+		logging.S().Debugw("task not admitted; waiting for resources", "task_id", tsk.ID, "runner", tsk.Runner, "demand", demand, "reserved", reserved, "capacity", total)
+		return false
+	}
+
+	a.reserved[tsk.Runner] = reserved.Add(demand)
+	a.reservations[tsk.ID] = demand
+	return true
+}
+
+// Release frees the resources reserved for the task, if any.
+func (a *admission) Release(tsk *task.Task) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	demand, ok := a.reservations[tsk.ID]
+	if !ok {
+		return
+	}
+	delete(a.reservations, tsk.ID)
+
+	if reserved := a.reserved[tsk.Runner].Sub(demand); reserved.IsZero() {
+		delete(a.reserved, tsk.Runner)
+	} else {
+		a.reserved[tsk.Runner] = reserved
+	}
+}
+
+// demand returns the capacity of the runner targeted by the run task, and the
+// resources the task demands from it.
+func (a *admission) demand(tsk *task.Task) (total api.Capacity, demand api.Capacity, err error) {
+	input, ok := tsk.Input.(*RunInput)
+	if !ok || input.RunRequest == nil {
+		return total, demand, fmt.Errorf("unexpected input type: %T", tsk.Input)
+	}
+	comp := &input.Composition
+
+	total, instance, err := a.capacity(tsk.Runner, comp)
+	if err != nil || total.IsZero() {
+		return total, demand, err
+	}
+
+	for _, g := range comp.Groups {
+		count := int(g.Instances.Count)
+		if count == 0 && g.Instances.Percentage > 0 {
+			count = int(math.Round(g.Instances.Percentage * float64(comp.Global.TotalInstances)))
+		}
+
+		cpus, memory := instance.CPUs, instance.Memory
+		if g.Resources.CPU != "" {
+			q, err := resource.ParseQuantity(g.Resources.CPU)
+			if err != nil {
+				return total, demand, fmt.Errorf("invalid cpu resources for group %s: %w", g.ID, err)
+			}
+			cpus = float64(q.MilliValue()) / 1000
+		}
+		if g.Resources.Memory != "" {
+			q, err := resource.ParseQuantity(g.Resources.Memory)
+			if err != nil {
+				return total, demand, fmt.Errorf("invalid memory resources for group %s: %w", g.ID, err)
+			}
+			memory = q.Value()
+		}
+
+		demand = demand.Add(api.Capacity{
+			CPUs:      cpus * float64(count),
+			Memory:    memory * int64(count),
+			Instances: count,
+		})
+	}
+
+	if demand.Instances == 0 {
+		demand.Instances = int(comp.Global.TotalInstances)
+	}
+	return total, demand, nil
+}
+
+// capacity returns the capacity of the runner, and the resources allotted to
+// instances that don't request any, for the run configuration of the
+// composition. The capacity reported by the runner, if it is a
+// CapacityReporter, is cached for capacityTTL; values configured in the
+// scheduler configuration take precedence.
+//
+// Expired capacities are refreshed in the background, and used until then;
+// errCapacityPending is returned until the runner first reports its capacity.
+func (a *admission) capacity(runner string, comp *api.Composition) (total api.Capacity, instance api.Capacity, err error) {
+	total, instance, err = a.configuredCapacity(runner)
+	if err != nil {
+		return total, instance, err
+	}
+
+	run, ok := a.e.runners[runner]
+	if !ok {
+		return total, instance, nil
+	}
+	reporter, ok := run.(api.CapacityReporter)
+	if !ok {
+		return total, instance, nil
+	}
+
+	var cfg config.CoalescedConfig
+	cfg = cfg.Append(a.e.envcfg.Runners[runner])
+	cfg = cfg.Append(comp.Global.RunConfig)
+	obj, err := cfg.CoalesceIntoType(run.ConfigType())
+	if err != nil {
+		return total, instance, fmt.Errorf("error while coalescing configuration values: %w", err)
+	}
+
+	key, err := json.Marshal(obj)
+	if err != nil {
+		return total, instance, err
+	}
+	key = append([]byte(runner+"/"), key...)
+
+	a.lk.Lock()
+	cached, ok := a.capacities[string(key)]
+	if !ok || time.Now().After(cached.expires) {
+		a.refresh(string(key), runner, reporter, obj)
+	}
+	a.lk.Unlock()
+
+	switch {
+	case !ok:
+		return total, instance, errCapacityPending
+	case cached.err != nil:
+		return total, instance, cached.err
+	}
+	return mergeCapacity(total, cached.total), mergeCapacity(instance, cached.instance), nil
+}
+
+// refresh fetches the capacity of the runner for the configuration cached
+// under key in the background, unless it's already being fetched, and wakes
+// up the queue once done. a.lk must be locked.
+func (a *admission) refresh(key string, runner string, reporter api.CapacityReporter, obj interface{}) {
+	if a.refreshing[key] {
+		return
+	}
+	a.refreshing[key] = true
+	a.refreshes.Add(1)
+
+	go func() {
+		defer a.refreshes.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var cached cachedCapacity
+		cached.total, cached.instance, cached.err = reporter.Capacity(ctx, obj)
+		if cached.err != nil {
+			cached.err = fmt.Errorf("could not get capacity of runner %s: %w", runner, cached.err)
+		}
+		cached.expires = time.Now().Add(capacityTTL)
+
+		a.lk.Lock()
+		a.capacities[key] = cached
+		delete(a.refreshing, key)
+		a.lk.Unlock()
+
+		if a.e.queue != nil {
+			a.e.queue.Notify()
+		}
+	}()
+}
+
+// configuredCapacity returns the capacity of the runner set in the scheduler
+// configuration, if any.
+func (a *admission) configuredCapacity(runner string) (total api.Capacity, instance api.Capacity, err error) {
+	cfg, ok := a.e.envcfg.Daemon.Scheduler.Capacity[runner]
+	if !ok {
+		return total, instance, nil
+	}
+
+	total.CPUs, total.Instances = cfg.CPUs, cfg.Instances
+	if cfg.Memory != "" {
+		q, err := resource.ParseQuantity(cfg.Memory)
+		if err != nil {
+			return total, instance, fmt.Errorf("invalid memory capacity for runner %s: %w", runner, err)
+		}
+		total.Memory = q.Value()
+	}
+
+	instance.CPUs = cfg.InstanceCPUs
+	if cfg.InstanceMemory != "" {
+		q, err := resource.ParseQuantity(cfg.InstanceMemory)
+		if err != nil {
+			return total, instance, fmt.Errorf("invalid instance memory for runner %s: %w", runner, err)
+		}
+		instance.Memory = q.Value()
+	}
+	return total, instance, nil
+}
+
+// mergeCapacity returns the preferred capacity, with unset fields taken from
+// the fallback.
+func mergeCapacity(preferred, fallback api.Capacity) api.Capacity {
+	if preferred.CPUs <= 0 {
+		preferred.CPUs = fallback.CPUs
+	}
+	if preferred.Memory <= 0 {
+		preferred.Memory = fallback.Memory
+	}
+	if preferred.Instances <= 0 {
+		preferred.Instances = fallback.Instances
+	}
+	return preferred
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+// capacityRunner is a fakeRunner reporting a fixed capacity; if block is
+// set, only once it's closed.
+type capacityRunner struct {
+	fakeRunner
+	total, instance api.Capacity
+	calls           int
+	block           chan struct{}
+}
+
+var _ api.CapacityReporter = (*capacityRunner)(nil)
+
+func (r *capacityRunner) Capacity(context.Context, interface{}) (api.Capacity, api.Capacity, error) {
+	r.calls++
+	if r.block != nil {
+		<-r.block
+	}
+	return r.total, r.instance, nil
+}
+
+func admissionTask(id string, groups ...*api.Group) *task.Task {
+	return &task.Task{
+		ID:     id,
+		Type:   task.TypeRun,
+		Runner: "fake",
+		Input: &RunInput{
+			RunRequest: &api.RunRequest{
+				Composition: api.Composition{
+					Global: api.Global{Runner: "fake", TotalInstances: 4},
+					Groups: groups,
+				},
+			},
+		},
+	}
+}
+
+func TestAdmissionReservesReportedCapacity(t *testing.T) {
+	r := &capacityRunner{
+		total:    api.Capacity{CPUs: 4},
+		instance: api.Capacity{CPUs: 1},
+	}
+	a := newAdmission(&Engine{
+		runners: map[string]api.Runner{"fake": r},
+		envcfg:  &config.EnvConfig{},
+	})
+
+	var (
+		t1 = admissionTask("t1", &api.Group{ID: "a", Instances: api.Instances{Count: 3}})
+		t2 = admissionTask("t2", &api.Group{ID: "a", Instances: api.Instances{Percentage: 0.5}})
+		t3 = admissionTask("t3", &api.Group{ID: "a", Instances: api.Instances{Count: 2}, Resources: api.Resources{CPU: "500m"}})
+		t4 = &task.Task{ID: "t4", Type: task.TypeBuild, Runner: "fake"}
+	)
+
+	// tasks wait for the capacity of the runner to be known.
+	require.False(t, a.Admit(t1))
+	a.refreshes.Wait()
+	require.True(t, a.Admit(t1))
+	// 3 + 2 CPUs exceed the capacity.
+	require.False(t, a.Admit(t2))
+	// 3 + 2 * 0.5 CPUs fit.
+	require.True(t, a.Admit(t3))
+	// builds demand no capacity.
+	require.True(t, a.Admit(t4))
+
+	a.Release(t1)
+	require.True(t, a.Admit(t2))
+
+	a.Release(t2)
+	a.Release(t3)
+	require.Empty(t, a.reserved)
+	require.Empty(t, a.reservations)
+
+	// the reported capacity is cached.
+	require.Equal(t, 1, r.calls)
+}
+
+func TestAdmissionConfiguredCapacity(t *testing.T) {
+	r := &capacityRunner{
+		total:    api.Capacity{CPUs: 4, Instances: 100},
+		instance: api.Capacity{CPUs: 1},
+	}
+	a := newAdmission(&Engine{
+		runners: map[string]api.Runner{"fake": r},
+		envcfg: &config.EnvConfig{
+			Daemon: config.DaemonConfig{
+				Scheduler: config.SchedulerConfig{
+					Capacity: map[string]config.CapacityConfig{
+						"fake": {Instances: 4, Memory: "1Gi", InstanceMemory: "256Mi"},
+					},
+				},
+			},
+		},
+	})
+
+	var (
+		t1 = admissionTask("t1", &api.Group{ID: "a", Instances: api.Instances{Count: 6}})
+		t2 = admissionTask("t2", &api.Group{ID: "a", Instances: api.Instances{Count: 1}})
+		t3 = admissionTask("t3", &api.Group{ID: "a", Instances: api.Instances{Count: 2}})
+		t4 = admissionTask("t4", &api.Group{ID: "a", Instances: api.Instances{Count: 1}, Resources: api.Resources{Memory: "512Mi"}})
+	)
+
+	require.False(t, a.Admit(t1))
+	a.refreshes.Wait()
+
+	// tasks exceeding the capacity are admitted on an idle runner.
+	require.True(t, a.Admit(t1))
+	require.False(t, a.Admit(t2))
+	a.Release(t1)
+
+	// 2 instances of 256Mi, and 4 CPUs reported by the runner.
+	require.True(t, a.Admit(t3))
+	// 2 * 256Mi + 512Mi fit in 1Gi.
+	require.True(t, a.Admit(t4))
+	// a fourth instance still fits the instance limit, but not the memory.
+	require.False(t, a.Admit(t2))
+}
+
+func TestAdmissionDoesNotWaitForRunners(t *testing.T) {
+	r := &capacityRunner{
+		total:    api.Capacity{CPUs: 4},
+		instance: api.Capacity{CPUs: 1},
+		block:    make(chan struct{}),
+	}
+	a := newAdmission(&Engine{
+		runners: map[string]api.Runner{"fake": r},
+		envcfg:  &config.EnvConfig{},
+	})
+	t1 := admissionTask("t1", &api.Group{ID: "a", Instances: api.Instances{Count: 1}})
+
+	// the capacity is fetched once in the background, while tasks wait.
+	require.False(t, a.Admit(t1))
+	require.False(t, a.Admit(t1))
+	close(r.block)
+	a.refreshes.Wait()
+	require.True(t, a.Admit(t1))
+	require.Equal(t, 1, r.calls)
+
+	// expired capacities are used while they are refreshed.
+	a.Release(t1)
+	a.lk.Lock()
+	cached := a.capacities[firstKey(a.capacities)]
+	cached.expires = time.Now().Add(-time.Second)
+	a.capacities[firstKey(a.capacities)] = cached
+	a.lk.Unlock()
+	require.True(t, a.Admit(t1))
+	a.refreshes.Wait()
+	require.Equal(t, 2, r.calls)
+}
+
+// firstKey returns a key of the capacities cached.
+func firstKey(m map[string]cachedCapacity) string {
+	for k := range m {
+		return k
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
+)
+
+// bundleTasks is the name of the JSON-lines file holding the tasks of a
+// bundle. It comes first in the archive, so that the logs and outputs that
+// follow can be matched against the tasks imported.
+const bundleTasks = "tasks.jsonl"
+
+// maxTaskSize is the size of the largest task document accepted on import.
+const maxTaskSize = 64 << 20
+
+// ExportTasks writes a bundle of the complete tasks selected by the request,
+// with their logs and, if requested, the outputs collected on this host.
+func (e *Engine) ExportTasks(req api.ExportRequest, w io.Writer) (*api.ExportReport, error) {
+	filters := req.Filters
+	for _, state := range filters.States {
+		if state != task.StateComplete {
+			return nil, fmt.Errorf("only complete tasks can be exported")
+		}
+	}
+	filters.States = []task.State{task.StateComplete}
+	if filters.Order == "" {
+		filters.Order = api.TasksOldestFirst
+	}
+
+	tsks, err := e.Tasks(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dirs   = e.envcfg.Dirs()
+		tw     = tar.NewWriter(w)
+		lines  bytes.Buffer
+		report = &api.ExportReport{Tasks: make([]string, 0, len(tsks))}
+	)
+	for i := range tsks {
+		b, err := json.Marshal(&tsks[i])
+		if err != nil {
+			return nil, err
+		}
+		lines.Write(b)
+		lines.WriteByte('\n')
+		report.Tasks = append(report.Tasks, tsks[i].ID)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    bundleTasks,
+		Mode:    0644,
+		Size:    int64(lines.Len()),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(lines.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for i := range tsks {
+		tsk := &tsks[i]
+
+		log := filepath.Join(dirs.Daemon(), tsk.ID+".out")
+		switch err := addTarFile(tw, log, path.Join("logs", tsk.ID+".out")); {
+		case err == nil:
+			report.Logs++
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+
+		if !req.Outputs {
+			continue
+		}
+		runs, err := runOutputsDirs(dirs.Outputs(), tsk)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range runs {
+			err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+				if err != nil || !fi.Mode().IsRegular() {
+					return err
+				}
+				rel, err := filepath.Rel(dirs.Outputs(), p)
+				if err != nil {
+					return err
+				}
+				if err := addTarFile(tw, p, path.Join("outputs", tsk.ID, filepath.ToSlash(rel))); err != nil {
+					return err
+				}
+				report.Outputs++
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, tw.Close()
+}
+
+// addTarFile writes the file at path to the archive under the given name.
+func addTarFile(tw *tar.Writer, path string, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
+// ImportTasks reads a bundle written by ExportTasks, and stores the tasks it
+// holds, upgraded to the current schema version. Tasks already stored are
+// skipped, along with their logs and outputs.
+func (e *Engine) ImportTasks(r io.Reader) (*api.ImportReport, error) {
+	var (
+		dirs     = e.envcfg.Dirs()
+		tr       = tar.NewReader(r)
+		imported = make(map[string]bool)
+		report   = &api.ImportReport{Imported: []string{}, Skipped: []string{}}
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		switch dir, file := path.Split(name); {
+		case name == bundleTasks:
+			if err := e.importTasks(tr, imported, report); err != nil {
+				return nil, err
+			}
+
+		case dir == "logs/" && strings.HasSuffix(file, ".out") && imported[strings.TrimSuffix(file, ".out")]:
+			if err := extractTarFile(tr, filepath.Join(dirs.Daemon(), file), hdr); err != nil {
+				return nil, err
+			}
+			report.Logs++
+
+		case strings.HasPrefix(name, "outputs/"):
+			// outputs/<task id>/<runner>/<plan>/<run id>/...
+			parts := strings.Split(name, "/")
+			if len(parts) < 6 || !imported[parts[1]] {
+				continue
+			}
+			if run := parts[4]; run != parts[1] && !strings.HasPrefix(run, parts[1]+"-") {
+				return nil, fmt.Errorf("invalid path in bundle: %s", hdr.Name)
+			}
+			dst := filepath.Join(dirs.Outputs(), filepath.FromSlash(path.Join(parts[2:]...)))
+			if !isSubdir(dirs.Outputs(), dst) {
+				return nil, fmt.Errorf("invalid path in bundle: %s", hdr.Name)
+			}
+			if err := extractTarFile(tr, dst, hdr); err != nil {
+				return nil, err
+			}
+			report.Outputs++
+		}
+	}
+	return report, nil
+}
+
+// importTasks stores the tasks read from the JSON-lines file of a bundle,
+// recording the IDs of those imported.
+func (e *Engine) importTasks(r io.Reader, imported map[string]bool, report *api.ImportReport) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxTaskSize)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		val, err := task.Migrate(line)
+		if err != nil {
+			return err
+		}
+		tsk := &task.Task{}
+		if err := json.Unmarshal(val, tsk); err != nil {
+			return fmt.Errorf("invalid task in bundle: %w", err)
+		}
+		if _, err := xid.FromString(tsk.ID); err != nil {
+			return fmt.Errorf("invalid task ID in bundle: %q", tsk.ID)
+		}
+		if len(tsk.States) == 0 || (tsk.State().State != task.StateComplete && tsk.State().State != task.StateCanceled) {
+			return fmt.Errorf("task %s in bundle is not complete", tsk.ID)
+		}
+
+		switch _, err := e.store.Get(tsk.ID); {
+		case err == nil:
+			report.Skipped = append(report.Skipped, tsk.ID)
+			continue
+		case err != task.ErrNotFound:
+			return err
+		}
+		if err := e.store.PersistComplete(tsk); err != nil {
+			return err
+		}
+		imported[tsk.ID] = true
+		report.Imported = append(report.Imported, tsk.ID)
+	}
+	return sc.Err()
+}
+
+// extractTarFile writes the current file of the archive to path.
+func extractTarFile(tr *tar.Reader, path string, hdr *tar.Header) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestExportImportTasks(t *testing.T) {
+	var (
+		src = homeEngine(t)
+		dst = homeEngine(t)
+		now = time.Now()
+	)
+
+	writeFile := func(path string, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	// newTask stores a run created ago; unless scheduled, the run is complete.
+	newTask := func(e *Engine, ago time.Duration, scheduled bool) *task.Task {
+		created := now.Add(-ago)
+		tsk := &task.Task{
+			Version: task.CurrentVersion,
+			ID:      xid.NewWithTime(created).String(),
+			Type:    task.TypeRun,
+			Plan:    "ping",
+			Case:    "case",
+			Runner:  "local:docker",
+			States:  []task.DatedState{{State: task.StateScheduled, Created: created}},
+		}
+		if scheduled {
+			require.NoError(t, e.store.PersistScheduled(tsk))
+			return tsk
+		}
+		tsk.States = append(tsk.States, task.DatedState{State: task.StateComplete, Created: created.Add(time.Minute)})
+		tsk.Result = map[string]interface{}{"outcome": task.OutcomeSuccess}
+		require.NoError(t, e.store.PersistComplete(tsk))
+		return tsk
+	}
+
+	var (
+		older     = newTask(src, 2*time.Hour, false)
+		newer     = newTask(src, time.Hour, false)
+		scheduled = newTask(src, 0, true)
+	)
+	writeFile(filepath.Join(src.envcfg.Dirs().Daemon(), older.ID+".out"), "older log")
+	writeFile(filepath.Join(src.envcfg.Dirs().Daemon(), newer.ID+".out"), "newer log")
+	output := filepath.Join("local_docker", "ping", StageRunID(newer.ID, 0), "single", "0", "run.out")
+	writeFile(filepath.Join(src.envcfg.Dirs().Outputs(), output), "newer output")
+
+	var bundle bytes.Buffer
+	report, err := src.ExportTasks(api.ExportRequest{Outputs: true}, &bundle)
+	require.NoError(t, err)
+	require.Equal(t, &api.ExportReport{Tasks: []string{older.ID, newer.ID}, Logs: 2, Outputs: 1}, report)
+
+	// only complete tasks are exported.
+	_, err = src.ExportTasks(api.ExportRequest{Filters: api.TasksFilters{States: []task.State{task.StateScheduled}}}, ioutil.Discard)
+	require.Error(t, err)
+	_, err = dst.store.Get(scheduled.ID)
+	require.Equal(t, task.ErrNotFound, err)
+
+	// tasks already stored are skipped, along with their logs and outputs.
+	require.NoError(t, dst.store.PersistComplete(older))
+	imported, err := dst.ImportTasks(bytes.NewReader(bundle.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, &api.ImportReport{Imported: []string{newer.ID}, Skipped: []string{older.ID}, Logs: 1, Outputs: 1}, imported)
+
+	tsk, err := dst.store.Get(newer.ID)
+	require.NoError(t, err)
+	require.Equal(t, newer.ID, tsk.ID)
+	require.Equal(t, task.StateComplete, tsk.State().State)
+
+	log, err := ioutil.ReadFile(filepath.Join(dst.envcfg.Dirs().Daemon(), newer.ID+".out"))
+	require.NoError(t, err)
+	require.Equal(t, "newer log", string(log))
+	require.NoFileExists(t, filepath.Join(dst.envcfg.Dirs().Daemon(), older.ID+".out"))
+	out, err := ioutil.ReadFile(filepath.Join(dst.envcfg.Dirs().Outputs(), output))
+	require.NoError(t, err)
+	require.Equal(t, "newer output", string(out))
+
+	// importing twice imports nothing.
+	imported, err = dst.ImportTasks(bytes.NewReader(bundle.Bytes()))
+	require.NoError(t, err)
+	require.Empty(t, imported.Imported)
+	require.Len(t, imported.Skipped, 2)
+}
+
+func TestImportTasksUpgradesAndValidates(t *testing.T) {
+	e := homeEngine(t)
+	id := xid.New().String()
+
+	bundle := func(files ...string) *bytes.Buffer {
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		for i := 0; i < len(files); i += 2 {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1]))}))
+			_, err := tw.Write([]byte(files[i+1]))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		return &b
+	}
+
+	// tasks written before schema versions are upgraded.
+	v0 := `{"id":"` + id + `","type":"run","states":[{"state":"scheduled","created":"2020-06-01T10:00:00Z"},{"state":"processing","created":"2020-06-01T10:00:10Z"},{"state":"complete","created":"2020-06-01T10:00:50Z"}]}`
+	report, err := e.ImportTasks(bundle(bundleTasks, v0+"\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{id}, report.Imported)
+
+	tsk, err := e.store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, task.CurrentVersion, tsk.Version)
+	require.Len(t, tsk.Attempts, 1)
+
+	// tasks that aren't complete, and outputs outside of their run, are
+	// refused.
+	scheduled := `{"id":"` + xid.New().String() + `","type":"run","states":[{"state":"scheduled","created":"2020-06-01T10:00:00Z"}]}`
+	_, err = e.ImportTasks(bundle(bundleTasks, scheduled))
+	require.Error(t, err)
+
+	other := xid.New().String()
+	_, err = e.ImportTasks(bundle(
+		bundleTasks, `{"id":"`+other+`","type":"run","states":[{"state":"complete","created":"2020-06-01T10:00:00Z"}]}`,
+		"outputs/"+other+"/local_docker/ping/"+id+"/run.out", "",
+	))
+	require.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+// homeEngine returns an engine with no workers, whose home directory is a
+// temporary directory.
+func homeEngine(t *testing.T) *Engine {
+	home, err := ioutil.TempDir("", "engine")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(home) })
+
+	prev, ok := os.LookupEnv(config.EnvTestgroundHomeDir)
+	require.NoError(t, os.Setenv(config.EnvTestgroundHomeDir, home))
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(config.EnvTestgroundHomeDir, prev)
+		} else {
+			os.Unsetenv(config.EnvTestgroundHomeDir)
+		}
+	})
+
+	cfg := &config.EnvConfig{}
+	require.NoError(t, cfg.Load())
+
+	store, err := task.NewMemoryTaskStorage()
+	require.NoError(t, err)
+	queue, err := task.NewQueue(store, 100, UnmarshalTask, nil)
+	require.NoError(t, err)
+
+	return &Engine{
+		runners:    map[string]api.Runner{"fake": &fakeRunner{}},
+		envcfg:     cfg,
+		store:      store,
+		queue:      queue,
+		signals:    make(map[string]chan int),
+		preempting: make(map[string]struct{}),
+	}
+}
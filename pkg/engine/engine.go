@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/build"
 	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/data"
 	"github.com/testground/testground/pkg/logging"
 	"github.com/testground/testground/pkg/rpc"
 	"github.com/testground/testground/pkg/runner"
@@ -54,12 +56,22 @@ type Engine struct {
 	runners map[string]api.Runner
 	envcfg  *config.EnvConfig
 	ctx     context.Context
-	store   *task.Storage
+	store   task.TaskStore
 	queue   *task.Queue
 	// signals contains a channel for each running task
 	// by closing a channel, the task is canceled
 	signals   map[string]chan int
 	signalsLk sync.RWMutex
+	// preempting contains the running tasks being preempted.
+	preempting   map[string]struct{}
+	preemptingLk sync.Mutex
+	// schedules queues the runs of recurring schedules.
+	schedules *scheduler
+	// gcLk serializes garbage collections.
+	gcLk sync.Mutex
+	// durations samples how long tasks take, to estimate when the scheduled
+	// ones will run.
+	durations durationSamples
 }
 
 var _ api.Engine = (*Engine)(nil)
@@ -72,7 +84,7 @@ type EngineConfig struct {
 
 func NewEngine(cfg *EngineConfig) (*Engine, error) {
 	var (
-		store *task.Storage
+		store task.TaskStore
 		err   error
 	)
 
@@ -90,24 +102,47 @@ func NewEngine(cfg *EngineConfig) (*Engine, error) {
 		if err != nil {
 			return nil, err
 		}
+	case "sqlite":
+		path := filepath.Join(cfg.EnvConfig.Dirs().Home(), "tasks.sqlite")
+		logging.S().Infow("init sqlite task storage", "path", path)
+		store, err = task.NewSQLiteTaskStorage(path)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("unknown task repo type: %s", trt)
 	}
 
-	queue, err := task.NewQueue(store, cfg.EnvConfig.Daemon.Scheduler.QueueSize, UnmarshalTask)
+	if err := validateRetryConfig(daemonRetryPolicy(cfg.EnvConfig.Daemon.Scheduler.Retry)); err != nil {
+		return nil, fmt.Errorf("invalid scheduler configuration: %w", err)
+	}
+
+	retention, err := parseRetentionConfig(cfg.EnvConfig.Daemon.Retention)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention policy: %w", err)
+	}
+
+	queue, err := task.NewQueue(store, cfg.EnvConfig.Daemon.Scheduler.QueueSize, UnmarshalTask, data.DecodeTaskOutcome)
 	if err != nil {
 		return nil, err
 	}
 
 	e := &Engine{
-		builders: make(map[string]api.Builder, len(cfg.Builders)),
-		runners:  make(map[string]api.Runner, len(cfg.Runners)),
-		envcfg:   cfg.EnvConfig,
-		ctx:      context.Background(),
-		store:    store,
-		queue:    queue,
-		signals:  make(map[string]chan int),
-	}
+		builders:   make(map[string]api.Builder, len(cfg.Builders)),
+		runners:    make(map[string]api.Runner, len(cfg.Runners)),
+		envcfg:     cfg.EnvConfig,
+		ctx:        context.Background(),
+		store:      store,
+		queue:      queue,
+		signals:    make(map[string]chan int),
+		preempting: make(map[string]struct{}),
+	}
+	queue.SetAdmission(newAdmission(e))
+	queue.SetLimits(task.Limits{
+		PerRunner: cfg.EnvConfig.Daemon.Scheduler.Limits.PerRunner,
+		PerUser:   cfg.EnvConfig.Daemon.Scheduler.Limits.PerUser,
+		PerRepo:   cfg.EnvConfig.Daemon.Scheduler.Limits.PerRepo,
+	})
 
 	for _, b := range cfg.Builders {
 		e.builders[b.ID()] = b
@@ -121,6 +156,14 @@ func NewEngine(cfg *EngineConfig) (*Engine, error) {
 		go e.worker(i)
 	}
 
+	if e.schedules, err = newScheduler(e); err != nil {
+		return nil, fmt.Errorf("failed to start scheduler: %w", err)
+	}
+
+	if retention.enabled() {
+		go e.janitor(retention)
+	}
+
 	return e, nil
 }
 
@@ -177,10 +220,52 @@ func (e *Engine) ListRunners() map[string]api.Runner {
 	return m
 }
 
+// validateManifest validates a manifest submitted with a request. Builders and
+// runners are checked against all those known to the system, and not only
+// those this engine is configured with, so that plans remain portable.
+func (e *Engine) validateManifest(manifest *api.TestPlanManifest) error {
+	var builders, runners []string
+	for _, b := range AllBuilders {
+		builders = append(builders, b.ID())
+	}
+	for id := range e.builders {
+		if !stringInSlice(id, builders) {
+			builders = append(builders, id)
+		}
+	}
+	for _, r := range AllRunners {
+		runners = append(runners, r.ID())
+	}
+	for id := range e.runners {
+		if !stringInSlice(id, runners) {
+			runners = append(runners, id)
+		}
+	}
+
+	if err := manifest.Validate(builders, runners); err != nil {
+		return fmt.Errorf("invalid test plan manifest: %w", err)
+	}
+	return nil
+}
+
 func (e *Engine) QueueBuild(request *api.BuildRequest, sources *api.UnpackedSources) (string, error) {
+	if err := e.validateManifest(&request.Manifest); err != nil {
+		return "", err
+	}
+
+	if err := e.checkPrerequisites(request.DependsOn); err != nil {
+		return "", err
+	}
+
+	comp, err := request.Composition.ExpandDependencyMatrix()
+	if err != nil {
+		return "", fmt.Errorf("failed to expand dependency matrix: %w", err)
+	}
+	request.Composition = *comp
+
 	id := xid.New().String()
-	err := e.queue.Push(&task.Task{
-		Version:  0,
+	tsk := &task.Task{
+		Version:  task.CurrentVersion,
 		Priority: request.Priority,
 		ID:       id,
 		Type:     task.TypeBuild,
@@ -194,13 +279,31 @@ func (e *Engine) QueueBuild(request *api.BuildRequest, sources *api.UnpackedSour
 				Created: time.Now().UTC(),
 			},
 		},
-		CreatedBy: task.CreatedBy(request.CreatedBy),
-	})
+		CreatedBy:   task.CreatedBy(request.CreatedBy),
+		DependsOn:   request.DependsOn,
+		Preemptible: request.Preemptible,
+	}
+	err = e.queue.Push(tsk)
+	if err == nil {
+		e.preemptFor(tsk)
+	}
 
 	return id, err
 }
 
 func (e *Engine) QueueRun(request *api.RunRequest, sources *api.UnpackedSources) (string, error) {
+	if err := e.validateManifest(&request.Manifest); err != nil {
+		return "", err
+	}
+
+	if err := e.checkPrerequisites(request.DependsOn); err != nil {
+		return "", err
+	}
+
+	if err := expandDependencyMatrix(request); err != nil {
+		return "", fmt.Errorf("failed to expand dependency matrix: %w", err)
+	}
+
 	var (
 		builders = request.Composition.ListBuilders()
 		runner   = request.Composition.Global.Runner
@@ -219,13 +322,28 @@ func (e *Engine) QueueRun(request *api.RunRequest, sources *api.UnpackedSources)
 		}
 	}
 
+	// Reject invalid test params upfront, rather than after building.
+	if err := request.Composition.ValidateTestParams(&request.Manifest); err != nil {
+		return "", err
+	}
+
+	// Pipelines run several test cases.
+	tcase := request.Composition.Global.Case
+	if stages := request.Composition.Stages; len(stages) > 0 {
+		cases := make([]string, 0, len(stages))
+		for _, s := range stages {
+			cases = append(cases, s.Case)
+		}
+		tcase = strings.Join(cases, ",")
+	}
+
 	id := xid.New().String()
 	cby := task.CreatedBy(request.CreatedBy)
 	newTask := &task.Task{
-		Version:     0,
+		Version:     task.CurrentVersion,
 		Priority:    request.Priority,
 		Plan:        request.Composition.Global.Plan,
-		Case:        request.Composition.Global.Case,
+		Case:        tcase,
 		ID:          id,
 		Runner:      runner,
 		Type:        task.TypeRun,
@@ -240,16 +358,60 @@ func (e *Engine) QueueRun(request *api.RunRequest, sources *api.UnpackedSources)
 				Created: time.Now().UTC(),
 			},
 		},
-		CreatedBy: cby,
+		CreatedBy:   cby,
+		Sweep:       (*task.Sweep)(request.Sweep),
+		DependsOn:   request.DependsOn,
+		Preemptible: request.Preemptible,
 	}
 
 	err := e.queue.PushUniqueByBranch(newTask)
+	if err == nil {
+		e.preemptFor(newTask)
+	}
 
 	return id, err
 }
 
+// checkPrerequisites verifies that the tasks a new task depends on exist.
+func (e *Engine) checkPrerequisites(ids []string) error {
+	for _, id := range ids {
+		if _, err := e.store.Get(id); err != nil {
+			return fmt.Errorf("unknown prerequisite task %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// expandDependencyMatrix expands the dependency matrix of the composition of
+// a run request, if it still carries one, and maps the groups to build to
+// their variants. Clients normally expand it before submitting.
+func expandDependencyMatrix(request *api.RunRequest) error {
+	comp, err := request.Composition.ExpandDependencyMatrix()
+	if err != nil || comp == &request.Composition {
+		return err
+	}
+
+	n := len(comp.Metadata.DependencyVariants)
+	groups := make([]int, 0, len(request.BuildGroups)*n)
+	for _, idx := range request.BuildGroups {
+		for k := 0; k < n; k++ {
+			groups = append(groups, idx*n+k)
+		}
+	}
+
+	request.Composition, request.BuildGroups = *comp, groups
+	return nil
+}
+
 func (e *Engine) DoCollectOutputs(ctx context.Context, runID string, ow *rpc.OutputWriter) error {
 	t, err := e.GetTask(runID)
+	if err != nil {
+		// The run ID may be that of a stage of a pipeline; look up the
+		// pipeline task instead. See StageRunID.
+		if i := strings.LastIndex(runID, "-"); i > 0 {
+			t, err = e.GetTask(runID[:i])
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("could not get task %s: %s", runID, err.Error())
 	}
@@ -356,53 +518,83 @@ func stringInSlice(a string, list []string) bool {
 
 // Tasks returns a list of tasks that match the filters argument
 func (e *Engine) Tasks(filters api.TasksFilters) ([]task.Task, error) {
-	var (
-		res    []task.Task
-		before time.Time
-		after  time.Time
-	)
-
-	if filters.Before != nil {
-		before = filters.Before.UTC()
+	q := task.Query{
+		States:  filters.States,
+		Types:   filters.Types,
+		Plan:    filters.TestPlan,
+		Case:    filters.TestCase,
+		Runner:  filters.Runner,
+		Outcome: filters.Outcome,
+		Repo:    filters.Repo,
+		Branch:  filters.Branch,
+		Commit:  filters.Commit,
+		User:    filters.User,
+		Offset:  filters.Offset,
+		Limit:   filters.Limit,
 	}
 
-	if filters.After != nil {
-		after = filters.After.UTC()
-	} else {
-		after = time.Now().UTC()
+	for _, state := range filters.States {
+		switch state {
+		case task.StateScheduled, task.StateProcessing, task.StateComplete:
+		default:
+			return nil, fmt.Errorf("unsupported task state: %s; expected scheduled, processing or complete", state)
+		}
 	}
 
-	e.signalsLk.RLock()
+	since, until := filters.Since, filters.Until
+	if since == nil {
+		since = filters.Before
+	}
+	if until == nil {
+		until = filters.After
+	}
+	if since != nil {
+		q.After = since.UTC()
+	}
+	if until != nil {
+		q.Before = until.UTC()
+	}
 
-	for _, state := range filters.States {
-		var ires []task.Task
+	switch filters.Order {
+	case "", api.TasksNewestFirst:
+	case api.TasksOldestFirst:
+		q.Ascending = true
+	default:
+		return nil, fmt.Errorf("unknown order: %s", filters.Order)
+	}
 
-		tsks, err := e.store.Filter(state, before, after)
-		if err != nil {
-			return nil, err
-		}
+	if filters.Offset < 0 || filters.Limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
 
-		for _, tsk := range tsks {
-			if filters.TestPlan != "" && tsk.Plan != filters.TestPlan {
-				continue
-			}
+	tsks, err := e.store.Query(q)
+	if err != nil {
+		return nil, err
+	}
 
-			if filters.TestCase != "" && tsk.Case != filters.TestCase {
-				continue
-			}
+	res := make([]task.Task, 0, len(tsks))
+	for _, tsk := range tsks {
+		res = append(res, *tsk)
+	}
 
-			for _, tp := range filters.Types {
-				if tsk.Type == tp {
-					ires = append([]task.Task{*tsk}, ires...)
-					break
-				}
+	// report the position of scheduled tasks in the queue.
+	var (
+		info   map[string]*task.QueueInfo
+		loaded bool
+	)
+	for i := range res {
+		if res[i].State().State != task.StateScheduled {
+			continue
+		}
+		if !loaded {
+			var err error
+			if info, err = e.queueInfo(); err != nil {
+				return nil, err
 			}
+			loaded = true
 		}
-
-		res = append(res, ires...)
+		res[i].Queue = info[res[i].ID]
 	}
-
-	e.signalsLk.RUnlock()
 	return res, nil
 }
 
@@ -412,17 +604,42 @@ func (e *Engine) DeleteTask(id string) error {
 }
 
 func (e *Engine) GetTask(id string) (*task.Task, error) {
-	return e.store.Get(id)
+	tsk, err := e.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if e.queue != nil && tsk.State().State == task.StateScheduled {
+		tsk.Waiting = e.queue.WaitingReason(id)
+
+		info, err := e.queueInfo()
+		if err != nil {
+			return nil, err
+		}
+		tsk.Queue = info[id]
+	}
+	return tsk, nil
 }
 
-// Kill closes the signal channel for a given task, which signals to the runner to stop it
-func (e *Engine) Kill(id string) error {
-	e.signalsLk.RLock()
-	if ch, ok := e.signals[id]; ok {
-		close(ch)
+// Branches summarizes the runs created from each branch of the repository.
+func (e *Engine) Branches(repo string) ([]task.BranchRuns, error) {
+	if repo == "" {
+		return nil, fmt.Errorf("a repository is required")
 	}
-	e.signalsLk.RUnlock()
+	return e.store.Branches(repo)
+}
 
+// LastGreen returns the most recent successful run created from the branch
+// of the repository, and of the test plan if any.
+func (e *Engine) LastGreen(repo, branch, plan string) (*task.Task, error) {
+	if repo == "" || branch == "" {
+		return nil, fmt.Errorf("a repository and a branch are required")
+	}
+	return e.store.LastGreen(repo, branch, plan)
+}
+
+// Kill closes the signal channel for a given task, which signals to the runner to stop it
+func (e *Engine) Kill(id string) error {
+	e.signal(id)
 	return nil
 }
 
@@ -438,6 +655,11 @@ func UnmarshalTask(taskData []byte) (*task.Task, error) {
 		return nil, err
 	}
 
+	// tasks are upgraded to the current version when the storage is opened.
+	if unmarshaledValue.Version > task.CurrentVersion {
+		return nil, fmt.Errorf("%w: task %s has version %d", task.ErrFutureVersion, unmarshaledValue.ID, unmarshaledValue.Version)
+	}
+
 	// unmarshal task again, based on its type
 	switch unmarshaledValue.Type {
 	case task.TypeRun:
@@ -481,16 +703,21 @@ func (e *Engine) Logs(ctx context.Context, id string, follow bool, cancel bool,
 
 	// wait for the task to start
 	for {
-		tsk, err := e.GetTask(id)
+		changed := e.queue.Changed()
+		tsk, err := e.store.Get(id)
 		if err != nil {
 			return nil, fmt.Errorf("error while e.Status, err: %w", err)
 		}
 
-		if tsk.State().State == task.StateScheduled {
-			time.Sleep(time.Millisecond * 500)
-		} else {
+		if tsk.State().State != task.StateScheduled {
 			break
 		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
 	stop := make(chan struct{})
@@ -502,16 +729,18 @@ func (e *Engine) Logs(ctx context.Context, id string, follow bool, cancel bool,
 
 	go func() {
 		for {
-			e.signalsLk.RLock()
-			_, running := e.signals[id]
-			e.signalsLk.RUnlock()
-			if !running {
+			// tasks preempted or retried are scheduled again, and their next
+			// attempts append to the same log; they are followed until they
+			// are done.
+			changed := e.queue.Changed()
+			tsk, err := e.store.Get(id)
+			if err != nil || tsk.State().State == task.StateComplete || tsk.State().State == task.StateCanceled {
 				time.Sleep(2 * time.Second)
 				close(stop)
 				return
 			}
 
-			time.Sleep(1 * time.Second)
+			<-changed
 		}
 	}()
 
@@ -525,11 +754,7 @@ Outer:
 		select {
 		case <-ctx.Done():
 			if cancel {
-				e.signalsLk.RLock()
-				if ch, ok := e.signals[id]; ok {
-					close(ch)
-				}
-				e.signalsLk.RUnlock()
+				e.signal(id)
 			}
 			break Outer
 		default:
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/rs/xid"
+
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/task"
 )
@@ -96,3 +98,107 @@ func TestUnmarshalTaskBuild(t *testing.T) {
 		t.Errorf("Unmarshal Build task returned incorrect data")
 	}
 }
+
+func TestExpandDependencyMatrixBuildGroups(t *testing.T) {
+	request := &api.RunRequest{
+		BuildGroups: []int{1},
+		Composition: api.Composition{
+			Global: api.Global{
+				Build: &api.Build{DependencyMatrix: api.DependencyMatrix{
+					{Module: "mod", Versions: []string{"v1", "v2"}},
+				}},
+			},
+			Groups: api.Groups{
+				{ID: "a", Run: api.Run{Artifact: "prebuilt"}},
+				{ID: "b"},
+			},
+		},
+	}
+
+	if err := expandDependencyMatrix(request); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, idx := range request.BuildGroups {
+		ids = append(ids, request.Composition.Groups[idx].ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"b-1", "b-2"}) {
+		t.Fatalf("unexpected groups to build: %v", ids)
+	}
+	if request.Composition.Groups[1].Run.Artifact != "prebuilt" {
+		t.Fatalf("artifact of variant a-2 not preserved")
+	}
+
+	// expanding again is a no-op.
+	if err := expandDependencyMatrix(request); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.BuildGroups) != 2 || len(request.Composition.Groups) != 4 {
+		t.Fatalf("composition expanded twice")
+	}
+}
+
+func TestTasksTimeAndStateFilters(t *testing.T) {
+	e := homeEngine(t)
+	now := time.Now()
+
+	var ids []string
+	for _, ago := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour} {
+		created := now.Add(-ago)
+		tsk := &task.Task{
+			Version: task.CurrentVersion,
+			ID:      xid.NewWithTime(created).String(),
+			Type:    task.TypeRun,
+			States: []task.DatedState{
+				{State: task.StateScheduled, Created: created},
+				{State: task.StateComplete, Created: created.Add(time.Minute)},
+			},
+		}
+		if err := e.store.PersistComplete(tsk); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tsk.ID)
+	}
+
+	at := func(ago time.Duration) *time.Time {
+		tm := now.Add(-ago)
+		return &tm
+	}
+
+	for _, tc := range []struct {
+		name    string
+		filters api.TasksFilters
+		ids     []string
+	}{
+		{"since", api.TasksFilters{Since: at(150 * time.Minute)}, []string{ids[2], ids[1]}},
+		{"until", api.TasksFilters{Until: at(90 * time.Minute)}, []string{ids[1], ids[0]}},
+		{"since and until", api.TasksFilters{Since: at(150 * time.Minute), Until: at(90 * time.Minute)}, []string{ids[1]}},
+		// the deprecated fields keep their meaning: Before is the lower bound,
+		// After the upper one.
+		{"legacy before", api.TasksFilters{Before: at(150 * time.Minute)}, []string{ids[2], ids[1]}},
+		{"legacy after", api.TasksFilters{After: at(90 * time.Minute)}, []string{ids[1], ids[0]}},
+		{"since over legacy before", api.TasksFilters{Since: at(90 * time.Minute), Before: at(150 * time.Minute)}, []string{ids[2]}},
+	} {
+		tc.filters.States = []task.State{task.StateComplete}
+		tsks, err := e.Tasks(tc.filters)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		var got []string
+		for _, tsk := range tsks {
+			got = append(got, tsk.ID)
+		}
+		if !reflect.DeepEqual(got, tc.ids) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.ids, got)
+		}
+	}
+
+	// canceled tasks are stored as complete; states that aren't storage
+	// states are refused rather than matching nothing.
+	for _, state := range []task.State{task.StateCanceled, "bogus"} {
+		if _, err := e.Tasks(api.TasksFilters{States: []task.State{state}}); err == nil {
+			t.Fatalf("expected state %s to be refused", state)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package engine
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type TaskExecutionError struct {
 	TaskType   string
@@ -10,3 +13,33 @@ type TaskExecutionError struct {
 func (e *TaskExecutionError) Error() string {
 	return fmt.Sprintf("task of type %s cancelled: %v", e.TaskType, e.WrappedErr.Error())
 }
+
+func (e *TaskExecutionError) Unwrap() error {
+	return e.WrappedErr
+}
+
+// TimeoutError is returned when a phase of a task exceeds the timeout
+// declared by its composition.
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Phase, e.Timeout)
+}
+
+// HealthcheckError is returned when the healthcheck of a builder or runner
+// fails, and can't be fixed.
+type HealthcheckError struct {
+	Component string
+	Err       error
+}
+
+func (e *HealthcheckError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HealthcheckError) Unwrap() error {
+	return e.Err
+}
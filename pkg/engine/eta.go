@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+const (
+	// etaLookback is how far back completed tasks are considered to estimate
+	// how long tasks take.
+	etaLookback = 30 * 24 * time.Hour
+
+	// etaSamples is the number of most recent completed tasks of the same
+	// plan, case and runner averaged to estimate how long a task takes.
+	etaSamples = 10
+
+	// etaReload is how often the samples are reloaded from storage, so that
+	// those older than etaLookback are dropped. In between, tasks are sampled
+	// as they complete.
+	etaReload = time.Hour
+)
+
+// durationSamples caches the processing times of the most recent tasks that
+// completed, by durationKey, so that estimates don't scan the storage.
+type durationSamples struct {
+	lk      sync.Mutex
+	samples map[string][]time.Duration
+	loaded  time.Time
+}
+
+// add records a processing time for the key, keeping the most recent
+// samples. s.lk must be locked.
+func (s *durationSamples) add(key string, d time.Duration) {
+	if ds := append(s.samples[key], d); len(ds) > etaSamples {
+		s.samples[key] = ds[1:]
+	} else {
+		s.samples[key] = ds
+	}
+}
+
+// durationKey identifies the tasks expected to take as long as each other.
+func durationKey(tsk *task.Task) string {
+	return strings.Join([]string{string(tsk.Type), tsk.Plan, tsk.Case, tsk.Runner}, "|")
+}
+
+// recordDuration samples the processing time of a task that completed.
+func (e *Engine) recordDuration(tsk *task.Task) {
+	if tsk.State().State != task.StateComplete {
+		return
+	}
+
+	e.durations.lk.Lock()
+	defer e.durations.lk.Unlock()
+
+	// samples not loaded yet include the task once loaded.
+	if e.durations.samples != nil {
+		e.durations.add(durationKey(tsk), tsk.ProcessingTime())
+	}
+}
+
+// estimateDurations returns how long tasks are expected to take, by
+// durationKey: the average processing time of the most recent tasks that
+// completed.
+func (e *Engine) estimateDurations(now time.Time) (map[string]time.Duration, error) {
+	s := &e.durations
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.samples == nil || now.Sub(s.loaded) > etaReload {
+		// the range excludes its end second.
+		tsks, err := e.store.Filter(task.StateComplete, now.Add(-etaLookback), now.Add(time.Second))
+		if err != nil {
+			return nil, err
+		}
+
+		// tasks are sorted by creation time; keep the most recent samples.
+		s.samples, s.loaded = make(map[string][]time.Duration), now
+		for _, tsk := range tsks {
+			if tsk.State().State == task.StateComplete {
+				s.add(durationKey(tsk), tsk.ProcessingTime())
+			}
+		}
+	}
+
+	res := make(map[string]time.Duration, len(s.samples))
+	for key, ds := range s.samples {
+		var total time.Duration
+		for _, d := range ds {
+			total += d
+		}
+		res[key] = total / time.Duration(len(ds))
+	}
+	return res, nil
+}
+
+// queueInfo returns the position of every scheduled task in the queue, by ID,
+// along with when it's expected to start and complete.
+//
+// Estimates assume the workers process the tasks in order, as soon as one is
+// free, ignoring the limits, resources and prerequisites tasks may wait for.
+// A task is estimated to take as long as the recent tasks of the same plan,
+// case and runner; if any task running or ahead of a task has no history, no
+// estimate is given for it. If the history can't be read, no estimate is
+// given at all.
+func (e *Engine) queueInfo() (map[string]*task.QueueInfo, error) {
+	scheduled := e.queue.Scheduled()
+	if len(scheduled) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	durations, err := e.estimateDurations(now)
+	if err != nil {
+		logging.S().Warnw("could not estimate task durations", "err", err)
+	}
+
+	// free holds when each worker is expected to be free.
+	var (
+		free  []time.Time
+		known = err == nil
+	)
+	for _, r := range e.queue.Running() {
+		d, ok := durations[durationKey(r)]
+		if !ok {
+			known = false
+			break
+		}
+		end := r.State().Created.Add(d)
+		if end.Before(now) {
+			end = now
+		}
+		free = append(free, end)
+	}
+	for len(free) < e.envcfg.Daemon.Scheduler.Workers || len(free) == 0 {
+		free = append(free, now)
+	}
+
+	var (
+		ids = make([]string, len(scheduled))
+		res = make(map[string]*task.QueueInfo, len(scheduled))
+	)
+	for i, tsk := range scheduled {
+		ids[i] = tsk.ID
+		info := &task.QueueInfo{
+			Position: i + 1,
+			Ahead:    ids[:i:i],
+		}
+		res[tsk.ID] = info
+
+		d, ok := durations[durationKey(tsk)]
+		if !known || !ok {
+			known = false
+			continue
+		}
+
+		// the task starts once the first worker is free.
+		sort.Slice(free, func(i, j int) bool {
+			return free[i].Before(free[j])
+		})
+		info.EstimatedStart, info.EstimatedEnd = free[0], free[0].Add(d)
+		free[0] = info.EstimatedEnd
+	}
+	return res, nil
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestQueueInfoEstimatesFromHistory(t *testing.T) {
+	store, err := task.NewMemoryTaskStorage()
+	require.NoError(t, err)
+	queue, err := task.NewQueue(store, 100, UnmarshalTask, nil)
+	require.NoError(t, err)
+
+	cfg := &config.EnvConfig{}
+	cfg.Daemon.Scheduler.Workers = 1
+	e := &Engine{envcfg: cfg, store: store, queue: queue}
+
+	var (
+		now    = time.Now()
+		hour   = now.Add(-time.Hour)
+		newRun = func(plan string, states ...task.DatedState) *task.Task {
+			return &task.Task{
+				ID:     xid.New().String(),
+				Type:   task.TypeRun,
+				Plan:   plan,
+				Case:   "case",
+				Runner: "local:docker",
+				States: states,
+			}
+		}
+	)
+
+	// completed runs took 10 and 20 minutes to process, after waiting in the
+	// queue; a canceled run doesn't count.
+	for _, took := range []time.Duration{10 * time.Minute, 20 * time.Minute} {
+		tsk := newRun("plan",
+			task.DatedState{State: task.StateScheduled, Created: hour},
+			task.DatedState{State: task.StateProcessing, Created: hour.Add(5 * time.Minute)},
+			task.DatedState{State: task.StateComplete, Created: hour.Add(5*time.Minute + took)},
+		)
+		require.NoError(t, store.PersistScheduled(tsk))
+		require.NoError(t, store.ProcessTask(tsk))
+		require.NoError(t, store.ArchiveTask(tsk))
+	}
+	canceled := newRun("plan",
+		task.DatedState{State: task.StateScheduled, Created: hour},
+		task.DatedState{State: task.StateCanceled, Created: hour.Add(time.Second)},
+	)
+	require.NoError(t, store.PersistScheduled(canceled))
+	require.NoError(t, store.ProcessTask(canceled))
+	require.NoError(t, store.ArchiveTask(canceled))
+
+	// a run started 5 minutes ago keeps the only worker busy for 10 more.
+	running := newRun("plan", task.DatedState{State: task.StateScheduled, Created: now.Add(-10 * time.Minute)})
+	require.NoError(t, queue.Push(running))
+	_, err = queue.Pop()
+	require.NoError(t, err)
+	running.States = append(running.States, task.DatedState{State: task.StateProcessing, Created: now.Add(-5 * time.Minute)})
+
+	var (
+		first   = newRun("plan", task.DatedState{State: task.StateScheduled, Created: now.Add(-3 * time.Minute)})
+		unknown = newRun("other", task.DatedState{State: task.StateScheduled, Created: now.Add(-2 * time.Minute)})
+		last    = newRun("plan", task.DatedState{State: task.StateScheduled, Created: now.Add(-1 * time.Minute)})
+	)
+	for _, tsk := range []*task.Task{last, first, unknown} {
+		require.NoError(t, queue.Push(tsk))
+	}
+
+	info, err := e.queueInfo()
+	require.NoError(t, err)
+	require.Len(t, info, 3)
+
+	require.Equal(t, 1, info[first.ID].Position)
+	require.Empty(t, info[first.ID].Ahead)
+	require.WithinDuration(t, now.Add(10*time.Minute), info[first.ID].EstimatedStart, time.Second)
+	require.WithinDuration(t, now.Add(25*time.Minute), info[first.ID].EstimatedEnd, time.Second)
+
+	// no estimate is given past a task without history.
+	require.Equal(t, 2, info[unknown.ID].Position)
+	require.Equal(t, []string{first.ID}, info[unknown.ID].Ahead)
+	require.True(t, info[unknown.ID].EstimatedStart.IsZero())
+
+	require.Equal(t, 3, info[last.ID].Position)
+	require.Equal(t, []string{first.ID, unknown.ID}, info[last.ID].Ahead)
+	require.True(t, info[last.ID].EstimatedStart.IsZero())
+
+	// tasks retrieved while scheduled carry their position.
+	tsk, err := e.GetTask(first.ID)
+	require.NoError(t, err)
+	require.NotNil(t, tsk.Queue)
+	require.Equal(t, 1, tsk.Queue.Position)
+
+	// the history is sampled once; tasks are sampled as they complete.
+	other := newRun("other",
+		task.DatedState{State: task.StateScheduled, Created: hour},
+		task.DatedState{State: task.StateProcessing, Created: hour},
+		task.DatedState{State: task.StateComplete, Created: hour.Add(time.Minute)},
+	)
+	require.NoError(t, store.PersistScheduled(other))
+	require.NoError(t, store.ProcessTask(other))
+	require.NoError(t, store.ArchiveTask(other))
+	info, err = e.queueInfo()
+	require.NoError(t, err)
+	require.True(t, info[last.ID].EstimatedStart.IsZero())
+
+	e.recordDuration(other)
+	info, err = e.queueInfo()
+	require.NoError(t, err)
+	require.WithinDuration(t, now.Add(26*time.Minute), info[last.ID].EstimatedStart, time.Second)
+
+	// when the history can't be read, positions are reported without
+	// estimates.
+	e.durations.samples = nil
+	require.NoError(t, store.Close())
+	info, err = e.queueInfo()
+	require.NoError(t, err)
+	require.Equal(t, 1, info[first.ID].Position)
+	require.True(t, info[first.ID].EstimatedStart.IsZero())
+}
@@ -0,0 +1,370 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+const (
+	// defaultGCInterval is how often the retention policy is applied, unless
+	// configured otherwise.
+	defaultGCInterval = time.Hour
+
+	// orphanGrace is how old the files no task refers to must be to be
+	// deleted, so that the sources of requests being received are kept.
+	orphanGrace = time.Hour
+)
+
+// retentionPolicy is the parsed retention policy of the daemon.
+type retentionPolicy struct {
+	maxAge       time.Duration
+	failedMaxAge time.Duration
+	maxPerPlan   int
+	interval     time.Duration
+}
+
+// parseRetentionConfig parses and validates the retention policy of the
+// daemon.
+func parseRetentionConfig(cfg config.RetentionConfig) (retentionPolicy, error) {
+	p := retentionPolicy{
+		maxPerPlan: cfg.MaxPerPlan,
+		interval:   defaultGCInterval,
+	}
+	if p.maxPerPlan < 0 {
+		return p, fmt.Errorf("invalid max tasks per plan: %d", p.maxPerPlan)
+	}
+	for _, d := range []struct {
+		v   string
+		dst *time.Duration
+	}{
+		{cfg.MaxAge, &p.maxAge},
+		{cfg.FailedMaxAge, &p.failedMaxAge},
+		{cfg.Interval, &p.interval},
+	} {
+		if d.v == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.v)
+		if err != nil || v <= 0 {
+			return p, fmt.Errorf("invalid duration: %s", d.v)
+		}
+		*d.dst = v
+	}
+	if p.failedMaxAge > 0 && p.failedMaxAge < p.maxAge {
+		return p, fmt.Errorf("failed max age %s is shorter than max age %s; failed tasks are kept longer than others", p.failedMaxAge, p.maxAge)
+	}
+	return p, nil
+}
+
+// enabled returns whether the policy deletes any complete task.
+func (p retentionPolicy) enabled() bool {
+	return p.maxAge > 0 || p.maxPerPlan > 0
+}
+
+// expired returns why the complete task is to be deleted, if it is. Tasks
+// are expected newest first; kept counts the tasks kept so far by plan.
+func (p retentionPolicy) expired(tsk *task.Task, now time.Time, kept map[string]int) (string, bool) {
+	age := now.Sub(tsk.State().Created)
+
+	if p.failedMaxAge > 0 {
+		outcome, err := data.DecodeTaskOutcome(tsk)
+		if err == nil && (outcome == task.OutcomeFailure || outcome == task.OutcomeTimeout) {
+			if age > p.failedMaxAge {
+				return fmt.Sprintf("failed more than %s ago", p.failedMaxAge), true
+			}
+			return "", false
+		}
+	}
+
+	if p.maxAge > 0 && age > p.maxAge {
+		return fmt.Sprintf("completed more than %s ago", p.maxAge), true
+	}
+	if p.maxPerPlan > 0 && kept[tsk.Plan] >= p.maxPerPlan {
+		return fmt.Sprintf("beyond the %d most recent tasks of plan %s", p.maxPerPlan, tsk.Plan), true
+	}
+	kept[tsk.Plan]++
+	return "", false
+}
+
+// GC applies the retention policy of the daemon, and deletes the files no
+// task refers to anymore.
+func (e *Engine) GC(dryRun bool) (*api.GCReport, error) {
+	p, err := parseRetentionConfig(e.envcfg.Daemon.Retention)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention policy: %w", err)
+	}
+	return e.collectGarbage(p, time.Now(), dryRun)
+}
+
+// janitor applies the retention policy periodically.
+func (e *Engine) janitor(p retentionPolicy) {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		report, err := e.collectGarbage(p, time.Now(), false)
+		if err != nil {
+			logging.S().Warnw("failed to collect garbage", "err", err)
+			continue
+		}
+		if len(report.Tasks) > 0 || len(report.Paths) > 0 {
+			logging.S().Infow("collected garbage", "tasks", len(report.Tasks), "paths", len(report.Paths), "bytes", report.Bytes)
+		}
+	}
+}
+
+// collectGarbage deletes, unless dryRun:
+//
+//   - the complete tasks expired according to the policy, along with their
+//     logs, outputs and sources.
+//   - the sources of the complete tasks kept, which are only needed to build.
+//   - the sources and logs no task refers to, such as those of tasks deleted
+//     from the dashboard.
+//
+// It returns what was deleted, or would be if dryRun.
+func (e *Engine) collectGarbage(p retentionPolicy, now time.Time, dryRun bool) (*api.GCReport, error) {
+	e.gcLk.Lock()
+	defer e.gcLk.Unlock()
+
+	var (
+		dirs     = e.envcfg.Dirs()
+		requests = filepath.Join(dirs.Work(), "requests")
+		report   = &api.GCReport{DryRun: dryRun}
+		// known and referenced hold the tasks in the storage and the
+		// sources they refer to, respectively; inUse holds the sources
+		// active tasks refer to.
+		known      = make(map[string]struct{})
+		referenced = make(map[string]struct{})
+		inUse      = make(map[string]struct{})
+		// reclaimed holds the paths already reported.
+		reclaimed = make(map[string]struct{})
+	)
+
+	reclaim := func(path string, reason string) error {
+		if _, ok := reclaimed[path]; ok {
+			return nil
+		}
+		reclaimed[path] = struct{}{}
+
+		size, err := diskUsage(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+		}
+		report.Paths = append(report.Paths, api.GCPath{Path: path, Bytes: size, Reason: reason})
+		report.Bytes += size
+		return nil
+	}
+
+	// sources of the active tasks, and their copies, are kept; tasks
+	// expanded from the same request share them.
+	active, err := e.store.Query(task.Query{States: []task.State{task.StateScheduled, task.StateProcessing}})
+	if err != nil {
+		return nil, err
+	}
+	for _, tsk := range active {
+		known[tsk.ID] = struct{}{}
+		src := taskSourcesDir(tsk)
+		if src == "" {
+			continue
+		}
+		sources, err := withSourcesCopies(src)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range sources {
+			referenced[dir] = struct{}{}
+			inUse[dir] = struct{}{}
+		}
+	}
+
+	// complete tasks are listed newest first.
+	complete, err := e.store.Query(task.Query{States: []task.State{task.StateComplete}})
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]int)
+	for _, tsk := range complete {
+		known[tsk.ID] = struct{}{}
+
+		// sources are only deleted from the requests directory.
+		var sources []string
+		if src := taskSourcesDir(tsk); src != "" {
+			if sources, err = withSourcesCopies(src); err != nil {
+				return nil, err
+			}
+			for _, dir := range sources {
+				referenced[dir] = struct{}{}
+			}
+			if _, ok := inUse[src]; ok || !isSubdir(requests, src) {
+				sources = nil
+			}
+		}
+
+		reason, expired := p.expired(tsk, now, kept)
+		if !expired {
+			for _, dir := range sources {
+				if err := reclaim(dir, "sources of complete task "+tsk.ID); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		paths := []string{filepath.Join(dirs.Daemon(), tsk.ID+".out")}
+		if tsk.Type == task.TypeRun {
+			outputs, err := runOutputsDirs(dirs.Outputs(), tsk)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, outputs...)
+		}
+		paths = append(paths, sources...)
+		for _, path := range paths {
+			if err := reclaim(path, "task "+tsk.ID+" "+reason); err != nil {
+				return nil, err
+			}
+		}
+		if !dryRun {
+			if err := e.store.Delete(tsk.ID); err != nil {
+				return nil, err
+			}
+		}
+		report.Tasks = append(report.Tasks, api.GCTask{
+			ID:        tsk.ID,
+			Plan:      tsk.Plan,
+			Case:      tsk.Case,
+			Completed: tsk.State().Created,
+			Reason:    reason,
+		})
+	}
+
+	// sources and logs no task refers to.
+	orphaned := func(dir string, fn func(fi os.FileInfo) bool) error {
+		fis, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, fi := range fis {
+			if fi.ModTime().After(now.Add(-orphanGrace)) || !fn(fi) {
+				continue
+			}
+			if err := reclaim(filepath.Join(dir, fi.Name()), "not referred to by any task"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = orphaned(requests, func(fi os.FileInfo) bool {
+		_, ok := referenced[filepath.Join(requests, fi.Name())]
+		return fi.IsDir() && !ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = orphaned(dirs.Daemon(), func(fi os.FileInfo) bool {
+		_, ok := known[strings.TrimSuffix(fi.Name(), ".out")]
+		return !fi.IsDir() && strings.HasSuffix(fi.Name(), ".out") && !ok
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// taskSourcesDir returns the directory the sources of the task were unpacked
+// to, if any.
+func taskSourcesDir(tsk *task.Task) string {
+	b, err := json.Marshal(tsk.Input)
+	if err != nil {
+		return ""
+	}
+	var in struct {
+		Sources *api.UnpackedSources
+	}
+	if err := json.Unmarshal(b, &in); err != nil || in.Sources == nil {
+		return ""
+	}
+	return filepath.Clean(in.Sources.BaseDir)
+}
+
+// withSourcesCopies returns the sources directory of a task, followed by the
+// copies made to build its groups concurrently, named <src>-<n> by doBuild.
+func withSourcesCopies(src string) ([]string, error) {
+	matches, err := filepath.Glob(src + "-*")
+	if err != nil {
+		return nil, err
+	}
+	res := []string{src}
+	for _, m := range matches {
+		if _, err := strconv.Atoi(strings.TrimPrefix(m, src+"-")); err == nil {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// runOutputsDirs returns the directories holding the outputs of the run, and
+// of its stages, across the local runners.
+func runOutputsDirs(outputs string, tsk *task.Task) ([]string, error) {
+	var res []string
+	// stages run under the ID returned by StageRunID.
+	for _, pattern := range []string{tsk.ID, tsk.ID + "-*"} {
+		matches, err := filepath.Glob(filepath.Join(outputs, "*", tsk.Plan, pattern))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, matches...)
+	}
+	return res, nil
+}
+
+// diskUsage returns the size of the files under path.
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// isSubdir returns whether path is strictly under dir.
+func isSubdir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
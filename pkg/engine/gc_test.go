@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestCollectGarbageAppliesRetention(t *testing.T) {
+	e := homeEngine(t)
+	dirs := e.envcfg.Dirs()
+	now := time.Now()
+
+	writeFile := func(path string, size int) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, make([]byte, size), 0644))
+	}
+
+	// newTask stores a run, with a log and sources, completed ago with the
+	// given outcome; if ago is zero, the task is still scheduled.
+	newTask := func(plan string, ago time.Duration, outcome task.Outcome) *task.Task {
+		created := now.Add(-ago - time.Minute)
+		tsk := &task.Task{
+			ID:     xid.NewWithTime(created).String(),
+			Type:   task.TypeRun,
+			Plan:   plan,
+			Case:   "case",
+			States: []task.DatedState{{State: task.StateScheduled, Created: created}},
+		}
+		sources := &api.UnpackedSources{BaseDir: filepath.Join(dirs.Work(), "requests", tsk.ID)}
+		tsk.Input = &RunInput{RunRequest: &api.RunRequest{}, Sources: sources}
+		writeFile(filepath.Join(sources.BaseDir, "plan", "main.go"), 10)
+		writeFile(filepath.Join(dirs.Daemon(), tsk.ID+".out"), 100)
+
+		require.NoError(t, e.store.PersistScheduled(tsk))
+		if ago == 0 {
+			return tsk
+		}
+		require.NoError(t, e.store.ProcessTask(tsk))
+		tsk.States = append(tsk.States, task.DatedState{State: task.StateComplete, Created: now.Add(-ago)})
+		tsk.Result = map[string]interface{}{"outcome": outcome}
+		require.NoError(t, e.store.PersistProcessing(tsk))
+		require.NoError(t, e.store.ArchiveTask(tsk))
+		return tsk
+	}
+
+	var (
+		recent    = newTask("ping", time.Hour, task.OutcomeSuccess)
+		older     = newTask("ping", 2*time.Hour, task.OutcomeSuccess)
+		oldest    = newTask("ping", 3*time.Hour, task.OutcomeSuccess)
+		failed    = newTask("ping", 48*time.Hour, task.OutcomeFailure)
+		expired   = newTask("pong", 30*time.Hour, task.OutcomeSuccess)
+		abandoned = newTask("pong", 100*time.Hour, task.OutcomeFailure)
+		scheduled = newTask("pong", 0, "")
+	)
+	outputs := filepath.Join(dirs.Outputs(), "local_docker", "ping", StageRunID(oldest.ID, 0))
+	writeFile(filepath.Join(outputs, "single", "0", "run.out"), 1000)
+
+	// files no task refers to are deleted once old enough.
+	orphans := []string{
+		filepath.Join(dirs.Work(), "requests", "orphan"),
+		filepath.Join(dirs.Daemon(), xid.New().String()+".out"),
+	}
+	writeFile(filepath.Join(orphans[0], "plan", "main.go"), 1)
+	writeFile(orphans[1], 1)
+	for _, path := range orphans {
+		require.NoError(t, os.Chtimes(path, now.Add(-2*orphanGrace), now.Add(-2*orphanGrace)))
+	}
+	receiving := filepath.Join(dirs.Work(), "requests", "receiving")
+	writeFile(filepath.Join(receiving, "plan", "main.go"), 1)
+
+	p := retentionPolicy{maxAge: 24 * time.Hour, maxPerPlan: 2, failedMaxAge: 72 * time.Hour}
+
+	expect := map[string]string{
+		oldest.ID:    "beyond the 2 most recent tasks of plan ping",
+		expired.ID:   "completed more than 24h0m0s ago",
+		abandoned.ID: "failed more than 72h0m0s ago",
+	}
+	check := func(report *api.GCReport) {
+		require.Len(t, report.Tasks, len(expect))
+		for _, tsk := range report.Tasks {
+			require.Equal(t, expect[tsk.ID], tsk.Reason, tsk.ID)
+		}
+
+		paths := make(map[string]int64)
+		for _, path := range report.Paths {
+			paths[path.Path] = path.Bytes
+		}
+		require.Equal(t, map[string]int64{
+			// expired tasks, with their logs, sources and outputs.
+			filepath.Join(dirs.Daemon(), oldest.ID+".out"):    100,
+			filepath.Join(dirs.Work(), "requests", oldest.ID): 10,
+			outputs: 1000,
+			filepath.Join(dirs.Daemon(), expired.ID+".out"):      100,
+			filepath.Join(dirs.Work(), "requests", expired.ID):   10,
+			filepath.Join(dirs.Daemon(), abandoned.ID+".out"):    100,
+			filepath.Join(dirs.Work(), "requests", abandoned.ID): 10,
+			// sources of the complete tasks kept.
+			filepath.Join(dirs.Work(), "requests", recent.ID): 10,
+			filepath.Join(dirs.Work(), "requests", older.ID):  10,
+			filepath.Join(dirs.Work(), "requests", failed.ID): 10,
+			// orphans.
+			orphans[0]: 1,
+			orphans[1]: 1,
+		}, paths)
+		require.EqualValues(t, 3*100+6*10+1000+2, report.Bytes)
+	}
+
+	// a dry run deletes nothing.
+	report, err := e.collectGarbage(p, now, true)
+	require.NoError(t, err)
+	require.True(t, report.DryRun)
+	check(report)
+	for _, path := range report.Paths {
+		_, err := os.Stat(path.Path)
+		require.NoError(t, err)
+	}
+	for id := range expect {
+		_, err := e.store.Get(id)
+		require.NoError(t, err)
+	}
+
+	report, err = e.collectGarbage(p, now, false)
+	require.NoError(t, err)
+	check(report)
+	for _, path := range report.Paths {
+		_, err := os.Stat(path.Path)
+		require.True(t, os.IsNotExist(err), path.Path)
+	}
+	for id := range expect {
+		_, err := e.store.Get(id)
+		require.Error(t, err)
+	}
+
+	// the tasks kept, their logs, and the sources still needed are left.
+	for _, tsk := range []*task.Task{recent, older, failed, scheduled} {
+		_, err := e.store.Get(tsk.ID)
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(dirs.Daemon(), tsk.ID+".out"))
+	}
+	require.DirExists(t, filepath.Join(dirs.Work(), "requests", scheduled.ID))
+	require.DirExists(t, receiving)
+
+	// nothing is left to collect.
+	report, err = e.collectGarbage(p, now, false)
+	require.NoError(t, err)
+	require.Empty(t, report.Tasks)
+	require.Empty(t, report.Paths)
+}
+
+func TestCollectGarbageKeepsSourcesCopies(t *testing.T) {
+	e := homeEngine(t)
+	dirs := e.envcfg.Dirs()
+	now := time.Now()
+	old := now.Add(-2 * orphanGrace)
+
+	// writeSources writes sources, along with the copies made to build
+	// several groups, older than the orphan grace period.
+	writeSources := func(base string) []string {
+		paths := []string{base, base + "-0", base + "-1"}
+		for _, path := range paths {
+			require.NoError(t, os.MkdirAll(filepath.Join(path, "plan"), 0755))
+			require.NoError(t, ioutil.WriteFile(filepath.Join(path, "plan", "main.go"), make([]byte, 10), 0644))
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+		return paths
+	}
+
+	newTask := func() *task.Task {
+		created := now.Add(-3 * orphanGrace)
+		tsk := &task.Task{
+			ID:     xid.NewWithTime(created).String(),
+			Type:   task.TypeBuild,
+			Plan:   "ping",
+			Case:   "case",
+			States: []task.DatedState{{State: task.StateScheduled, Created: created}},
+		}
+		sources := &api.UnpackedSources{BaseDir: filepath.Join(dirs.Work(), "requests", tsk.ID)}
+		tsk.Input = &BuildInput{BuildRequest: &api.BuildRequest{}, Sources: sources}
+		require.NoError(t, e.store.PersistScheduled(tsk))
+		require.NoError(t, e.store.ProcessTask(tsk))
+		return tsk
+	}
+
+	// a task being built keeps its sources and their copies.
+	processing := newTask()
+	building := writeSources(filepath.Join(dirs.Work(), "requests", processing.ID))
+
+	// the copies of a complete task are deleted with its sources.
+	complete := newTask()
+	built := writeSources(filepath.Join(dirs.Work(), "requests", complete.ID))
+	complete.States = append(complete.States, task.DatedState{State: task.StateComplete, Created: now})
+	require.NoError(t, e.store.PersistProcessing(complete))
+	require.NoError(t, e.store.ArchiveTask(complete))
+
+	// copies of sources no task refers to are orphans.
+	orphans := writeSources(filepath.Join(dirs.Work(), "requests", "orphan"))
+
+	report, err := e.collectGarbage(retentionPolicy{}, now, false)
+	require.NoError(t, err)
+	require.Empty(t, report.Tasks)
+
+	reasons := make(map[string]string)
+	for _, path := range report.Paths {
+		reasons[path.Path] = path.Reason
+	}
+	expect := make(map[string]string)
+	for _, path := range built {
+		expect[path] = "sources of complete task " + complete.ID
+	}
+	for _, path := range orphans {
+		expect[path] = "not referred to by any task"
+	}
+	require.Equal(t, expect, reasons)
+
+	for _, path := range building {
+		require.DirExists(t, path)
+	}
+}
+
+func TestParseRetentionConfig(t *testing.T) {
+	p, err := parseRetentionConfig(config.RetentionConfig{MaxAge: "720h", MaxPerPlan: 10, FailedMaxAge: "2160h"})
+	require.NoError(t, err)
+	require.Equal(t, retentionPolicy{maxAge: 720 * time.Hour, maxPerPlan: 10, failedMaxAge: 2160 * time.Hour, interval: defaultGCInterval}, p)
+
+	for _, cfg := range []config.RetentionConfig{
+		{MaxPerPlan: -1},
+		{MaxAge: "a month"},
+		{Interval: "0s"},
+		// failed tasks are kept longer than others, not shorter.
+		{MaxAge: "720h", FailedMaxAge: "24h"},
+	} {
+		_, err := parseRetentionConfig(cfg)
+		require.Error(t, err, "%+v", cfg)
+	}
+}
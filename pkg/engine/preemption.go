@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// preemptFor preempts a running task in favour of the newly queued task tsk,
+// if all workers are busy and any of them is processing a preemptible task of
+// a lower priority. The task of the lowest priority is preempted; among
+// those, the most recently created one. Tasks waiting for prerequisites don't
+// preempt others.
+//
+// The preempted task is canceled, and scheduled again by the worker
+// processing it once it stops.
+func (e *Engine) preemptFor(tsk *task.Task) {
+	if !e.prerequisitesDone(tsk) {
+		return
+	}
+
+	e.preemptingLk.Lock()
+	defer e.preemptingLk.Unlock()
+
+	var (
+		running = e.queue.Running()
+		busy    = 0
+		victim  *task.Task
+	)
+	for _, r := range running {
+		if _, ok := e.preempting[r.ID]; ok {
+			// this worker will be free soon.
+			continue
+		}
+		busy++
+		if !r.Preemptible || r.Priority >= tsk.Priority {
+			continue
+		}
+		if victim == nil || r.Priority < victim.Priority || (r.Priority == victim.Priority && r.ID > victim.ID) {
+			victim = r
+		}
+	}
+	if victim == nil || busy < e.envcfg.Daemon.Scheduler.Workers {
+		return
+	}
+
+	logging.S().Infow("preempting task", "task_id", victim.ID, "priority", victim.Priority, "for_task_id", tsk.ID, "for_priority", tsk.Priority)
+	e.preempting[victim.ID] = struct{}{}
+	_ = e.Kill(victim.ID)
+}
+
+// prerequisitesDone returns whether all the tasks the given task depends on
+// are done.
+func (e *Engine) prerequisitesDone(tsk *task.Task) bool {
+	for _, id := range tsk.DependsOn {
+		pre, err := e.store.Get(id)
+		if err != nil {
+			return false
+		}
+		if s := pre.State().State; s == task.StateScheduled || s == task.StateProcessing {
+			return false
+		}
+	}
+	return true
+}
+
+// isPreempting returns whether the task is being preempted.
+func (e *Engine) isPreempting(tsk *task.Task) bool {
+	e.preemptingLk.Lock()
+	defer e.preemptingLk.Unlock()
+
+	_, ok := e.preempting[tsk.ID]
+	return ok
+}
+
+// preempted returns whether the task was preempted, and forgets about it.
+func (e *Engine) preempted(tsk *task.Task) bool {
+	e.preemptingLk.Lock()
+	defer e.preemptingLk.Unlock()
+
+	_, ok := e.preempting[tsk.ID]
+	delete(e.preempting, tsk.ID)
+	return ok
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestPreemptForHigherPriorityTask(t *testing.T) {
+	store, err := task.NewMemoryTaskStorage()
+	require.NoError(t, err)
+	queue, err := task.NewQueue(store, 100, UnmarshalTask, nil)
+	require.NoError(t, err)
+
+	cfg := &config.EnvConfig{}
+	cfg.Daemon.Scheduler.Workers = 2
+	e := &Engine{
+		envcfg:     cfg,
+		store:      store,
+		queue:      queue,
+		signals:    make(map[string]chan int),
+		preempting: make(map[string]struct{}),
+	}
+
+	var (
+		states   = []task.DatedState{{State: task.StateScheduled, Created: time.Now()}}
+		pinned   = &task.Task{ID: "ab4brhjpc98qra498sg0", Type: task.TypeBuild, Priority: 0, States: states}
+		low      = &task.Task{ID: "cd4brhjpc98qra498sg1", Type: task.TypeBuild, Priority: 0, States: states, Preemptible: true}
+		high     = &task.Task{ID: "cc4brhjpc98qra498sg2", Type: task.TypeBuild, Priority: 1, States: states}
+		channels = make(map[string]chan int)
+	)
+
+	// a single busy worker leaves room for the high priority task.
+	require.NoError(t, queue.Push(low))
+	_, err = queue.Pop()
+	require.NoError(t, err)
+	channels[low.ID] = make(chan int)
+	e.addSignal(low.ID, channels[low.ID])
+
+	e.preemptFor(high)
+	require.False(t, e.isPreempting(low))
+
+	// with all workers busy, the preemptible task is preempted, once.
+	require.NoError(t, queue.Push(pinned))
+	_, err = queue.Pop()
+	require.NoError(t, err)
+	channels[pinned.ID] = make(chan int)
+	e.addSignal(pinned.ID, channels[pinned.ID])
+
+	e.preemptFor(high)
+	e.preemptFor(high)
+	require.True(t, e.isPreempting(low))
+	require.False(t, e.isPreempting(pinned))
+
+	select {
+	case <-channels[low.ID]:
+	default:
+		t.Fatal("expected the preemptible task to be canceled")
+	}
+
+	require.True(t, e.preempted(low))
+	require.False(t, e.preempted(low))
+
+	// tasks of the same priority don't preempt others.
+	e.preemptFor(&task.Task{ID: "hg4brhjpc98qra566sg3", Priority: 0, States: states})
+	require.False(t, e.isPreempting(low))
+}
+
+// preemptedRunner is preempted, and killed again as a user would, right
+// before its runs succeed.
+type preemptedRunner struct {
+	fakeRunner
+	e *Engine
+}
+
+func (r *preemptedRunner) Run(ctx context.Context, in *api.RunInput, ow *rpc.OutputWriter) (*api.RunOutput, error) {
+	r.e.preemptingLk.Lock()
+	r.e.preempting[in.RunID] = struct{}{}
+	r.e.preemptingLk.Unlock()
+
+	// killing a task twice doesn't close its signal twice.
+	_ = r.e.Kill(in.RunID)
+	_ = r.e.Kill(in.RunID)
+
+	return r.fakeRunner.Run(ctx, in, ow)
+}
+
+func TestWorkerKeepsResultOfTaskPreemptedOnceDone(t *testing.T) {
+	e := homeEngine(t)
+	e.ctx = context.Background()
+	e.runners["fake"] = &preemptedRunner{
+		fakeRunner: fakeRunner{outcomes: map[string]task.Outcome{"setup": task.OutcomeSuccess}},
+		e:          e,
+	}
+	go e.worker(0)
+
+	input := stagesRunInput("")
+	input.Composition.Stages = nil
+	input.Composition.Global.Case = "setup"
+	tsk := &task.Task{
+		Version:     task.CurrentVersion,
+		ID:          xid.New().String(),
+		Type:        task.TypeRun,
+		Preemptible: true,
+		Input:       input,
+		States:      []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+	}
+	require.NoError(t, e.queue.Push(tsk))
+
+	var done *task.Task
+	require.Eventually(t, func() bool {
+		var err error
+		done, err = e.store.Get(tsk.ID)
+		return err == nil && done.State().State == task.StateComplete
+	}, 10*time.Second, 10*time.Millisecond)
+
+	outcome, err := data.DecodeTaskOutcome(done)
+	require.NoError(t, err)
+	require.Equal(t, task.OutcomeSuccess, outcome)
+	require.Len(t, done.Attempts, 1)
+	require.False(t, e.isPreempting(tsk))
+}
+
+func TestWorkerForgetsPreemptionOfTaskStoppedEarly(t *testing.T) {
+	e := homeEngine(t)
+	e.ctx = context.Background()
+
+	// the log of the task can't be created.
+	daemon := e.envcfg.Dirs().Daemon()
+	require.NoError(t, os.RemoveAll(daemon))
+	require.NoError(t, ioutil.WriteFile(daemon, nil, 0644))
+
+	tsk := &task.Task{
+		Version:     task.CurrentVersion,
+		ID:          xid.New().String(),
+		Type:        task.TypeRun,
+		Preemptible: true,
+		Input:       &RunInput{RunRequest: &api.RunRequest{}},
+		States:      []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+	}
+	require.NoError(t, e.queue.Push(tsk))
+
+	// the task is preempted as it's popped.
+	e.preempting[tsk.ID] = struct{}{}
+	go e.worker(0)
+
+	require.Eventually(t, func() bool {
+		e.signalsLk.RLock()
+		_, signaled := e.signals[tsk.ID]
+		e.signalsLk.RUnlock()
+		return !e.isPreempting(tsk) && !signaled && len(e.queue.Running()) == 0
+	}, 10*time.Second, 10*time.Millisecond)
+}
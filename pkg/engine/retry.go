@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+// classifyError returns the class of infrastructure error err belongs to, or
+// an empty string if err is attributed to the test plan. ctx is the context
+// of the task; tasks exceeding their own deadline are not retried.
+func classifyError(ctx context.Context, err error) string {
+	var (
+		herr *HealthcheckError
+		terr *TimeoutError
+	)
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return ""
+	case errors.As(err, &terr):
+		// composition timeouts are attributed to the test plan.
+		return ""
+	case errors.As(err, &herr):
+		return api.RetryOnHealthcheck
+	case errors.Is(err, runner.ErrRunnerDisabled):
+		return api.RetryOnRunnerDisabled
+	case errors.Is(err, runner.ErrSyncClient):
+		return api.RetryOnSyncService
+	case isDockerError(err):
+		return api.RetryOnDocker
+	case ctx.Err() == nil && isTimeout(err):
+		return api.RetryOnTimeout
+	}
+	return ""
+}
+
+// isDockerError returns whether err, or any error it wraps, denotes a failure
+// to reach the Docker daemon, or a failure of the daemon itself.
+func isDockerError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if client.IsErrConnectionFailed(err) || errdefs.IsUnavailable(err) || errdefs.IsSystem(err) || errdefs.IsDeadline(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTimeout returns whether err denotes an operation that timed out.
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &nerr) && nerr.Timeout())
+}
+
+// retryPolicy returns the retry policy of the task: that of its composition,
+// falling back to the policy of the daemon.
+func (e *Engine) retryPolicy(tsk *task.Task) api.RetryPolicy {
+	def := daemonRetryPolicy(e.envcfg.Daemon.Scheduler.Retry)
+
+	var comp *api.Composition
+	switch in := tsk.Input.(type) {
+	case *RunInput:
+		comp = &in.Composition
+	case *BuildInput:
+		comp = &in.Composition
+	}
+	if comp == nil || comp.Global.Retry == nil {
+		return def
+	}
+	return comp.Global.Retry.ApplyDefaults(def)
+}
+
+// daemonRetryPolicy returns the retry policy configured for the daemon.
+func daemonRetryPolicy(cfg config.RetryConfig) api.RetryPolicy {
+	return api.RetryPolicy{
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff:     cfg.Backoff,
+		MaxBackoff:  cfg.MaxBackoff,
+		On:          cfg.On,
+	}
+}
+
+// retryDelay returns the class of err, and the delay after which the task
+// failing with it is to be retried. It returns false if the task isn't to be
+// retried: if err is attributed to the test plan, if the retry policy of the
+// task doesn't cover its class, or if the task ran out of attempts.
+func (e *Engine) retryDelay(ctx context.Context, tsk *task.Task, err error) (string, time.Duration, bool) {
+	class := classifyError(ctx, err)
+	policy := e.retryPolicy(tsk)
+	if !policy.RetriesOn(class) {
+		return class, 0, false
+	}
+
+	// attempts made so far, including this one.
+	attempts := tsk.Retries() + 1
+	if attempts >= policy.MaxAttempts {
+		return class, 0, false
+	}
+	return class, policy.BackoffFor(attempts), true
+}
+
+// validateRetryConfig validates the retry policy of the daemon.
+func validateRetryConfig(cfg api.RetryPolicy) error {
+	for _, d := range []string{cfg.Backoff, cfg.MaxBackoff} {
+		if d == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+			return fmt.Errorf("invalid retry backoff: %s", d)
+		}
+	}
+	for _, c := range cfg.On {
+		if !stringInSlice(c, api.RetryClasses) {
+			return fmt.Errorf("invalid retry error class: %s; expected one of %v", c, api.RetryClasses)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestClassifyError(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		done, cf = context.WithCancel(ctx)
+	)
+	cf()
+
+	cases := []struct {
+		ctx   context.Context
+		err   error
+		class string
+	}{
+		{ctx, errors.New("compilation failed"), ""},
+		{ctx, &HealthcheckError{Component: "local:docker", Err: errors.New("sidecar not running")}, api.RetryOnHealthcheck},
+		{ctx, &TaskExecutionError{TaskType: "run", WrappedErr: runner.ErrRunnerDisabled}, api.RetryOnRunnerDisabled},
+		{ctx, fmt.Errorf("%w: connection refused", runner.ErrSyncClient), api.RetryOnSyncService},
+		{ctx, fmt.Errorf("failed to pull image: %w", client.ErrorConnectionFailed("unix:///var/run/docker.sock")), api.RetryOnDocker},
+		{ctx, fmt.Errorf("failed to pull image: %w", context.DeadlineExceeded), api.RetryOnTimeout},
+		{done, fmt.Errorf("failed to pull image: %w", context.DeadlineExceeded), ""},
+		{ctx, &TaskExecutionError{TaskType: "run", WrappedErr: context.Canceled}, ""},
+		{ctx, &TimeoutError{Phase: "build", Timeout: time.Minute}, ""},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.class, classifyError(c.ctx, c.err), "error: %v", c.err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cfg := &config.EnvConfig{}
+	cfg.Daemon.Scheduler.Retry = config.RetryConfig{MaxAttempts: 2, Backoff: "1m", On: []string{api.RetryOnHealthcheck}}
+	e := &Engine{envcfg: cfg}
+
+	var (
+		ctx  = context.Background()
+		herr = &HealthcheckError{Err: errors.New("sidecar not running")}
+		tsk  = &task.Task{Type: task.TypeRun, Input: &RunInput{RunRequest: &api.RunRequest{}}}
+	)
+
+	class, delay, ok := e.retryDelay(ctx, tsk, herr)
+	require.True(t, ok)
+	require.Equal(t, api.RetryOnHealthcheck, class)
+	require.Equal(t, time.Minute, delay)
+
+	// not covered by the policy.
+	_, _, ok = e.retryDelay(ctx, tsk, runner.ErrRunnerDisabled)
+	require.False(t, ok)
+
+	// out of attempts.
+	tsk.Attempts = []task.Attempt{{State: task.StatePreempted}, {State: task.StateRetrying}}
+	_, _, ok = e.retryDelay(ctx, tsk, herr)
+	require.False(t, ok)
+
+	// the composition overrides the daemon's policy.
+	tsk.Input.(*RunInput).Composition.Global.Retry = &api.RetryPolicy{MaxAttempts: 3, Backoff: "10s"}
+	_, delay, ok = e.retryDelay(ctx, tsk, herr)
+	require.True(t, ok)
+	require.Equal(t, 20*time.Second, delay)
+
+	require.Error(t, validateRetryConfig(api.RetryPolicy{On: []string{"flaky"}}))
+	require.Error(t, validateRetryConfig(api.RetryPolicy{Backoff: "-1s"}))
+	require.NoError(t, validateRetryConfig(daemonRetryPolicy(cfg.Daemon.Scheduler.Retry)))
+}
+
+func TestLogsFollowTaskAcrossRetries(t *testing.T) {
+	e := homeEngine(t)
+
+	tsk := &task.Task{
+		Version: task.CurrentVersion,
+		ID:      xid.New().String(),
+		Type:    task.TypeRun,
+		Input:   &RunInput{RunRequest: &api.RunRequest{}},
+		States:  []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+	}
+	require.NoError(t, e.queue.Push(tsk))
+
+	// attempt pops the task, as a worker does, and logs its output.
+	path := filepath.Join(e.envcfg.Dirs().Daemon(), tsk.ID+".out")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	attempt := func(output string) *task.Task {
+		popped, err := e.queue.Pop()
+		require.NoError(t, err)
+		popped.States = append(popped.States, task.DatedState{State: task.StateProcessing, Created: time.Now().UTC()})
+		require.NoError(t, e.store.PersistProcessing(popped))
+		e.addSignal(popped.ID, make(chan int))
+		e.queue.Notify()
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = rpc.NewFileOutputWriter(f).WriteProgress([]byte(output))
+		require.NoError(t, err)
+		return popped
+	}
+
+	var (
+		out      syncBuffer
+		followed *task.Task
+		err      error
+		done     = make(chan struct{})
+	)
+	popped := attempt("first attempt\n")
+	go func() {
+		followed, err = e.Logs(context.Background(), tsk.ID, true, false, &out)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return out.Len() > 0 }, 10*time.Second, 10*time.Millisecond)
+
+	// the task fails and is scheduled again, with its signal deleted as the
+	// worker does; its logs are still followed.
+	popped.States = append(popped.States, task.DatedState{State: task.StateRetrying, Created: time.Now().UTC()})
+	e.deleteSignal(popped.ID)
+	require.NoError(t, e.queue.Requeue(popped))
+	select {
+	case <-done:
+		t.Fatal("stopped following a task scheduled again")
+	case <-time.After(5 * time.Second):
+	}
+
+	popped = attempt("second attempt\n")
+	popped.States = append(popped.States, task.DatedState{State: task.StateComplete, Created: time.Now().UTC()})
+	require.NoError(t, e.store.PersistProcessing(popped))
+	require.NoError(t, e.store.ArchiveTask(popped))
+	e.deleteSignal(popped.ID)
+	e.queue.Release(popped)
+
+	select {
+	case <-done:
+		require.NoError(t, err)
+		require.Equal(t, task.StateComplete, followed.State().State)
+	case <-time.After(10 * time.Second):
+		t.Fatal("still following a complete task")
+	}
+
+	var logs string
+	dec := json.NewDecoder(&out.Buffer)
+	for dec.More() {
+		var chunk rpc.Chunk
+		require.NoError(t, dec.Decode(&chunk))
+		b, err := base64.StdEncoding.DecodeString(chunk.Payload.(string))
+		require.NoError(t, err)
+		logs += string(b)
+	}
+	require.Equal(t, "first attempt\nsecond attempt\n", logs)
+}
+
+// syncBuffer is a buffer safe for concurrent use.
+type syncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Len()
+}
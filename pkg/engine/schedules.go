@@ -0,0 +1,502 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/otiai10/copy"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/xid"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+)
+
+const (
+	// scheduleExecutions is the number of past executions kept per schedule.
+	scheduleExecutions = 10
+
+	// scheduleUpcoming is the number of upcoming executions listed per
+	// schedule.
+	scheduleUpcoming = 5
+)
+
+var (
+	// cronParser parses the cron expressions of schedules: five fields, or
+	// descriptors such as "@daily".
+	cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+	// scheduleIDRegexp matches valid schedule IDs; they name directories.
+	scheduleIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// schedule is a composition run on a recurring schedule. Schedules are
+// persisted under the daemon directory, along with the sources of those
+// registered through the API.
+type schedule struct {
+	ID     string `json:"id"`
+	Cron   string `json:"cron"`
+	Source string `json:"source"`
+
+	// Run is the run request queued by schedules registered through the API.
+	Run *api.RunRequest `json:"run,omitempty"`
+
+	// Sources are the sources submitted along with Run, if any.
+	Sources *api.UnpackedSources `json:"sources,omitempty"`
+
+	// Composition is the path to the composition file run by schedules
+	// declared in the configuration.
+	Composition string `json:"composition,omitempty"`
+
+	Executions []api.ScheduleExecution `json:"executions"`
+
+	spec  cron.Schedule
+	entry cron.EntryID
+}
+
+// scheduler queues the runs of schedules on their cron expressions.
+type scheduler struct {
+	e    *Engine
+	dir  string
+	cron *cron.Cron
+
+	lk        sync.Mutex
+	schedules map[string]*schedule
+}
+
+// newScheduler starts a scheduler running the schedules declared in the
+// configuration, and those previously registered through the API.
+func newScheduler(e *Engine) (*scheduler, error) {
+	s := &scheduler{
+		e:         e,
+		dir:       filepath.Join(e.envcfg.Dirs().Daemon(), "schedules"),
+		cron:      cron.New(cron.WithParser(cronParser)),
+		schedules: make(map[string]*schedule),
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create schedules directory: %w", err)
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for _, cfg := range e.envcfg.Daemon.Schedules {
+		if cfg.Composition == "" {
+			return nil, fmt.Errorf("invalid schedule %s: no composition file", cfg.ID)
+		}
+		sch := &schedule{
+			ID:          cfg.ID,
+			Cron:        cfg.Cron,
+			Source:      api.ScheduleSourceConfig,
+			Composition: cfg.Composition,
+		}
+		// restore the executions recorded before a restart.
+		if prev, err := s.load(cfg.ID); err == nil && prev.Source == api.ScheduleSourceConfig {
+			sch.Executions = prev.Executions
+		}
+		if err := s.register(sch); err != nil {
+			return nil, fmt.Errorf("invalid schedule %s: %w", cfg.ID, err)
+		}
+	}
+
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedules directory: %w", err)
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		sch, err := s.load(fi.Name())
+		if err != nil {
+			logging.S().Warnw("failed to load schedule; skipping", "schedule", fi.Name(), "err", err)
+			continue
+		}
+		if sch.Source != api.ScheduleSourceAPI {
+			continue
+		}
+		if err := s.register(sch); err != nil {
+			logging.S().Warnw("invalid schedule; skipping", "schedule", sch.ID, "err", err)
+		}
+	}
+
+	s.cron.Start()
+	return s, nil
+}
+
+// register validates the schedule, and adds it to the cron. s.lk must be held.
+func (s *scheduler) register(sch *schedule) error {
+	if !scheduleIDRegexp.MatchString(sch.ID) {
+		return fmt.Errorf("invalid schedule id: %q", sch.ID)
+	}
+	if _, ok := s.schedules[sch.ID]; ok {
+		return fmt.Errorf("schedule %s already exists", sch.ID)
+	}
+	spec, err := cronParser.Parse(sch.Cron)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", sch.Cron, err)
+	}
+
+	id := sch.ID
+	sch.spec = spec
+	sch.entry = s.cron.Schedule(spec, cron.FuncJob(func() { s.fire(id) }))
+	s.schedules[id] = sch
+	return nil
+}
+
+// add registers a schedule queueing the run request of the supplied schedule
+// request. The sources of the request are copied under the directory of the
+// schedule.
+func (s *scheduler) add(req *api.ScheduleRequest, sources *api.UnpackedSources) error {
+	if !scheduleIDRegexp.MatchString(req.ID) {
+		return fmt.Errorf("invalid schedule id: %q", req.ID)
+	}
+	if _, err := cronParser.Parse(req.Cron); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", req.Cron, err)
+	}
+
+	run := req.Run
+	if err := run.Composition.ValidateForRun(); err != nil {
+		return fmt.Errorf("invalid composition: %w", err)
+	}
+	if err := s.e.validateManifest(&run.Manifest); err != nil {
+		return err
+	}
+	if _, ok := s.e.runners[run.Composition.Global.Runner]; !ok {
+		return fmt.Errorf("unknown runner: %s", run.Composition.Global.Runner)
+	}
+	if len(run.BuildGroups) > 0 && (sources == nil || sources.PlanDir == "") {
+		return fmt.Errorf("plan dir required for build")
+	}
+	run.Sweep = nil
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if _, ok := s.schedules[req.ID]; ok {
+		return fmt.Errorf("schedule %s already exists", req.ID)
+	}
+
+	// clear any leftovers of a schedule with the same ID.
+	dir := filepath.Join(s.dir, req.ID)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	sch := &schedule{
+		ID:     req.ID,
+		Cron:   req.Cron,
+		Source: api.ScheduleSourceAPI,
+		Run:    &run,
+	}
+
+	var err error
+	if sources != nil {
+		if sch.Sources, err = copySources(sources, dir); err != nil {
+			_ = os.RemoveAll(dir)
+			return fmt.Errorf("failed to store sources: %w", err)
+		}
+	}
+	if err = s.persist(sch); err == nil {
+		err = s.register(sch)
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return err
+	}
+
+	logging.S().Infow("registered schedule", "schedule", sch.ID, "cron", sch.Cron)
+	return nil
+}
+
+// delete unregisters the schedule, and removes its directory. Schedules
+// declared in the configuration can't be deleted.
+func (s *scheduler) delete(id string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	sch, ok := s.schedules[id]
+	if !ok {
+		return fmt.Errorf("unknown schedule: %s", id)
+	}
+	if sch.Source == api.ScheduleSourceConfig {
+		return fmt.Errorf("schedule %s is declared in the daemon configuration", id)
+	}
+
+	s.cron.Remove(sch.entry)
+	delete(s.schedules, id)
+
+	logging.S().Infow("deleted schedule", "schedule", id)
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+// list describes all schedules, ordered by ID.
+func (s *scheduler) list(now time.Time) []api.Schedule {
+	s.lk.Lock()
+	schs := make([]*schedule, 0, len(s.schedules))
+	res := make([]api.Schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		schs = append(schs, sch)
+		res = append(res, api.Schedule{
+			ID:         sch.ID,
+			Cron:       sch.Cron,
+			Source:     sch.Source,
+			Executions: append([]api.ScheduleExecution(nil), sch.Executions...),
+		})
+	}
+	s.lk.Unlock()
+
+	for i, sch := range schs {
+		if sch.Run != nil {
+			res[i].Plan, res[i].Case = sch.Run.Composition.Global.Plan, sch.Run.Composition.Global.Case
+		} else if comp, err := loadScheduledComposition(sch.Composition); err == nil {
+			res[i].Plan, res[i].Case = comp.Global.Plan, comp.Global.Case
+		}
+
+		for t, n := now, 0; n < scheduleUpcoming; n++ {
+			if t = sch.spec.Next(t); t.IsZero() {
+				break
+			}
+			res[i].Upcoming = append(res[i].Upcoming, t)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// fire queues a run of the schedule, and records the execution.
+func (s *scheduler) fire(id string) {
+	s.lk.Lock()
+	sch, ok := s.schedules[id]
+	s.lk.Unlock()
+	if !ok {
+		return
+	}
+
+	exec := api.ScheduleExecution{Time: time.Now().UTC()}
+	if tid, err := s.queue(sch); err != nil {
+		logging.S().Warnw("failed to queue scheduled run", "schedule", id, "err", err)
+		exec.Error = err.Error()
+	} else {
+		logging.S().Infow("queued scheduled run", "schedule", id, "task_id", tid)
+		exec.TaskID = tid
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if cur, ok := s.schedules[id]; !ok || cur != sch {
+		// the schedule was deleted in the meantime.
+		return
+	}
+	sch.Executions = append(sch.Executions, exec)
+	if n := len(sch.Executions); n > scheduleExecutions {
+		sch.Executions = sch.Executions[n-scheduleExecutions:]
+	}
+	if err := s.persist(sch); err != nil {
+		logging.S().Warnw("failed to persist schedule", "schedule", id, "err", err)
+	}
+}
+
+// queue queues a run of the schedule, on a fresh copy of its sources.
+func (s *scheduler) queue(sch *schedule) (string, error) {
+	var (
+		req     *api.RunRequest
+		sources *api.UnpackedSources
+		err     error
+		dir     = filepath.Join(s.e.envcfg.Dirs().Work(), "requests", xid.New().String())
+	)
+
+	switch sch.Source {
+	case api.ScheduleSourceAPI:
+		// the engine modifies requests, so work on a copy.
+		if req, err = cloneRunRequest(sch.Run); err != nil {
+			return "", err
+		}
+		if sch.Sources != nil {
+			if sources, err = copySources(sch.Sources, dir); err != nil {
+				return "", fmt.Errorf("failed to copy sources: %w", err)
+			}
+		}
+	default:
+		if req, sources, err = s.prepareComposition(sch.Composition, dir); err != nil {
+			return "", err
+		}
+	}
+
+	req.CreatedBy = api.ScheduleCreatedBy(sch.ID)
+	return s.e.QueueRun(req, sources)
+}
+
+// prepareComposition loads the composition file, and resolves its test plan
+// under the plans directory. The plan sources are copied under dir if any
+// group needs to be built.
+func (s *scheduler) prepareComposition(path string, dir string) (*api.RunRequest, *api.UnpackedSources, error) {
+	comp, err := loadScheduledComposition(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	planDir := filepath.Join(s.e.envcfg.Dirs().Plans(), filepath.FromSlash(comp.Global.Plan))
+	manifest := new(api.TestPlanManifest)
+	if _, err := toml.DecodeFile(filepath.Join(planDir, "manifest.toml"), manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to load manifest of plan %s: %w", comp.Global.Plan, err)
+	}
+
+	req := &api.RunRequest{
+		Composition: *comp,
+		Manifest:    *manifest,
+	}
+	for i, grp := range comp.Groups {
+		if grp.Run.Artifact == "" {
+			req.BuildGroups = append(req.BuildGroups, i)
+		}
+	}
+	if len(req.BuildGroups) == 0 {
+		return req, nil, nil
+	}
+
+	// follow any symlinks in the plan dir.
+	if planDir, err = filepath.EvalSymlinks(planDir); err != nil {
+		return nil, nil, fmt.Errorf("failed to follow symlinks in plan dir: %w", err)
+	}
+
+	sources := &api.UnpackedSources{
+		BaseDir: dir,
+		PlanDir: filepath.Join(dir, "plan"),
+	}
+	if err := copy.Copy(planDir, sources.PlanDir); err != nil {
+		return nil, nil, fmt.Errorf("failed to copy plan sources: %w", err)
+	}
+
+	builder := strings.Replace(comp.Global.Builder, ":", "_", -1)
+	for _, extra := range manifest.ExtraSources[builder] {
+		if !filepath.IsAbs(extra) {
+			extra = filepath.Join(planDir, extra)
+		}
+		if extra, err = filepath.EvalSymlinks(extra); err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve extra sources: %w", err)
+		}
+		sources.ExtraDir = filepath.Join(dir, "extra")
+		if err := copy.Copy(extra, filepath.Join(sources.ExtraDir, filepath.Base(extra))); err != nil {
+			return nil, nil, fmt.Errorf("failed to copy extra sources: %w", err)
+		}
+	}
+	return req, sources, nil
+}
+
+// load reads the persisted schedule with the given ID.
+func (s *scheduler) load(id string) (*schedule, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, id, "schedule.json"))
+	if err != nil {
+		return nil, err
+	}
+	sch := new(schedule)
+	if err := json.Unmarshal(b, sch); err != nil {
+		return nil, err
+	}
+	if sch.ID != id {
+		return nil, fmt.Errorf("schedule id mismatch: %s", sch.ID)
+	}
+	return sch, nil
+}
+
+// persist writes the schedule to its directory.
+func (s *scheduler) persist(sch *schedule) error {
+	dir := filepath.Join(s.dir, sch.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(sch, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "schedule.json"), b, 0644)
+}
+
+// loadScheduledComposition loads the composition file of a schedule declared
+// in the configuration. Compositions expanding into a matrix can't be
+// scheduled.
+func loadScheduledComposition(path string) (*api.Composition, error) {
+	comp := new(api.Composition)
+	if _, err := toml.DecodeFile(path, comp); err != nil {
+		return nil, fmt.Errorf("failed to load composition file %s: %w", path, err)
+	}
+	comps, err := comp.ExpandMatrix()
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand composition matrix: %w", err)
+	}
+	if len(comps) != 1 {
+		return nil, fmt.Errorf("composition file %s expands to %d matrix points; only single runs can be scheduled", path, len(comps))
+	}
+	if err := comps[0].ValidateForRun(); err != nil {
+		return nil, fmt.Errorf("invalid composition file %s: %w", path, err)
+	}
+	return comps[0], nil
+}
+
+// cloneRunRequest returns a deep copy of the run request.
+func cloneRunRequest(req *api.RunRequest) (*api.RunRequest, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	cpy := new(api.RunRequest)
+	return cpy, json.Unmarshal(b, cpy)
+}
+
+// copySources copies the sources under the base directory dst, preserving
+// their layout, so that builds can't alter the originals.
+func copySources(src *api.UnpackedSources, dst string) (*api.UnpackedSources, error) {
+	out := &api.UnpackedSources{BaseDir: dst}
+	for _, d := range []struct {
+		from string
+		to   *string
+	}{
+		{src.PlanDir, &out.PlanDir},
+		{src.SDKDir, &out.SDKDir},
+		{src.ExtraDir, &out.ExtraDir},
+	} {
+		if d.from == "" {
+			continue
+		}
+		*d.to = filepath.Join(dst, filepath.Base(d.from))
+		if err := copy.Copy(d.from, *d.to); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// AddSchedule registers a schedule queueing the run request on its cron
+// expression.
+func (e *Engine) AddSchedule(request *api.ScheduleRequest, sources *api.UnpackedSources) error {
+	return e.schedules.add(request, sources)
+}
+
+// DeleteSchedule deletes a schedule registered through the API.
+func (e *Engine) DeleteSchedule(id string) error {
+	return e.schedules.delete(id)
+}
+
+// Schedules describes all schedules, along with their upcoming and last
+// executions.
+func (e *Engine) Schedules() ([]api.Schedule, error) {
+	return e.schedules.list(time.Now()), nil
+}
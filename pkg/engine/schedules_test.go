@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+const scheduleManifest = `
+name = "plan"
+
+[builders]
+"docker:go" = { enabled = true }
+
+[runners]
+"fake" = { enabled = true }
+
+[[testcases]]
+name = "ok"
+instances = { min = 1, max = 1, default = 1 }
+`
+
+const scheduleComposition = `
+[global]
+plan = "plan"
+case = "ok"
+builder = "docker:go"
+runner = "fake"
+total_instances = 1
+
+[[groups]]
+id = "single"
+instances = { count = 1 }
+run = { artifact = "plan:latest" }
+`
+
+// scheduleEngine returns an engine with no workers, whose home directory
+// holds a test plan, and declares a schedule of a composition running it.
+func scheduleEngine(t *testing.T) *Engine {
+	e := homeEngine(t)
+	home := e.envcfg.Dirs().Home()
+
+	plan := filepath.Join(e.envcfg.Dirs().Plans(), "plan")
+	require.NoError(t, os.MkdirAll(plan, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(plan, "manifest.toml"), []byte(scheduleManifest), 0644))
+
+	comp := filepath.Join(home, "nightly.toml")
+	require.NoError(t, ioutil.WriteFile(comp, []byte(scheduleComposition), 0644))
+	e.envcfg.Daemon.Schedules = []config.ScheduleConfig{{ID: "nightly", Cron: "0 2 * * *", Composition: comp}}
+
+	return e
+}
+
+func TestSchedulerQueuesConfiguredComposition(t *testing.T) {
+	e := scheduleEngine(t)
+
+	s, err := newScheduler(e)
+	require.NoError(t, err)
+	defer s.cron.Stop()
+
+	s.fire("nightly")
+
+	schedules := s.list(time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local))
+	require.Len(t, schedules, 1)
+	sch := schedules[0]
+	require.Equal(t, api.ScheduleSourceConfig, sch.Source)
+	require.Equal(t, "plan", sch.Plan)
+	require.Equal(t, "ok", sch.Case)
+
+	require.Len(t, sch.Upcoming, scheduleUpcoming)
+	require.Equal(t, time.Date(2026, 1, 2, 2, 0, 0, 0, time.Local), sch.Upcoming[0])
+	require.Equal(t, time.Date(2026, 1, 3, 2, 0, 0, 0, time.Local), sch.Upcoming[1])
+
+	require.Len(t, sch.Executions, 1)
+	require.Empty(t, sch.Executions[0].Error)
+
+	tsk, err := e.store.Get(sch.Executions[0].TaskID)
+	require.NoError(t, err)
+	require.Equal(t, task.TypeRun, tsk.Type)
+	require.Equal(t, "schedule:nightly", tsk.CreatedBy.User)
+
+	// executions survive a restart.
+	s.cron.Stop()
+	s, err = newScheduler(e)
+	require.NoError(t, err)
+	defer s.cron.Stop()
+
+	schedules = s.list(time.Now())
+	require.Len(t, schedules, 1)
+	require.Len(t, schedules[0].Executions, 1)
+
+	require.Error(t, s.delete("nightly"))
+}
+
+func TestSchedulerQueuesRegisteredRequest(t *testing.T) {
+	e := scheduleEngine(t)
+	e.envcfg.Daemon.Schedules = nil
+
+	s, err := newScheduler(e)
+	require.NoError(t, err)
+	defer s.cron.Stop()
+
+	// sources as unpacked by the daemon.
+	base := filepath.Join(e.envcfg.Dirs().Work(), "requests", "req")
+	sources := &api.UnpackedSources{BaseDir: base, PlanDir: filepath.Join(base, "plan")}
+	require.NoError(t, os.MkdirAll(sources.PlanDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(sources.PlanDir, "main.go"), []byte("package main"), 0644))
+
+	comp, err := loadScheduledComposition(filepath.Join(e.envcfg.Dirs().Home(), "nightly.toml"))
+	require.NoError(t, err)
+	comp.Groups[0].Run.Artifact = ""
+
+	manifest := new(api.TestPlanManifest)
+	_, err = toml.Decode(scheduleManifest, manifest)
+	require.NoError(t, err)
+
+	req := &api.ScheduleRequest{
+		ID:   "hourly",
+		Cron: "@hourly",
+		Run: api.RunRequest{
+			BuildGroups: []int{0},
+			Composition: *comp,
+			Manifest:    *manifest,
+		},
+	}
+
+	bad := *req
+	bad.Cron = "every hour"
+	require.Error(t, s.add(&bad, sources))
+
+	require.NoError(t, s.add(req, sources))
+	require.Error(t, s.add(req, sources), "duplicate schedule")
+
+	// the daemon removes the unpacked sources once registered.
+	require.NoError(t, os.RemoveAll(base))
+
+	s.fire("hourly")
+	s.fire("hourly")
+
+	schedules := s.list(time.Now())
+	require.Len(t, schedules, 1)
+	require.Equal(t, api.ScheduleSourceAPI, schedules[0].Source)
+	require.Len(t, schedules[0].Executions, 2)
+
+	// every execution builds a copy of the stored sources.
+	dirs := make(map[string]string)
+	for range schedules[0].Executions {
+		tsk, err := e.queue.Pop()
+		require.NoError(t, err)
+		require.Equal(t, "schedule:hourly", tsk.CreatedBy.User)
+
+		in := tsk.Input.(*RunInput)
+		require.FileExists(t, filepath.Join(in.Sources.PlanDir, "main.go"))
+		dirs[tsk.ID] = in.Sources.BaseDir
+	}
+	for _, exec := range schedules[0].Executions {
+		require.Empty(t, exec.Error)
+		require.Contains(t, dirs, exec.TaskID)
+	}
+	require.NotEqual(t, dirs[schedules[0].Executions[0].TaskID], dirs[schedules[0].Executions[1].TaskID])
+
+	// registered schedules survive a restart, until deleted.
+	s.cron.Stop()
+	s, err = newScheduler(e)
+	require.NoError(t, err)
+	defer s.cron.Stop()
+
+	require.Len(t, s.list(time.Now()), 1)
+	require.NoError(t, s.delete("hourly"))
+	require.Empty(t, s.list(time.Now()))
+	require.NoDirExists(t, filepath.Join(s.dir, "hourly"))
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -44,6 +45,19 @@ func (e *Engine) deleteSignal(id string) {
 	e.signalsLk.Unlock()
 }
 
+// signal cancels the task being processed, if any. Its signal is deleted
+// before being closed, so that a task killed several times, such as by a
+// user while being preempted, is only signaled once.
+func (e *Engine) signal(id string) {
+	e.signalsLk.Lock()
+	defer e.signalsLk.Unlock()
+
+	if ch, ok := e.signals[id]; ok {
+		delete(e.signals, id)
+		close(ch)
+	}
+}
+
 func (e *Engine) worker(n int) {
 	logging.S().Infow("supervisor worker started", "worker_id", n)
 
@@ -53,42 +67,54 @@ func (e *Engine) worker(n int) {
 	}
 
 	for {
-		tsk, err := e.queue.Pop()
-		if err == task.ErrQueueEmpty {
-			time.Sleep(time.Second)
-			continue
-		}
-
+		tsk, err := e.queue.PopWait(e.ctx)
 		if err != nil {
 			logging.S().Errorw("error while popping task from the queue", "err", err)
 			continue
 		}
 
 		func() {
-			ctx, cancel := context.WithTimeout(context.Background(), taskTimeout)
+			// preempted and retried tasks are released when scheduled again.
+			requeued := false
+			defer func() {
+				if !requeued {
+					// tasks preempted while stopping aren't scheduled again.
+					e.preempted(tsk)
+					e.deleteSignal(tsk.ID)
+					e.queue.Release(tsk)
+				}
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), e.taskTimeout(tsk, taskTimeout))
 			defer cancel()
 
 			ch := make(chan int)
 			e.addSignal(tsk.ID, ch)
+			if e.isPreempting(tsk) {
+				// preempted before its signal was registered.
+				cancel()
+			}
 
 			go func() {
 				select {
 				case <-ch:
-					e.deleteSignal(tsk.ID)
+					// the signal was deleted when closed.
 					cancel()
 				case <-ctx.Done():
 					return
 				}
 			}()
 
+			attempt := task.Attempt{Started: time.Now().UTC()}
 			tsk.States = append(tsk.States, task.DatedState{
 				State:   task.StateProcessing,
-				Created: time.Now().UTC(),
+				Created: attempt.Started,
 			})
 			err = e.store.PersistProcessing(tsk)
 			if err != nil {
 				logging.S().Errorw("could not persist task", "err", err)
 			}
+			e.queue.Notify()
 			logging.S().Infow("worker processing task", "worker_id", n, "task_id", tsk.ID)
 			err = e.postStatusToGithub(tsk)
 			if err != nil {
@@ -104,7 +130,15 @@ func (e *Engine) worker(n int) {
 			}
 			defer f.Close()
 
+			// the output of all attempts goes to the same log.
+			if fi, err := f.Stat(); err == nil {
+				attempt.LogOffset = fi.Size()
+			}
+
 			ow := rpc.NewFileOutputWriter(f)
+			if len(tsk.Attempts) > 0 {
+				ow.Infow("starting new attempt", "task_id", tsk.ID, "attempt", len(tsk.Attempts)+1)
+			}
 
 			var result interface{}
 			var errTask error
@@ -143,25 +177,58 @@ func (e *Engine) worker(n int) {
 				return
 			}
 
+			// requeue schedules the task again after this attempt.
+			requeue := func(state task.State) {
+				attempt.Ended = time.Now().UTC()
+				attempt.State = state
+				tsk.Attempts = append(tsk.Attempts, attempt)
+				tsk.States = append(tsk.States, task.DatedState{
+					Created: attempt.Ended,
+					State:   state,
+				})
+				e.deleteSignal(tsk.ID)
+				if err := e.queue.Requeue(tsk); err != nil {
+					logging.S().Errorw("could not requeue task", "task_id", tsk.ID, "err", err)
+					return
+				}
+				requeued = true
+			}
+
+			// tasks done before being killed keep their result.
+			if e.preempted(tsk) && errTask != nil && ctx.Err() == context.Canceled {
+				ow.Warnw("task preempted by a higher priority task; scheduling it again", "task_id", tsk.ID)
+				requeue(task.StatePreempted)
+				logging.S().Infow("worker preempted task", "worker_id", n, "task_id", tsk.ID)
+				return
+			}
+
+			if errTask != nil {
+				class, delay, retry := e.retryDelay(ctx, tsk, errTask)
+				attempt.Error, attempt.ErrorClass = errTask.Error(), class
+				if retry {
+					ow.Warnw("task failed because of an infrastructure error; scheduling it again", "task_id", tsk.ID, "class", class, "retry_in", delay, "err", errTask)
+					tsk.RetryAt = time.Now().Add(delay).UTC()
+					requeue(task.StateRetrying)
+					logging.S().Infow("worker scheduled task for retry", "worker_id", n, "task_id", tsk.ID, "class", class, "retry_at", tsk.RetryAt)
+					return
+				}
+			}
+
 			newState := task.DatedState{
 				Created: time.Now().UTC(),
 				State:   task.StateComplete,
 			}
 			if errTask != nil {
 				tsk.Error = errTask.Error()
-
-				var e *TaskExecutionError
-				if errors.As(errTask, &e) || errors.Is(errTask, context.Canceled) {
-					newState.State = task.StateCanceled
-					logging.S().Errorw("task cancelled due to error", "err", errTask)
-				} else {
-					logging.S().Infow("Task encountered error, but was not canceled.")
-				}
+				newState.State, result = taskErrorState(errTask, result)
 			}
 
 			tsk.States = append(tsk.States, newState)
 			tsk.Result = result
 
+			attempt.Ended, attempt.State = newState.Created, newState.State
+			tsk.Attempts = append(tsk.Attempts, attempt)
+
 			err = e.store.PersistProcessing(tsk)
 			if err != nil {
 				logging.S().Errorw("could not persist task", "err", err)
@@ -173,6 +240,7 @@ func (e *Engine) worker(n int) {
 				logging.S().Errorw("could not archive task", "err", err)
 				return
 			}
+			e.recordDuration(tsk)
 
 			err = e.postStatusToSlack(tsk)
 			if err != nil {
@@ -189,6 +257,55 @@ func (e *Engine) worker(n int) {
 	}
 }
 
+// taskTimeoutGrace is added to the timeouts declared by a composition when
+// computing the deadline of its task, so that the supervisor has time to
+// stop the timed out phase and record its outcome.
+const taskTimeoutGrace = time.Minute
+
+// taskTimeout returns the deadline of a task. It is the daemon-wide task
+// timeout, unless the composition of the task declares its own timeouts, in
+// which case phases without one are given the daemon-wide timeout.
+func (e *Engine) taskTimeout(tsk *task.Task, def time.Duration) time.Duration {
+	var (
+		comp   *api.Composition
+		build  bool
+		run    bool
+		result time.Duration
+	)
+	switch in := tsk.Input.(type) {
+	case *BuildInput:
+		comp, build = &in.Composition, true
+	case *RunInput:
+		comp, build, run = &in.Composition, len(in.BuildGroups) > 0, true
+	default:
+		return def
+	}
+
+	bt, rt := comp.Global.BuildTimeoutDuration(), comp.Global.TimeoutDuration()
+	if bt == 0 && rt == 0 {
+		return def
+	}
+	if build {
+		if bt == 0 {
+			bt = def
+		}
+		result += bt
+	}
+	if run {
+		if rt == 0 {
+			rt = def
+		}
+		result += rt
+	}
+	return result + taskTimeoutGrace
+}
+
+// timedOut returns whether ctx expired because of its own deadline, rather
+// than because its parent was canceled or expired.
+func timedOut(ctx, parent context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil
+}
+
 func (e *Engine) postStatusToGithub(tsk *task.Task) error {
 	if e.envcfg.Daemon.GithubRepoStatusToken == "" {
 		return nil
@@ -225,6 +342,9 @@ func (e *Engine) postStatusToGithub(tsk *task.Task) error {
 		case task.OutcomeFailure:
 			msg = "Testplan run failed!"
 			state = "failure"
+		case task.OutcomeTimeout:
+			msg = "Testplan run timed out!"
+			state = "failure"
 		case task.OutcomeUnknown:
 			return errors.New("can't post update to github: task outcome is unknown")
 		}
@@ -277,6 +397,8 @@ func (e *Engine) postStatusToSlack(tsk *task.Task) error {
 		payload = fmt.Sprintf(`{"text":"⚪ <https://ci.testground.ipfs.team/tasks#taskID_%s|%s> *%s* run canceled %s ; %s"}`, tsk.ID, tsk.ID, tsk.Name(), tsk.Took(), tsk.Error)
 	case task.OutcomeFailure:
 		payload = fmt.Sprintf(`{"text":"❌ <https://ci.testground.ipfs.team/tasks#taskID_%s|%s> *%s* run failed (%s) %s ; %s"}`, tsk.ID, tsk.ID, tsk.Name(), result, tsk.Took(), tsk.Error)
+	case task.OutcomeTimeout:
+		payload = fmt.Sprintf(`{"text":"⏱ <https://ci.testground.ipfs.team/tasks#taskID_%s|%s> *%s* run timed out (%s) %s"}`, tsk.ID, tsk.ID, tsk.Name(), result, tsk.Took())
 	}
 
 	cl := &http.Client{Timeout: time.Second * 10}
@@ -295,7 +417,29 @@ func (e *Engine) postStatusToSlack(tsk *task.Task) error {
 	return nil
 }
 
-func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputWriter) ([]*api.BuildOutput, error) {
+// taskErrorState returns the state a task that failed with errTask ends in,
+// and the result to record. Tasks that exceeded a timeout of their
+// composition complete with a timeout outcome; tasks that failed to execute
+// are canceled.
+func taskErrorState(errTask error, result interface{}) (task.State, interface{}) {
+	var (
+		terr *TimeoutError
+		eerr *TaskExecutionError
+	)
+	switch {
+	case errors.As(errTask, &terr):
+		logging.S().Warnw("task timed out", "err", errTask)
+		return task.StateComplete, map[string]interface{}{"outcome": task.OutcomeTimeout}
+	case errors.As(errTask, &eerr) || errors.Is(errTask, context.Canceled):
+		logging.S().Errorw("task cancelled due to error", "err", errTask)
+		return task.StateCanceled, result
+	default:
+		logging.S().Infow("Task encountered error, but was not canceled.")
+		return task.StateComplete, result
+	}
+}
+
+func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputWriter) (_ []*api.BuildOutput, err error) {
 	sources := input.Sources
 	comp, err := input.Composition.PrepareForBuild(&input.Manifest)
 
@@ -311,6 +455,21 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 		plan = clean(comp.Global.Plan)
 	)
 
+	// Enforce the build timeout of the composition, if any.
+	if timeout := comp.Global.BuildTimeoutDuration(); timeout > 0 {
+		parent := ctx
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		defer func() {
+			if err != nil && timedOut(ctx, parent) {
+				ow.Warnw("build timed out", "plan", plan, "timeout", timeout)
+				err = &TimeoutError{Phase: "build", Timeout: timeout}
+			}
+		}()
+	}
+
 	// Validate builders we use
 	usedBuilders := comp.ListBuilders()
 
@@ -331,9 +490,9 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 			ow.Info("performing healthcheck on builder")
 
 			if rep, err := hc.Healthcheck(ctx, e, ow, true); err != nil {
-				return nil, fmt.Errorf("healthcheck and fix errored: %w", err)
+				return nil, &HealthcheckError{Component: b, Err: fmt.Errorf("healthcheck and fix errored: %w", err)}
 			} else if !rep.FixesSucceeded() {
-				return nil, fmt.Errorf("healthcheck fixes failed; aborting:\n%s", rep)
+				return nil, &HealthcheckError{Component: b, Err: fmt.Errorf("healthcheck fixes failed; aborting:\n%s", rep)}
 			} else if !rep.ChecksSucceeded() {
 				ow.Warnf(aurora.Bold(aurora.Yellow("some healthchecks failed, but continuing")).String())
 			} else {
@@ -431,6 +590,9 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 				deps[dep.Module] = api.DependencyTarget{
 					Target:  dep.Target,
 					Version: dep.Version,
+					Git:     dep.Git,
+					Ref:     dep.Ref,
+					Path:    dep.Path,
 				}
 			}
 
@@ -492,6 +654,12 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 }
 
 func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.OutputWriter) (*api.RunOutput, error) {
+	if len(input.DependsOn) > 0 {
+		if err := e.reuseArtifacts(input, ow); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(input.BuildGroups) > 0 {
 		bcomp, err := input.Composition.PickGroups(input.BuildGroups...)
 		if err != nil {
@@ -505,6 +673,10 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 			},
 			Sources: input.Sources,
 		}, ow)
+		var terr *TimeoutError
+		if errors.As(err, &terr) {
+			return timeoutOutput(id, input.Composition, nil), nil
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -517,7 +689,259 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 		}
 	}
 
-	comp, err := input.Composition.PrepareForRun(&input.Manifest)
+	// Enforce the run timeout of the composition, if any.
+	timeout := input.Composition.Global.TimeoutDuration()
+	rctx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var (
+		out *api.RunOutput
+		err error
+	)
+	if len(input.Composition.Stages) > 0 {
+		out, err = e.doRunStages(rctx, id, input, ow)
+	} else {
+		out, err = e.runComposition(rctx, id, input.Composition, &input.Manifest, ow)
+	}
+
+	if timeout > 0 && timedOut(rctx, ctx) {
+		ow.Warnw("run timed out", "run_id", id, "timeout", timeout)
+		out, err = timeoutOutput(id, input.Composition, out), nil
+	}
+
+	// Report the outcome of each combination of versions of a dependency
+	// matrix.
+	if variants := input.Composition.Metadata.DependencyVariants; len(variants) > 0 && out != nil {
+		if result, ok := out.Result.(*runner.Result); ok && result != nil {
+			result.AddDependencyMatrix(variants)
+		}
+	}
+	return out, err
+}
+
+// reuseArtifacts assigns the artifacts produced by the prerequisite build
+// tasks of a run to the groups of the run that need building, when they share
+// a build key. Those groups are no longer built by the run.
+func (e *Engine) reuseArtifacts(input *RunInput, ow *rpc.OutputWriter) error {
+	keys, err := buildKeys(input.Composition, &input.Manifest)
+	if err != nil {
+		return err
+	}
+
+	artifacts := make(map[string]string)
+	for _, id := range input.DependsOn {
+		tsk, err := e.store.Get(id)
+		if err == nil {
+			// decode the input of the task into its concrete type.
+			var data []byte
+			if data, err = json.Marshal(tsk); err == nil {
+				tsk, err = UnmarshalTask(data)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get prerequisite task %s: %w", id, err)
+		}
+		bin, ok := tsk.Input.(*BuildInput)
+		if !ok {
+			continue
+		}
+		paths, ok := tsk.Result.([]interface{})
+		if !ok {
+			continue
+		}
+		bkeys, err := buildKeys(bin.Composition, &bin.Manifest)
+		if err != nil {
+			return fmt.Errorf("failed to prepare composition of prerequisite task %s: %w", id, err)
+		}
+		for i, g := range bin.Composition.Groups {
+			if i >= len(paths) {
+				break
+			}
+			if path, ok := paths[i].(string); ok && path != "" {
+				artifacts[bkeys[g.ID]] = path
+			}
+		}
+	}
+
+	build := make(map[int]bool, len(input.BuildGroups))
+	for _, idx := range input.BuildGroups {
+		build[idx] = true
+	}
+
+	var remaining []int
+	for idx, g := range input.Composition.Groups {
+		if !build[idx] && g.Run.Artifact != "" {
+			continue
+		}
+		path, ok := artifacts[keys[g.ID]]
+		if !ok {
+			if build[idx] {
+				remaining = append(remaining, idx)
+			}
+			continue
+		}
+		ow.Infow("reusing artifact of prerequisite build", "group", g.ID, "artifact", path)
+		g.Run.Artifact = path
+	}
+	input.BuildGroups = remaining
+	return nil
+}
+
+// buildKeys returns the build key of every group of the composition, keyed by
+// group ID, once prepared for build. The composition is not modified.
+func buildKeys(c api.Composition, manifest *api.TestPlanManifest) (map[string]string, error) {
+	copyConfig := func(m map[string]interface{}) map[string]interface{} {
+		if m == nil {
+			return nil
+		}
+		ret := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			ret[k] = v
+		}
+		return ret
+	}
+
+	c.Global.BuildConfig = copyConfig(c.Global.BuildConfig)
+	groups := make(api.Groups, 0, len(c.Groups))
+	for _, g := range c.Groups {
+		grp := *g
+		grp.BuildConfig = copyConfig(g.BuildConfig)
+		groups = append(groups, &grp)
+	}
+	c.Groups = groups
+
+	prepared, err := c.PrepareForBuild(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string, len(prepared.Groups))
+	for _, g := range prepared.Groups {
+		keys[g.ID] = g.BuildKey()
+	}
+	return keys, nil
+}
+
+// timeoutOutput returns the output of a run that timed out, recording the
+// timeout as the outcome of the result reported by the runner, if any.
+func timeoutOutput(id string, comp api.Composition, out *api.RunOutput) *api.RunOutput {
+	if out == nil {
+		out = &api.RunOutput{RunID: id, Composition: comp}
+	}
+	result, ok := out.Result.(*runner.Result)
+	if !ok || result == nil {
+		result = &runner.Result{Outcomes: make(map[string]*runner.GroupOutcome)}
+		out.Result = result
+	}
+	result.Outcome = task.OutcomeTimeout
+	return out
+}
+
+// doRunStages runs the stages of a pipeline composition one after the other,
+// against the artifacts built by doRun. Each stage runs under its own run ID,
+// derived from the task ID. When a stage fails, subsequent stages are skipped,
+// unless the stage's on_failure policy is "continue". A stage exceeding its
+// timeout is stopped, and handled as a failed stage.
+//
+// The outcome of each stage is reported in the Stages of the returned result.
+// Stage failures do not result in an error; the pipeline outcome is a failure
+// instead.
+func (e *Engine) doRunStages(ctx context.Context, id string, input *RunInput, ow *rpc.OutputWriter) (*api.RunOutput, error) {
+	var (
+		stages = input.Composition.Stages
+		result = &runner.Result{
+			Outcome:  task.OutcomeSuccess,
+			Outcomes: make(map[string]*runner.GroupOutcome),
+			Stages:   make([]*runner.StageResult, 0, len(stages)),
+		}
+		aborted bool
+	)
+
+	for i, stage := range stages {
+		sres := &runner.StageResult{
+			Case:    stage.Case,
+			RunID:   StageRunID(id, i),
+			Outcome: runner.OutcomeSkipped,
+		}
+		result.Stages = append(result.Stages, sres)
+
+		if aborted {
+			continue
+		}
+
+		comp, err := input.Composition.ForStage(i)
+		if err != nil {
+			return nil, err
+		}
+
+		ow.Infow("starting stage", "stage", i+1, "stages", len(stages), "case", stage.Case, "run_id", sres.RunID)
+
+		sctx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout := stage.TimeoutDuration(); timeout > 0 {
+			sctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		out, err := e.runComposition(sctx, sres.RunID, *comp, &input.Manifest, ow)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			// the task was canceled or timed out; stop here.
+			sres.Outcome = task.OutcomeCanceled
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				sres.Outcome = task.OutcomeTimeout
+			}
+			result.Outcome = sres.Outcome
+			return &api.RunOutput{RunID: id, Composition: input.Composition, Result: result}, ctx.Err()
+		case timedOut(sctx, ctx):
+			sres.Outcome = task.OutcomeTimeout
+			sres.Error = fmt.Sprintf("stage timed out after %s", stage.TimeoutDuration())
+			if out != nil {
+				if r, ok := out.Result.(*runner.Result); ok {
+					sres.Outcomes = r.Outcomes
+				}
+			}
+		case err != nil:
+			sres.Outcome = task.OutcomeFailure
+			sres.Error = err.Error()
+		default:
+			// runners that do not report results are assumed to succeed.
+			sres.Outcome = task.OutcomeSuccess
+			if r, ok := out.Result.(*runner.Result); ok {
+				sres.Outcome = r.Outcome
+				sres.Outcomes = r.Outcomes
+			}
+		}
+
+		if sres.Outcome == task.OutcomeSuccess {
+			continue
+		}
+
+		result.Outcome = task.OutcomeFailure
+		if !stage.ContinueOnFailure() {
+			ow.Warnw("stage failed; skipping remaining stages", "stage", i+1, "case", stage.Case, "outcome", sres.Outcome)
+			aborted = true
+		} else {
+			ow.Warnw("stage failed; continuing", "stage", i+1, "case", stage.Case, "outcome", sres.Outcome)
+		}
+	}
+
+	return &api.RunOutput{RunID: id, Composition: input.Composition, Result: result}, nil
+}
+
+// StageRunID returns the run ID of the stage at index i of the pipeline run
+// with the given task ID.
+func StageRunID(id string, i int) string {
+	return fmt.Sprintf("%s-%d", id, i)
+}
+
+// runComposition prepares the composition against the manifest and runs it
+// under the given run ID.
+func (e *Engine) runComposition(ctx context.Context, id string, c api.Composition, manifest *api.TestPlanManifest, ow *rpc.OutputWriter) (*api.RunOutput, error) {
+	comp, err := c.PrepareForRun(manifest)
 	if err != nil {
 		return nil, err
 	}
@@ -540,9 +964,9 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 		ow.Info("performing healthcheck on runner")
 
 		if rep, err := hc.Healthcheck(ctx, e, ow, true); err != nil {
-			return nil, fmt.Errorf("healthcheck and fix errored: %w", err)
+			return nil, &HealthcheckError{Component: trunner, Err: fmt.Errorf("healthcheck and fix errored: %w", err)}
 		} else if !rep.FixesSucceeded() {
-			return nil, fmt.Errorf("healthcheck fixes failed; aborting:\n%s", rep)
+			return nil, &HealthcheckError{Component: trunner, Err: fmt.Errorf("healthcheck fixes failed; aborting:\n%s", rep)}
 		} else if !rep.ChecksSucceeded() {
 			ow.Warnf(aurora.Bold(aurora.Yellow("some healthchecks failed, but continuing")).String())
 		} else {
@@ -568,7 +992,8 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 		return nil, runner.ErrRunnerDisabled
 	}
 
-	// 1. Get overrides from the composition.
+	// 1. Get overrides from the composition. Group overrides are applied on
+	// top of these for each group below.
 	cfg = cfg.Append(comp.Global.RunConfig)
 
 	// Coalesce all configurations and deserialize into the config type
@@ -591,13 +1016,21 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 
 	// Trigger a build for each group, and wait until all of them are done.
 	for _, grp := range comp.Groups {
+		// Coalesce the group overrides on top of the run configuration.
+		gobj, err := cfg.Append(grp.RunConfig).CoalesceIntoType(run.ConfigType())
+		if err != nil {
+			return nil, fmt.Errorf("error while coalescing configuration values for group %s: %w", grp.ID, err)
+		}
+
 		g := &api.RunGroup{
-			ID:           grp.ID,
-			Instances:    int(grp.CalculatedInstanceCount()),
-			ArtifactPath: grp.Run.Artifact,
-			Parameters:   grp.Run.TestParams,
-			Resources:    grp.Resources,
-			Profiles:     grp.Run.Profiles,
+			ID:                grp.ID,
+			Instances:         int(grp.CalculatedInstanceCount()),
+			ArtifactPath:      grp.Run.Artifact,
+			Parameters:        grp.Run.TestParams,
+			InstanceOverrides: grp.InstanceOverrides,
+			Resources:         grp.Resources,
+			Profiles:          grp.Run.Profiles,
+			RunnerConfig:      gobj,
 		}
 
 		in.Groups = append(in.Groups, g)
@@ -620,7 +1053,7 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 	}
 
 	if out != nil { // TODO: Make sure all runners return a value, and get rid of nil check
-		out.Composition = input.Composition
+		out.Composition = c
 	}
 
 	return out, err
@@ -0,0 +1,325 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+// fakeRunner records the runs it is asked to perform, and reports the
+// configured outcome for each test case. Test cases without an outcome run
+// until the context is done.
+type fakeRunner struct {
+	outcomes map[string]task.Outcome
+	runs     []*api.RunInput
+}
+
+var _ api.Runner = (*fakeRunner)(nil)
+
+func (r *fakeRunner) ID() string {
+	return "fake"
+}
+
+func (r *fakeRunner) Run(ctx context.Context, in *api.RunInput, _ *rpc.OutputWriter) (*api.RunOutput, error) {
+	r.runs = append(r.runs, in)
+	outcome, ok := r.outcomes[in.TestCase]
+	if !ok {
+		<-ctx.Done()
+		return &api.RunOutput{RunID: in.RunID, Result: &runner.Result{Outcome: task.OutcomeFailure}}, ctx.Err()
+	}
+	return &api.RunOutput{RunID: in.RunID, Result: &runner.Result{Outcome: outcome}}, nil
+}
+
+func (r *fakeRunner) ConfigType() reflect.Type {
+	return reflect.TypeOf(struct{}{})
+}
+
+func (r *fakeRunner) CompatibleBuilders() []string {
+	return []string{"docker:go"}
+}
+
+func (r *fakeRunner) CollectOutputs(context.Context, *api.CollectionInput, *rpc.OutputWriter) error {
+	return nil
+}
+
+// blockingBuilder builds until the context is done.
+type blockingBuilder struct{}
+
+var _ api.Builder = (*blockingBuilder)(nil)
+
+func (b *blockingBuilder) ID() string {
+	return "docker:go"
+}
+
+func (b *blockingBuilder) Build(ctx context.Context, _ *api.BuildInput, _ *rpc.OutputWriter) (*api.BuildOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *blockingBuilder) Purge(context.Context, string, *rpc.OutputWriter) error {
+	return nil
+}
+
+func (b *blockingBuilder) ConfigType() reflect.Type {
+	return reflect.TypeOf(struct{}{})
+}
+
+func stagesRunInput(onFailure string) *RunInput {
+	var (
+		instances = api.InstanceConstraints{Minimum: 1, Maximum: 1}
+		params    = map[string]api.Parameter{"param": {Type: "string"}}
+	)
+
+	return &RunInput{
+		RunRequest: &api.RunRequest{
+			Composition: api.Composition{
+				Global: api.Global{
+					Plan:           "plan",
+					Builder:        "docker:go",
+					Runner:         "fake",
+					TotalInstances: 1,
+					Run: &api.Run{
+						TestParams: map[string]string{"param": "global"},
+					},
+				},
+				Groups: api.Groups{
+					{ID: "single", Instances: api.Instances{Count: 1}},
+				},
+				Stages: []api.Stage{
+					{Case: "setup"},
+					{Case: "soak", OnFailure: onFailure, TestParams: map[string]string{"param": "soak"}},
+					{Case: "teardown"},
+				},
+			},
+			Manifest: api.TestPlanManifest{
+				Name:    "plan",
+				Runners: map[string]config.ConfigMap{"fake": {}},
+				TestCases: []*api.TestCase{
+					{Name: "setup", Instances: instances, Parameters: params},
+					{Name: "soak", Instances: instances, Parameters: params},
+					{Name: "teardown", Instances: instances, Parameters: params},
+				},
+			},
+		},
+	}
+}
+
+func TestDoRunStages(t *testing.T) {
+	cases := []struct {
+		onFailure string
+		runs      int
+		stages    []task.Outcome
+	}{
+		{"", 2, []task.Outcome{task.OutcomeSuccess, task.OutcomeFailure, runner.OutcomeSkipped}},
+		{api.OnFailureContinue, 3, []task.Outcome{task.OutcomeSuccess, task.OutcomeFailure, task.OutcomeSuccess}},
+	}
+
+	for _, c := range cases {
+		r := &fakeRunner{outcomes: map[string]task.Outcome{
+			"setup":    task.OutcomeSuccess,
+			"soak":     task.OutcomeFailure,
+			"teardown": task.OutcomeSuccess,
+		}}
+		e := &Engine{
+			runners: map[string]api.Runner{"fake": r},
+			envcfg:  &config.EnvConfig{},
+		}
+
+		input := stagesRunInput(c.onFailure)
+		require.NoError(t, input.Composition.ValidateForRun())
+
+		out, err := e.doRun(context.Background(), "task", input, rpc.NewFileOutputWriter(ioutil.Discard))
+		require.NoError(t, err)
+
+		res := out.Result.(*runner.Result)
+		require.Equal(t, task.OutcomeFailure, res.Outcome)
+		require.Len(t, res.Stages, 3)
+		for i, o := range c.stages {
+			require.Equal(t, o, res.Stages[i].Outcome, "stage %d", i)
+			require.Equal(t, StageRunID("task", i), res.Stages[i].RunID)
+		}
+
+		// each stage runs its own test case, under its own run ID.
+		require.Len(t, r.runs, c.runs)
+		require.Equal(t, "setup", r.runs[0].TestCase)
+		require.Equal(t, "task-0", r.runs[0].RunID)
+		require.Equal(t, "global", r.runs[0].Groups[0].Parameters["param"])
+		require.Equal(t, "soak", r.runs[1].TestCase)
+		require.Equal(t, "soak", r.runs[1].Groups[0].Parameters["param"])
+	}
+}
+
+func TestDoRunTimeout(t *testing.T) {
+	r := &fakeRunner{outcomes: map[string]task.Outcome{}}
+	e := &Engine{
+		runners: map[string]api.Runner{"fake": r},
+		envcfg:  &config.EnvConfig{},
+	}
+
+	input := stagesRunInput("")
+	input.Composition.Stages = nil
+	input.Composition.Global.Case = "soak"
+	input.Composition.Global.Timeout = "50ms"
+	require.NoError(t, input.Composition.ValidateForRun())
+
+	out, err := e.doRun(context.Background(), "task", input, rpc.NewFileOutputWriter(ioutil.Discard))
+	require.NoError(t, err)
+	require.Equal(t, task.OutcomeTimeout, out.Result.(*runner.Result).Outcome)
+}
+
+func TestDoRunStagesTimeout(t *testing.T) {
+	r := &fakeRunner{outcomes: map[string]task.Outcome{
+		"setup":    task.OutcomeSuccess,
+		"teardown": task.OutcomeSuccess,
+	}}
+	e := &Engine{
+		runners: map[string]api.Runner{"fake": r},
+		envcfg:  &config.EnvConfig{},
+	}
+
+	input := stagesRunInput("")
+	input.Composition.Stages[1].Timeout = "50ms"
+	require.NoError(t, input.Composition.ValidateForRun())
+
+	out, err := e.doRun(context.Background(), "task", input, rpc.NewFileOutputWriter(ioutil.Discard))
+	require.NoError(t, err)
+
+	// a stage timing out is a stage failure; the pipeline itself didn't time
+	// out.
+	res := out.Result.(*runner.Result)
+	require.Equal(t, task.OutcomeFailure, res.Outcome)
+	require.Equal(t, task.OutcomeTimeout, res.Stages[1].Outcome)
+	require.Equal(t, "stage timed out after 50ms", res.Stages[1].Error)
+	require.Equal(t, runner.OutcomeSkipped, res.Stages[2].Outcome)
+}
+
+func TestBuildTimeout(t *testing.T) {
+	e := &Engine{
+		builders: map[string]api.Builder{"docker:go": &blockingBuilder{}},
+		runners:  map[string]api.Runner{"fake": &fakeRunner{}},
+		envcfg:   &config.EnvConfig{},
+	}
+	ow := rpc.NewFileOutputWriter(ioutil.Discard)
+
+	input := stagesRunInput("")
+	input.Composition.Stages = nil
+	input.Composition.Global.Case = "soak"
+	input.Composition.Global.BuildTimeout = "50ms"
+	input.Manifest = api.TestPlanManifest{
+		Name:     "plan",
+		Builders: map[string]config.ConfigMap{"docker:go": {}},
+		Runners:  map[string]config.ConfigMap{"fake": {}},
+	}
+	input.Sources = &api.UnpackedSources{}
+
+	// a build task exceeding its timeout completes with a timeout outcome.
+	_, err := e.doBuild(context.Background(), &BuildInput{
+		BuildRequest: &api.BuildRequest{Composition: input.Composition, Manifest: input.Manifest},
+		Sources:      input.Sources,
+	}, ow)
+	var terr *TimeoutError
+	require.True(t, errors.As(err, &terr), err)
+
+	state, result := taskErrorState(&TaskExecutionError{TaskType: string(task.TypeBuild), WrappedErr: err}, nil)
+	tsk := &task.Task{
+		Type:   task.TypeBuild,
+		States: []task.DatedState{{State: state}},
+		Result: result,
+	}
+	outcome, err := data.DecodeTaskOutcome(tsk)
+	require.NoError(t, err)
+	require.Equal(t, task.OutcomeTimeout, outcome)
+
+	// so does a run whose build phase exceeds the build timeout.
+	input.BuildGroups = []int{0}
+	out, err := e.doRun(context.Background(), "task", input, ow)
+	require.NoError(t, err)
+	require.Equal(t, task.OutcomeTimeout, out.Result.(*runner.Result).Outcome)
+
+	// builds failing otherwise are still canceled.
+	state, _ = taskErrorState(&TaskExecutionError{TaskType: string(task.TypeBuild), WrappedErr: errors.New("failed")}, nil)
+	require.Equal(t, task.StateCanceled, state)
+}
+
+func TestTaskTimeout(t *testing.T) {
+	const def = 10 * time.Minute
+
+	e := &Engine{}
+	runTask := func(timeout, buildTimeout string, build bool) *task.Task {
+		in := &RunInput{RunRequest: &api.RunRequest{}}
+		in.Composition.Global.Timeout = timeout
+		in.Composition.Global.BuildTimeout = buildTimeout
+		if build {
+			in.BuildGroups = []int{0}
+		}
+		return &task.Task{Type: task.TypeRun, Input: in}
+	}
+
+	require.Equal(t, def, e.taskTimeout(runTask("", "", true), def))
+	require.Equal(t, 2*time.Hour+def+taskTimeoutGrace, e.taskTimeout(runTask("2h", "", true), def))
+	require.Equal(t, 2*time.Hour+taskTimeoutGrace, e.taskTimeout(runTask("2h", "", false), def))
+	require.Equal(t, 30*time.Second+time.Minute+taskTimeoutGrace, e.taskTimeout(runTask("30s", "1m", true), def))
+
+	build := &task.Task{Type: task.TypeBuild, Input: &BuildInput{BuildRequest: &api.BuildRequest{}}}
+	build.Input.(*BuildInput).Composition.Global.BuildTimeout = "15m"
+	require.Equal(t, 15*time.Minute+taskTimeoutGrace, e.taskTimeout(build, def))
+}
+
+func TestReuseArtifactsOfPrerequisiteBuild(t *testing.T) {
+	store, err := task.NewMemoryTaskStorage()
+	require.NoError(t, err)
+
+	manifest := api.TestPlanManifest{
+		Name:     "plan",
+		Builders: map[string]config.ConfigMap{"docker:go": {}},
+		Runners:  map[string]config.ConfigMap{"fake": {}},
+	}
+	build := &task.Task{
+		ID:   "ab4brhjpc98qra498sg0",
+		Type: task.TypeBuild,
+		Input: &BuildInput{BuildRequest: &api.BuildRequest{
+			Composition: api.Composition{
+				Global: api.Global{Plan: "plan", Builder: "docker:go"},
+				Groups: api.Groups{{ID: "single", Builder: "docker:go"}},
+			},
+			Manifest: manifest,
+		}},
+		Result: []string{"artifact"},
+		States: []task.DatedState{{State: task.StateComplete, Created: time.Now()}},
+	}
+	require.NoError(t, store.PersistScheduled(build))
+
+	e := &Engine{store: store, envcfg: &config.EnvConfig{}}
+	input := &RunInput{RunRequest: &api.RunRequest{
+		BuildGroups: []int{0, 1},
+		Composition: api.Composition{
+			Global: api.Global{Plan: "plan", Case: "case", Builder: "docker:go", Runner: "fake"},
+			Groups: api.Groups{
+				{ID: "a", Instances: api.Instances{Count: 1}},
+				{ID: "b", Instances: api.Instances{Count: 1}, Build: api.Build{Selectors: []string{"foo"}}},
+			},
+		},
+		Manifest:  manifest,
+		DependsOn: []string{build.ID},
+	}}
+
+	require.NoError(t, e.reuseArtifacts(input, rpc.NewFileOutputWriter(ioutil.Discard)))
+
+	// group a builds like the prerequisite; group b uses other selectors.
+	require.Equal(t, "artifact", input.Composition.Groups[0].Run.Artifact)
+	require.Empty(t, input.Composition.Groups[1].Run.Artifact)
+	require.Equal(t, []int{1}, input.BuildGroups)
+	require.Empty(t, input.Composition.Groups[0].BuildConfig)
+}
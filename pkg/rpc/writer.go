@@ -220,13 +220,15 @@ func (ow *OutputWriter) WriteBinary(b []byte) (n int, err error) {
 	ow.Lock()
 	defer ow.Unlock()
 
-	n, err = ow.out.Write(json)
+	_, err = ow.out.Write(json)
 	if err != nil {
 		logging.S().Errorw("could not write binary", "err", err)
 		return 0, err
 	}
 
-	return n, err
+	// report the bytes of b written, rather than those of the message, as
+	// io.Writer requires.
+	return len(b), nil
 }
 
 func (ow *OutputWriter) WriteResult(res interface{}) {
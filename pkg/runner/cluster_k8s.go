@@ -48,11 +48,11 @@ import (
 )
 
 var (
-	_             api.Runner        = (*ClusterK8sRunner)(nil)
-	_             api.Terminatable  = (*ClusterK8sRunner)(nil)
-	_             api.Healthchecker = (*ClusterK8sRunner)(nil)
-	mu                              = sync.Mutex{}
-	errSyncClient                   = errors.New("failed to start sync client")
+	_  api.Runner           = (*ClusterK8sRunner)(nil)
+	_  api.Terminatable     = (*ClusterK8sRunner)(nil)
+	_  api.Healthchecker    = (*ClusterK8sRunner)(nil)
+	_  api.CapacityReporter = (*ClusterK8sRunner)(nil)
+	mu                      = sync.Mutex{}
 )
 
 const (
@@ -288,6 +288,10 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 	sem := make(chan struct{}, 30) // limit the number of concurrent k8s api calls
 
 	for _, g := range input.Groups {
+		// Log level, exposed ports, sysctls and pod retention can be
+		// overridden per group.
+		gcfg := cfg.forGroup(g)
+
 		runenv := template
 		runenv.TestGroupID = g.ID
 		runenv.TestGroupInstanceCount = g.Instances
@@ -304,15 +308,15 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		env = append(env, v1.EnvVar{Name: "INFLUXDB_URL", Value: "http://influxdb:8086"})
 
 		// Set the log level if provided in cfg.
-		if cfg.LogLevel != "" {
-			env = append(env, v1.EnvVar{Name: "LOG_LEVEL", Value: cfg.LogLevel})
+		if gcfg.LogLevel != "" {
+			env = append(env, v1.EnvVar{Name: "LOG_LEVEL", Value: gcfg.LogLevel})
 		}
 
 		env = append(env, v1.EnvVar{Name: "POD_IP", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "status.podIP"}}})
 		env = append(env, v1.EnvVar{Name: "HOST_IP", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "status.hostIP"}}})
 
 		// Inject exposed ports.
-		for name, value := range cfg.ExposedPorts.ToEnvVars() {
+		for name, value := range gcfg.ExposedPorts.ToEnvVars() {
 			env = append(env, v1.EnvVar{Name: name, Value: value})
 		}
 
@@ -344,7 +348,7 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 			podName := fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i)
 
 			defer func() {
-				if cfg.KeepService {
+				if gcfg.KeepService {
 					return
 				}
 				client := c.pool.Acquire()
@@ -367,6 +371,19 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 					Value: fmt.Sprintf("/outputs/%s/%s/%d", input.RunID, g.ID, i),
 				})
 
+				// Apply the instance overrides, if any.
+				if len(g.InstanceOverrides) > 0 {
+					runenv := runenv
+					runenv.TestInstanceRole, runenv.TestInstanceParams = g.ForInstance(i)
+					vars := runenv.ToEnvVars()
+					for j, e := range currentEnv {
+						switch e.Name {
+						case runtime.EnvTestInstanceRole, runtime.EnvTestInstanceParams:
+							currentEnv[j].Value = vars[e.Name]
+						}
+					}
+				}
+
 				return c.createTestplanPod(ctx, podName, input, runenv, currentEnv, g, i, podMemory, podCPU)
 			})
 		}
@@ -424,13 +441,23 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 	return
 }
 
+// forGroup returns the configuration that applies to the given group. If the
+// group carries no configuration of its own, the run configuration is
+// returned.
+func (cfg ClusterK8sRunnerConfig) forGroup(g *api.RunGroup) ClusterK8sRunnerConfig {
+	if gcfg, ok := g.RunnerConfig.(*ClusterK8sRunnerConfig); ok && gcfg != nil {
+		return *gcfg
+	}
+	return cfg
+}
+
 func (*ClusterK8sRunner) ID() string {
 	return "cluster:k8s"
 }
 
 func (c *ClusterK8sRunner) Healthcheck(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter, fix bool) (*api.HealthcheckReport, error) {
 	// Ignore sync client error as we may start the redis pod below.
-	if err := c.initPool(); err != nil && !errors.Is(err, errSyncClient) {
+	if err := c.initPool(); err != nil && !errors.Is(err, ErrSyncClient) {
 		return nil, err
 	}
 
@@ -516,7 +543,7 @@ func (c *ClusterK8sRunner) initPool() error {
 
 	c.syncClient, err = ss.NewGenericClient(context.Background(), logging.S())
 	if err != nil {
-		return fmt.Errorf("%w: %s", errSyncClient, err)
+		return fmt.Errorf("%w: %s", ErrSyncClient, err)
 	}
 
 	c.initialized = true
@@ -820,7 +847,7 @@ func (c *ClusterK8sRunner) createTestplanPod(ctx context.Context, podName string
 	client := c.pool.Acquire()
 	defer c.pool.Release(client)
 
-	cfg := *input.RunnerConfig.(*ClusterK8sRunnerConfig)
+	cfg := input.RunnerConfig.(*ClusterK8sRunnerConfig).forGroup(g)
 
 	var sysctls []v1.Sysctl
 	for _, v := range cfg.Sysctls {
@@ -1164,6 +1191,62 @@ func (c *ClusterK8sRunner) createCollectOutputsPod(ctx context.Context, input *a
 	return err
 }
 
+// Capacity returns the resources of the plan nodes available to test
+// instances, i.e. their allocatable resources minus those taken by sidecars,
+// within the utilisation ratio. Instances are allotted the default test plan
+// pod resources.
+func (c *ClusterK8sRunner) Capacity(ctx context.Context, runnerConfig interface{}) (api.Capacity, api.Capacity, error) {
+	var total, instance api.Capacity
+
+	cfg, ok := runnerConfig.(*ClusterK8sRunnerConfig)
+	if !ok {
+		return total, instance, fmt.Errorf("unexpected runner config type: %T", runnerConfig)
+	}
+
+	if cfg.TestplanPodCPU != "" {
+		cpu, err := resource.ParseQuantity(cfg.TestplanPodCPU)
+		if err != nil {
+			return total, instance, fmt.Errorf("couldn't parse default test plan pod CPU request: %w", err)
+		}
+		instance.CPUs = float64(cpu.MilliValue()) / 1000
+	}
+	if cfg.TestplanPodMemory != "" {
+		mem, err := resource.ParseQuantity(cfg.TestplanPodMemory)
+		if err != nil {
+			return total, instance, fmt.Errorf("couldn't parse default test plan pod Memory request: %w", err)
+		}
+		instance.Memory = mem.Value()
+	}
+
+	if err := c.initPool(); err != nil {
+		return total, instance, fmt.Errorf("could not init pool: %w", err)
+	}
+
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
+
+	res, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: "testground.node.role.plan=true",
+	})
+	if err != nil {
+		return total, instance, err
+	}
+
+	var cpus float64
+	for _, it := range res.Items {
+		cpu := it.Status.Allocatable["cpu"]
+		cpus += float64(cpu.MilliValue()) / 1000
+
+		mem := it.Status.Allocatable["memory"]
+		total.Memory += mem.Value()
+	}
+	if cpus -= float64(len(res.Items)) * sidecarCPUs; cpus > 0 {
+		total.CPUs = cpus * utilisation
+	}
+
+	return total, instance, nil
+}
+
 func (c *ClusterK8sRunner) GetClusterCapacity() (int64, int64, error) {
 	if err := c.initPool(); err != nil {
 		return -1, -1, fmt.Errorf("could not init pool: %w", err)
@@ -76,6 +76,14 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		cfg = *input.RunnerConfig.(*ClusterSwarmRunnerConfig)
 	)
 
+	// Instances of a group run as replicas of a single service, so they can't
+	// be configured individually.
+	for _, g := range input.Groups {
+		if len(g.InstanceOverrides) > 0 {
+			return nil, fmt.Errorf("cluster:swarm runner does not support instance overrides; found some in group %s", g.ID)
+		}
+	}
+
 	// global timeout of 1 minute for the scheduling.
 	ctx, cancelFn := context.WithTimeout(ctx, 1*time.Minute)
 	defer cancelFn()
@@ -25,6 +25,10 @@ var (
 
 var ErrRunnerDisabled = fmt.Errorf("runner is disabled by config")
 
+// ErrSyncClient is returned when a runner fails to connect to the sync
+// service.
+var ErrSyncClient = errors.New("failed to start sync client")
+
 func nextDataNetwork(lenNetworks int) (*net.IPNet, string, error) {
 	if lenNetworks > 4095 {
 		return nil, "", errors.New("space exhausted")
@@ -5,10 +5,39 @@ import (
 	"github.com/testground/testground/pkg/task"
 )
 
+// OutcomeSkipped is the outcome of a stage that didn't run because an
+// earlier stage failed.
+const OutcomeSkipped task.Outcome = "skipped"
+
 type Result struct {
 	Outcome  task.Outcome             `json:"outcome"`
 	Outcomes map[string]*GroupOutcome `json:"outcomes"`
 	Journal  *Journal                 `json:"journal"`
+
+	// Stages holds the result of each stage, for compositions executed as a
+	// pipeline of stages.
+	Stages []*StageResult `json:"stages,omitempty"`
+
+	// DependencyMatrix holds the outcome of each combination of dependency
+	// versions, for compositions expanded from a dependency matrix.
+	DependencyMatrix []*DependencyMatrixResult `json:"dependency_matrix,omitempty" mapstructure:"dependency_matrix"`
+}
+
+// DependencyMatrixResult is the outcome of the group variants built against
+// a combination of dependency versions.
+type DependencyMatrixResult struct {
+	Versions map[string]string `json:"versions"`
+	Groups   []string          `json:"groups"`
+	Outcome  task.Outcome      `json:"outcome"`
+}
+
+// StageResult is the result of a stage of a pipeline.
+type StageResult struct {
+	Case     string                   `json:"case"`
+	RunID    string                   `json:"run_id" mapstructure:"run_id"`
+	Outcome  task.Outcome             `json:"outcome"`
+	Outcomes map[string]*GroupOutcome `json:"outcomes,omitempty"`
+	Error    string                   `json:"error,omitempty"`
 }
 
 func newResult(input *api.RunInput) *Result {
@@ -57,3 +86,43 @@ func (r *Result) updateOutcome() {
 	}
 	r.Outcome = task.OutcomeSuccess
 }
+
+// AddDependencyMatrix records the outcome of each dependency variant in the
+// result. A variant succeeds if all instances of its groups succeeded, in
+// every stage that ran for pipelines. Variants that didn't succeed take the
+// outcome of the run if it was aborted (e.g. canceled or timed out), and fail
+// otherwise.
+func (r *Result) AddDependencyMatrix(variants []api.DependencyVariant) {
+	sets := []map[string]*GroupOutcome{r.Outcomes}
+	if len(r.Stages) > 0 {
+		sets = sets[:0]
+		for _, s := range r.Stages {
+			if s.Outcome != OutcomeSkipped {
+				sets = append(sets, s.Outcomes)
+			}
+		}
+	}
+
+	r.DependencyMatrix = make([]*DependencyMatrixResult, 0, len(variants))
+	for _, v := range variants {
+		outcome := task.OutcomeSuccess
+		if len(sets) == 0 {
+			outcome = r.Outcome
+		}
+		for _, set := range sets {
+			for _, id := range v.Groups {
+				if g, ok := set[id]; !ok || g.Ok != g.Total {
+					outcome = task.OutcomeFailure
+				}
+			}
+		}
+		if outcome != task.OutcomeSuccess && r.Outcome != task.OutcomeSuccess && r.Outcome != task.OutcomeFailure {
+			outcome = r.Outcome
+		}
+		r.DependencyMatrix = append(r.DependencyMatrix, &DependencyMatrixResult{
+			Versions: v.Versions,
+			Groups:   v.Groups,
+			Outcome:  outcome,
+		})
+	}
+}
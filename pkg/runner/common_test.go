@@ -2,6 +2,11 @@ package runner
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
 )
 
 func TestNextDataNetwork(t *testing.T) {
@@ -33,3 +38,44 @@ func TestNextDataNetwork(t *testing.T) {
 		}
 	}
 }
+
+func TestAddDependencyMatrix(t *testing.T) {
+	variants := []api.DependencyVariant{
+		{Versions: map[string]string{"mod": "v1"}, Groups: []string{"a-1", "b-1"}},
+		{Versions: map[string]string{"mod": "v2"}, Groups: []string{"a-2", "b-2"}},
+	}
+
+	r := &Result{
+		Outcome: task.OutcomeFailure,
+		Outcomes: map[string]*GroupOutcome{
+			"a-1": {Ok: 1, Total: 1},
+			"b-1": {Ok: 2, Total: 2},
+			"a-2": {Ok: 1, Total: 1},
+			"b-2": {Ok: 1, Total: 2},
+		},
+	}
+	r.AddDependencyMatrix(variants)
+	require.Len(t, r.DependencyMatrix, 2)
+	require.Equal(t, task.OutcomeSuccess, r.DependencyMatrix[0].Outcome)
+	require.Equal(t, task.OutcomeFailure, r.DependencyMatrix[1].Outcome)
+	require.Equal(t, variants[1].Versions, r.DependencyMatrix[1].Versions)
+
+	// pipelines: a variant must succeed in every stage that ran.
+	r = &Result{
+		Outcome: task.OutcomeFailure,
+		Stages: []*StageResult{
+			{Outcome: task.OutcomeSuccess, Outcomes: map[string]*GroupOutcome{"a-1": {Ok: 1, Total: 1}, "b-1": {Ok: 1, Total: 1}, "a-2": {Ok: 1, Total: 1}, "b-2": {Ok: 1, Total: 1}}},
+			{Outcome: task.OutcomeFailure, Outcomes: map[string]*GroupOutcome{"a-1": {Ok: 1, Total: 1}, "b-1": {Ok: 1, Total: 1}, "a-2": {Ok: 0, Total: 1}, "b-2": {Ok: 1, Total: 1}}},
+			{Outcome: OutcomeSkipped},
+		},
+	}
+	r.AddDependencyMatrix(variants)
+	require.Equal(t, task.OutcomeSuccess, r.DependencyMatrix[0].Outcome)
+	require.Equal(t, task.OutcomeFailure, r.DependencyMatrix[1].Outcome)
+
+	// runs that timed out report the timeout for incomplete variants.
+	r = &Result{Outcome: task.OutcomeTimeout, Outcomes: map[string]*GroupOutcome{"a-1": {Ok: 1, Total: 1}, "b-1": {Ok: 1, Total: 1}}}
+	r.AddDependencyMatrix(variants)
+	require.Equal(t, task.OutcomeSuccess, r.DependencyMatrix[0].Outcome)
+	require.Equal(t, task.OutcomeTimeout, r.DependencyMatrix[1].Outcome)
+}
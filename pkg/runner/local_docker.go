@@ -82,6 +82,7 @@ type testContainerInstance struct {
 	containerID string
 	groupID     string
 	groupIdx    int
+	keep        bool
 }
 
 // defaultConfig is the default configuration. Incoming configurations will be
@@ -94,6 +95,20 @@ var defaultConfig = LocalDockerRunnerConfig{
 	OutcomesCollectionTimeout: time.Second * 45,
 }
 
+// forGroup returns the configuration that applies to the given group. If the
+// group carries no configuration of its own, the run configuration is
+// returned.
+func (cfg LocalDockerRunnerConfig) forGroup(g *api.RunGroup) (LocalDockerRunnerConfig, error) {
+	if g.RunnerConfig == nil {
+		return cfg, nil
+	}
+	gcfg := defaultConfig
+	if err := mergo.Merge(&gcfg, g.RunnerConfig, mergo.WithOverride); err != nil {
+		return cfg, fmt.Errorf("error while merging configuration of group %s: %w", g.ID, err)
+	}
+	return gcfg, nil
+}
+
 // LocalDockerRunner is a runner that manually stands up as many docker
 // containers as instances the run job indicates.
 //
@@ -347,27 +362,19 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		return
 	}
 
-	// Prepare the ports mapping.
-	ports := make(nat.PortSet)
-	for _, p := range cfg.ExposedPorts {
-		ports[nat.Port(p)] = struct{}{}
-	}
-
 	// Prepare environment variables.
 	sharedEnv := make([]string, 0, 3)
 	sharedEnv = append(sharedEnv, "INFLUXDB_URL=http://testground-influxdb:8086")
 	sharedEnv = append(sharedEnv, "REDIS_HOST=testground-redis")
-	// Inject exposed ports.
-	sharedEnv = append(sharedEnv, conv.ToOptionsSlice(cfg.ExposedPorts.ToEnvVars())...)
-	// Set the log level if provided in cfg.
-	if cfg.LogLevel != "" {
-		sharedEnv = append(sharedEnv, "LOG_LEVEL="+cfg.LogLevel)
-	}
 
 	// ## Create the containers
 	var (
 		containers []testContainerInstance
 		tmpdirs    []string
+
+		// keep records whether any group retains its containers; if so, the
+		// data network is retained too.
+		keep bool
 	)
 
 	defer func() {
@@ -380,20 +387,46 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 	for _, g := range input.Groups {
 		reviewResources(g, ow)
 
+		// Log level, ulimits, exposed ports and container retention can be
+		// overridden per group.
+		var gcfg LocalDockerRunnerConfig
+		if gcfg, err = cfg.forGroup(g); err != nil {
+			return
+		}
+		keep = keep || gcfg.KeepContainers
+
+		// Prepare the ports mapping.
+		ports := make(nat.PortSet)
+		for _, p := range gcfg.ExposedPorts {
+			ports[nat.Port(p)] = struct{}{}
+		}
+
 		runenv := template
 		runenv.TestGroupInstanceCount = g.Instances
 		runenv.TestGroupID = g.ID
 		runenv.TestInstanceParams = g.Parameters
 		runenv.TestCaptureProfiles = g.Profiles
 		// Prepare the group's environment variables.
-		env := make([]string, 0, len(sharedEnv)+len(runenv.ToEnvVars()))
-		env = append(env, sharedEnv...)
-		env = append(env, conv.ToOptionsSlice(runenv.ToEnvVars())...)
+		groupEnv := make([]string, 0, len(sharedEnv)+len(gcfg.ExposedPorts)+2)
+		groupEnv = append(groupEnv, sharedEnv...)
+		// Inject exposed ports.
+		groupEnv = append(groupEnv, conv.ToOptionsSlice(gcfg.ExposedPorts.ToEnvVars())...)
+		// Set the log level if provided in cfg.
+		if gcfg.LogLevel != "" {
+			groupEnv = append(groupEnv, "LOG_LEVEL="+gcfg.LogLevel)
+		}
 		logging.S().Infow("additional hosts", "hosts", strings.Join(cfg.AdditionalHosts, ","))
-		env = append(env, fmt.Sprintf("ADDITIONAL_HOSTS=%s", strings.Join(cfg.AdditionalHosts, ",")))
+		groupEnv = append(groupEnv, fmt.Sprintf("ADDITIONAL_HOSTS=%s", strings.Join(cfg.AdditionalHosts, ",")))
 
 		// Start as many containers as group instances.
 		for i := 0; i < g.Instances; i++ {
+			// Apply the instance overrides, if any, and prepare the
+			// instance's environment variables.
+			runenv.TestInstanceRole, runenv.TestInstanceParams = g.ForInstance(i)
+			env := make([]string, 0, len(groupEnv)+len(runenv.ToEnvVars()))
+			env = append(env, groupEnv...)
+			env = append(env, conv.ToOptionsSlice(runenv.ToEnvVars())...)
+
 			// TODO: We should set the instance id in runenv and make this whole operation self contained around a local runenv.
 			tmpdir, err := r.prepareTemporaryDirectory(i, &runenv)
 			if err != nil {
@@ -437,8 +470,8 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 				}},
 			}
 
-			if len(cfg.Ulimits) > 0 {
-				ulimits, err := conv.ToUlimits(cfg.Ulimits)
+			if len(gcfg.Ulimits) > 0 {
+				ulimits, err := conv.ToUlimits(gcfg.Ulimits)
 				if err == nil {
 					hcfg.Resources = container.Resources{Ulimits: ulimits}
 				} else {
@@ -457,6 +490,7 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 				containerID: res.ID,
 				groupID:     g.ID,
 				groupIdx:    i,
+				keep:        gcfg.KeepContainers,
 			}
 			containers = append(containers, container)
 
@@ -468,22 +502,25 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		}
 	}
 
-	if !cfg.KeepContainers {
-		defer func() {
-			ids := make([]string, 0, len(containers))
-			for _, c := range containers {
+	defer func() {
+		ids := make([]string, 0, len(containers))
+		for _, c := range containers {
+			if !c.keep {
 				ids = append(ids, c.containerID)
 			}
-			if err := docker.DeleteContainers(cli, log, ids); err != nil {
-				log.Errorw("failed to delete containers", "err", err)
-			}
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			if err := cli.NetworkRemove(ctx, dataNetworkID); err != nil {
-				log.Errorw("removing network", "network", dataNetworkID, "error", err)
-			}
-		}()
-	}
+		}
+		if err := docker.DeleteContainers(cli, log, ids); err != nil {
+			log.Errorw("failed to delete containers", "err", err)
+		}
+		if keep {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := cli.NetworkRemove(ctx, dataNetworkID); err != nil {
+			log.Errorw("removing network", "network", dataNetworkID, "error", err)
+		}
+	}()
 
 	// If an error occurred interim, abort.
 	if err != nil {
@@ -0,0 +1,42 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/imdario/mergo"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestLocalDockerGroupConfigOverrides(t *testing.T) {
+	var cfg config.CoalescedConfig
+	cfg = cfg.Append(map[string]interface{}{
+		"log_level":       "info",
+		"keep_containers": true,
+		"ulimits":         []interface{}{"nofile=1024:1024"},
+	})
+
+	typ := reflect.TypeOf(LocalDockerRunnerConfig{})
+	robj, err := cfg.CoalesceIntoType(typ)
+	require.NoError(t, err)
+	gobj, err := cfg.Append(map[string]interface{}{"log_level": "debug"}).CoalesceIntoType(typ)
+	require.NoError(t, err)
+
+	rcfg := defaultConfig
+	require.NoError(t, mergo.Merge(&rcfg, robj, mergo.WithOverride))
+
+	// a group with overrides.
+	gcfg, err := rcfg.forGroup(&api.RunGroup{ID: "bootstrapper", RunnerConfig: gobj})
+	require.NoError(t, err)
+	require.Equal(t, "debug", gcfg.LogLevel)
+	require.True(t, gcfg.KeepContainers)
+	require.Equal(t, []string{"nofile=1024:1024"}, gcfg.Ulimits)
+
+	// a group without its own configuration inherits the run configuration.
+	gcfg, err = rcfg.forGroup(&api.RunGroup{ID: "client"})
+	require.NoError(t, err)
+	require.Equal(t, "info", gcfg.LogLevel)
+}
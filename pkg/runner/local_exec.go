@@ -133,7 +133,7 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 			runenv := template
 			runenv.TestGroupID = g.ID
 			runenv.TestGroupInstanceCount = g.Instances
-			runenv.TestInstanceParams = g.Parameters
+			runenv.TestInstanceRole, runenv.TestInstanceParams = g.ForInstance(i)
 			runenv.TestOutputsPath = odir
 			runenv.TestTempPath = tmpdir
 			runenv.TestStartTime = time.Now()
@@ -0,0 +1,316 @@
+package task
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	// prefixIndex is the database key prefix of the secondary indexes.
+	prefixIndex = "index"
+
+	// keyIndexVersion records the version of the secondary indexes, so
+	// that they are rebuilt when missing or outdated.
+	keyIndexVersion = []byte("meta:index_version")
+)
+
+// indexVersion is the version of the secondary indexes. Bump it whenever the
+// indexed fields change.
+const indexVersion = "1"
+
+// indexes are the secondary indexes maintained along with the tasks, by name,
+// and how to derive the indexed value of a task. Tasks with an empty value are
+// not indexed.
+//
+// Index entries are keyed by the index name, the indexed value and the key of
+// the task without its prefix, so that they can be ranged over by time, like
+// tasks; entries hold the prefix the task is currently stored under.
+var indexes = map[string]func(*Task) string{
+	"plan":    func(t *Task) string { return t.Plan },
+	"case":    func(t *Task) string { return t.Case },
+	"runner":  func(t *Task) string { return t.Runner },
+	"outcome": func(t *Task) string { return string(t.indexedOutcome()) },
+	"repo":    func(t *Task) string { return t.CreatedBy.Repo },
+	"branch":  func(t *Task) string { return t.CreatedBy.Branch },
+	"commit":  func(t *Task) string { return t.CreatedBy.Commit },
+	"user":    func(t *Task) string { return t.CreatedBy.User },
+}
+
+// Query (kind: struct) selects tasks from the storage. Empty fields match all tasks.
+type Query struct {
+	States  []State   // Scheduled, processing or complete
+	Types   []Type    // Type of the tasks
+	After   time.Time // Created at or after, at second precision
+	Before  time.Time // Created before, at second precision
+	Plan    string    // Test plan
+	Case    string    // Test case
+	Runner  string    // Runner
+	Outcome Outcome   // Outcome; unknown until the task is complete
+	Repo    string    // Repository the task was created from
+	Branch  string    // Branch the task was created from
+	Commit  string    // Commit the task was created from
+	User    string    // User who created the task
+
+	Ascending bool // Return the oldest tasks first, instead of the newest
+	Offset    int  // Number of matching tasks to skip
+	Limit     int  // Maximum number of tasks to return; zero for no limit
+}
+
+// indexed returns the most selective index the query can be answered from,
+// along with the value looked up, if any.
+func (q *Query) indexed() (name string, value string, ok bool) {
+	for _, idx := range []struct {
+		name  string
+		value string
+	}{
+		{"commit", q.Commit},
+		{"user", q.User},
+		{"branch", q.Branch},
+		{"repo", q.Repo},
+		{"case", q.Case},
+		{"plan", q.Plan},
+		{"runner", q.Runner},
+		{"outcome", string(q.Outcome)},
+	} {
+		if idx.value != "" {
+			return idx.name, idx.value, true
+		}
+	}
+	return "", "", false
+}
+
+// match returns whether the task matches the query, regardless of its state
+// and creation time.
+func (q *Query) match(t *Task) bool {
+	if len(q.Types) > 0 {
+		var ok bool
+		for _, tp := range q.Types {
+			ok = ok || t.Type == tp
+		}
+		if !ok {
+			return false
+		}
+	}
+	return (q.Plan == "" || t.Plan == q.Plan) &&
+		(q.Case == "" || t.Case == q.Case) &&
+		(q.Runner == "" || t.Runner == q.Runner) &&
+		(q.Outcome == "" || t.indexedOutcome() == q.Outcome) &&
+		(q.Repo == "" || t.CreatedBy.Repo == q.Repo) &&
+		(q.Branch == "" || t.CreatedBy.Branch == q.Branch) &&
+		(q.Commit == "" || t.CreatedBy.Commit == q.Commit) &&
+		(q.User == "" || t.CreatedBy.User == q.User)
+}
+
+// indexedOutcome returns the outcome of the task, as decoded by
+// data.DecodeTaskOutcome: tasks that completed carry their outcome in their
+// result, and complete successfully unless it says otherwise.
+func (t *Task) indexedOutcome() Outcome {
+	if len(t.States) == 0 {
+		return OutcomeUnknown
+	}
+	switch t.State().State {
+	case StateCanceled:
+		return OutcomeCanceled
+	case StateComplete:
+		// continue
+	default:
+		return OutcomeUnknown
+	}
+	if t.Result == nil {
+		return OutcomeSuccess
+	}
+
+	var res struct {
+		Outcome Outcome `json:"outcome"`
+	}
+	if b, err := json.Marshal(t.Result); err != nil || json.Unmarshal(b, &res) != nil || res.Outcome == "" {
+		return OutcomeSuccess
+	}
+	return res.Outcome
+}
+
+// indexKeys returns the keys of the index entries of the task, stored as val.
+func indexKeys(val []byte) (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	if val == nil {
+		return keys, nil
+	}
+
+	tsk := &Task{}
+	if err := json.Unmarshal(val, tsk); err != nil {
+		return nil, err
+	}
+	suffix, err := taskKeySuffix(tsk.ID)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range indexes {
+		if v := value(tsk); v != "" {
+			keys[indexPrefix(name, v)+suffix] = struct{}{}
+		}
+	}
+	return keys, nil
+}
+
+// indexPrefix returns the prefix of the entries of the named index for the
+// given value. Values are escaped, so that they can't contain the separator.
+func indexPrefix(name string, value string) string {
+	return strings.Join([]string{prefixIndex, name, url.QueryEscape(value), ""}, ":")
+}
+
+// reindex records in the batch the changes to the index entries of a task
+// whose stored value changes from prev to val, under prefix; either may be
+// nil, when the task is created or deleted.
+func reindex(b *leveldb.Batch, prev []byte, val []byte, prefix string) error {
+	stale, err := indexKeys(prev)
+	if err != nil {
+		return err
+	}
+	keys, err := indexKeys(val)
+	if err != nil {
+		return err
+	}
+	for key := range stale {
+		if _, ok := keys[key]; !ok {
+			b.Delete([]byte(key))
+		}
+	}
+	// the prefix of the task may have changed, so all entries are written.
+	for key := range keys {
+		b.Put([]byte(key), []byte(prefix))
+	}
+	return nil
+}
+
+// ensureIndexes rebuilds the secondary indexes if they're missing or outdated,
+// such as when opening a database written by an older version.
+func (s *Storage) ensureIndexes() error {
+	v, err := s.db.Get(keyIndexVersion, nil)
+	if err == nil && string(v) == indexVersion {
+		return nil
+	}
+	if err != nil && err != leveldb.ErrNotFound {
+		return err
+	}
+
+	trans, err := s.db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+
+	b := new(leveldb.Batch)
+	iter := trans.NewIterator(util.BytesPrefix([]byte(prefixIndex+":")), nil)
+	for iter.Next() {
+		b.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+
+	for _, prefix := range []string{prefixScheduled, prefixProcessing, prefixComplete} {
+		iter := trans.NewIterator(util.BytesPrefix([]byte(prefix+":")), nil)
+		for iter.Next() {
+			if err := reindex(b, nil, iter.Value(), prefix); err != nil {
+				iter.Release()
+				trans.Discard()
+				return err
+			}
+		}
+		iter.Release()
+	}
+	b.Put(keyIndexVersion, []byte(indexVersion))
+
+	if err := trans.Write(b, nil); err != nil {
+		trans.Discard()
+		return err
+	}
+	return trans.Commit()
+}
+
+// Query returns the tasks matching the query, sorted by creation time.
+//
+// Tasks are looked up through the most selective secondary index the query
+// filters on, if any; otherwise, all tasks in the requested states and time
+// range are scanned.
+func (s *Storage) Query(q Query) ([]*Task, error) {
+	prefixes := make(map[string]struct{})
+	for _, state := range q.States {
+		prefixes[statePrefix(state)] = struct{}{}
+	}
+	if len(q.States) == 0 {
+		for _, prefix := range []string{prefixScheduled, prefixProcessing, prefixComplete} {
+			prefixes[prefix] = struct{}{}
+		}
+	}
+
+	var tasks []*Task
+	if name, value, ok := q.indexed(); ok {
+		iter := s.db.NewIterator(timeRange(indexPrefix(name, value), q.After, q.Before), nil)
+		for iter.Next() {
+			prefix := string(iter.Value())
+			if _, ok := prefixes[prefix]; !ok {
+				continue
+			}
+			key := string(iter.Key())
+			tsk, err := s.get(prefix, key[strings.LastIndex(key, "_")+1:])
+			if err != nil {
+				iter.Release()
+				return nil, err
+			}
+			if q.match(tsk) {
+				tasks = append(tasks, tsk)
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+	} else {
+		for prefix := range prefixes {
+			tsks, err := s.iter(timeRange(prefix+":", q.After, q.Before))
+			if err != nil {
+				return nil, err
+			}
+			for _, tsk := range tsks {
+				if q.match(tsk) {
+					tasks = append(tasks, tsk)
+				}
+			}
+		}
+	}
+
+	// task IDs are sortable by creation time.
+	sort.Slice(tasks, func(i, j int) bool {
+		if q.Ascending {
+			return tasks[i].ID < tasks[j].ID
+		}
+		return tasks[i].ID > tasks[j].ID
+	})
+
+	if q.Offset >= len(tasks) {
+		return []*Task{}, nil
+	}
+	tasks = tasks[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(tasks) {
+		tasks = tasks[:q.Limit]
+	}
+	return tasks, nil
+}
+
+// timeRange returns the range of the keys under prefix created between start
+// and end, at second precision. Zero times denote no bound.
+func timeRange(prefix string, start time.Time, end time.Time) *util.Range {
+	rng := util.BytesPrefix([]byte(prefix))
+	if !start.IsZero() {
+		rng.Start = []byte(prefix + strconv.FormatInt(start.Unix(), 10))
+	}
+	if !end.IsZero() {
+		rng.Limit = []byte(prefix + strconv.FormatInt(end.Unix(), 10))
+	}
+	return rng
+}
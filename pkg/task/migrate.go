@@ -0,0 +1,188 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// CurrentVersion is the schema version of the tasks written by this release.
+// Tasks stored by older releases are upgraded to it when the storage is
+// opened.
+//
+//  0. Tasks written before versioning was introduced.
+//  1. Processed tasks record their attempts.
+const CurrentVersion = 1
+
+// ErrFutureVersion is returned when reading tasks written by a newer release,
+// which this release can't tell how to read.
+var ErrFutureVersion = errors.New("task schema version is newer than supported")
+
+// keySchemaVersion records the schema version all stored tasks were upgraded
+// to, so that they aren't scanned every time the storage is opened.
+var keySchemaVersion = []byte("meta:schema_version")
+
+// migrations upgrade a task document from the schema version at their index
+// to the next one. Documents are decoded generically, rather than into Task,
+// so that migrations keep working as Task changes.
+var migrations = []func(doc map[string]interface{}) error{
+	migrateAttempts,
+}
+
+// Migrate upgrades the JSON document of a task to CurrentVersion. It returns
+// the document unchanged if it's up to date, and ErrFutureVersion if it was
+// written by a newer release.
+func Migrate(val []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(val))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	v, err := docVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case v > CurrentVersion:
+		return nil, fmt.Errorf("%w: task %v has version %d; this release supports up to %d", ErrFutureVersion, doc["id"], v, CurrentVersion)
+	case v == CurrentVersion:
+		return val, nil
+	}
+
+	for ; v < CurrentVersion; v++ {
+		if err := migrations[v](doc); err != nil {
+			return nil, fmt.Errorf("failed to upgrade task %v from version %d: %w", doc["id"], v, err)
+		}
+		doc["version"] = v + 1
+	}
+	return json.Marshal(doc)
+}
+
+// docVersion returns the schema version of a task document.
+func docVersion(doc map[string]interface{}) (int, error) {
+	switch v := doc["version"].(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		n, err := strconv.Atoi(v.String())
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid task schema version: %s", v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("invalid task schema version: %v", v)
+	}
+}
+
+// migrate upgrades the stored tasks to CurrentVersion, atomically. It fails
+// without changing anything if any task was written by a newer release.
+func (s *Storage) migrate() error {
+	v, err := s.db.Get(keySchemaVersion, nil)
+	switch {
+	case err == leveldb.ErrNotFound:
+	case err != nil:
+		return err
+	default:
+		n, err := strconv.Atoi(string(v))
+		if err != nil {
+			return fmt.Errorf("invalid storage schema version: %s", v)
+		}
+		if n > CurrentVersion {
+			return fmt.Errorf("%w: storage has version %d; this release supports up to %d", ErrFutureVersion, n, CurrentVersion)
+		}
+		if n == CurrentVersion {
+			return nil
+		}
+	}
+
+	trans, err := s.db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+
+	var (
+		b        = new(leveldb.Batch)
+		upgraded int
+	)
+	for _, prefix := range []string{prefixScheduled, prefixProcessing, prefixComplete} {
+		iter := trans.NewIterator(util.BytesPrefix([]byte(prefix+":")), nil)
+		for iter.Next() {
+			val, err := Migrate(iter.Value())
+			if err != nil {
+				iter.Release()
+				trans.Discard()
+				return err
+			}
+			if !bytes.Equal(val, iter.Value()) {
+				b.Put(append([]byte(nil), iter.Key()...), val)
+				upgraded++
+			}
+		}
+		iter.Release()
+	}
+	b.Put(keySchemaVersion, []byte(strconv.Itoa(CurrentVersion)))
+	if upgraded > 0 {
+		// the indexes are rebuilt from the upgraded tasks.
+		b.Delete(keyIndexVersion)
+	}
+
+	if err := trans.Write(b, nil); err != nil {
+		trans.Discard()
+		return err
+	}
+	return trans.Commit()
+}
+
+// migrateAttempts records the single attempt made at processing tasks
+// written before attempts were recorded, once they're done with.
+func migrateAttempts(doc map[string]interface{}) error {
+	if attempts, _ := doc["attempts"].([]interface{}); len(attempts) > 0 {
+		return nil
+	}
+	states, _ := doc["states"].([]interface{})
+	if len(states) == 0 {
+		return nil
+	}
+
+	state := func(i int) (State, time.Time, error) {
+		s, _ := states[i].(map[string]interface{})
+		name, _ := s["state"].(string)
+		created, _ := s["created"].(string)
+		t, err := time.Parse(time.RFC3339Nano, created)
+		return State(name), t, err
+	}
+
+	last, ended, err := state(len(states) - 1)
+	if err != nil {
+		return err
+	}
+	if last != StateComplete && last != StateCanceled {
+		return nil
+	}
+	for i := range states {
+		st, started, err := state(i)
+		if err != nil {
+			return err
+		}
+		if st != StateProcessing {
+			continue
+		}
+		errStr, _ := doc["error"].(string)
+		doc["attempts"] = []Attempt{{
+			Started: started,
+			Ended:   ended,
+			State:   last,
+			Error:   errStr,
+		}}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IDs of the tasks in testdata/v0.db, written by a release predating schema
+// versions.
+const (
+	v0Run      = "brf7im74vacd3qojmb2g" // run, complete
+	v0Build    = "brf7j574vacd3qojmb30" // build, failed
+	v0Canceled = "brf7jk74vacd3qojmb3g" // run, canceled while scheduled
+	v0Queued   = "brf7k374vacd3qojmb40" // run, scheduled
+)
+
+// openFixture opens a copy of the fixture database with the given name.
+func openFixture(t *testing.T, name string) (string, *Storage, error) {
+	dir, err := ioutil.TempDir("", "tasks")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	src := filepath.Join("testdata", name)
+	fis, err := ioutil.ReadDir(src)
+	require.NoError(t, err)
+	for _, fi := range fis {
+		b, err := ioutil.ReadFile(filepath.Join(src, fi.Name()))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fi.Name()), b, 0644))
+	}
+
+	s, err := NewTaskStorage(dir)
+	if err == nil {
+		t.Cleanup(func() { s.db.Close() })
+	}
+	return dir, s, err
+}
+
+func TestMigrateFromVersion0(t *testing.T) {
+	dir, s, err := openFixture(t, "v0.db")
+	require.NoError(t, err)
+
+	for _, id := range []string{v0Run, v0Build, v0Canceled, v0Queued} {
+		tsk, err := s.Get(id)
+		require.NoError(t, err)
+		assert.Equal(t, CurrentVersion, tsk.Version, id)
+	}
+
+	// processed tasks record the attempt made at processing them.
+	run, err := s.Get(v0Run)
+	require.NoError(t, err)
+	require.Len(t, run.Attempts, 1)
+	assert.Equal(t, StateComplete, run.Attempts[0].State)
+	assert.Equal(t, 40*time.Second, run.Attempts[0].Ended.Sub(run.Attempts[0].Started))
+	assert.Equal(t, run.States[1].Created, run.Attempts[0].Started)
+
+	build, err := s.Get(v0Build)
+	require.NoError(t, err)
+	require.Len(t, build.Attempts, 1)
+	assert.Equal(t, "docker build failed", build.Attempts[0].Error)
+	assert.Equal(t, 1, build.Priority)
+
+	for _, id := range []string{v0Canceled, v0Queued} {
+		tsk, err := s.Get(id)
+		require.NoError(t, err)
+		assert.Empty(t, tsk.Attempts, id)
+	}
+
+	// upgraded tasks are indexed.
+	tsks, err := s.Query(Query{User: "alice"})
+	require.NoError(t, err)
+	require.Len(t, tsks, 2)
+	assert.Equal(t, v0Queued, tsks[0].ID)
+	assert.Equal(t, v0Run, tsks[1].ID)
+
+	tsks, err = s.Query(Query{Commit: "f00ba4"})
+	require.NoError(t, err)
+	require.Len(t, tsks, 1)
+	assert.Equal(t, v0Build, tsks[0].ID)
+
+	// once upgraded, tasks aren't scanned again.
+	v, err := s.db.Get(keySchemaVersion, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(v))
+
+	require.NoError(t, s.db.Close())
+	s, err = NewTaskStorage(dir)
+	require.NoError(t, err)
+	defer s.db.Close()
+
+	again, err := s.Get(v0Run)
+	require.NoError(t, err)
+	assert.Equal(t, run, again)
+}
+
+func TestMigrateRefusesFutureVersions(t *testing.T) {
+	dir, _, err := openFixture(t, "future.db")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrFutureVersion), err)
+
+	// nothing was changed, and the database was released.
+	_, err = NewTaskStorage(dir)
+	assert.True(t, errors.Is(err, ErrFutureVersion), err)
+
+	// a storage upgraded by a newer release is refused as a whole.
+	s, err := NewMemoryTaskStorage()
+	require.NoError(t, err)
+	require.NoError(t, s.db.Put(keySchemaVersion, []byte("99"), nil))
+	assert.True(t, errors.Is(s.migrate(), ErrFutureVersion))
+}
+
+func TestMigrateDocument(t *testing.T) {
+	// documents up to date are left as is.
+	doc := []byte(`{"version":1,"id":"brf7im74vacd3qojmb2g","priority":3}`)
+	val, err := Migrate(doc)
+	require.NoError(t, err)
+	assert.Equal(t, doc, val)
+
+	// numbers survive upgrades exactly.
+	val, err = Migrate([]byte(`{"id":"brf7im74vacd3qojmb2g","priority":9007199254740993}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":1,"id":"brf7im74vacd3qojmb2g","priority":9007199254740993}`, string(val))
+
+	_, err = Migrate([]byte(`{"version":2}`))
+	assert.True(t, errors.Is(err, ErrFutureVersion))
+
+	_, err = Migrate([]byte(`{"version":"one"}`))
+	assert.Error(t, err)
+}
@@ -2,11 +2,13 @@ package task
 
 import (
 	"container/heap"
+	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/testground/testground/pkg/logging"
 )
 
@@ -15,35 +17,205 @@ var (
 	ErrQueueFull  = errors.New("queue full")
 )
 
-func NewQueue(ts *Storage, max int, converter func([]byte) (*Task, error)) (*Queue, error) {
-	tq := new(taskQueue)
-	for _, prefix := range []string{prefixScheduled, prefixProcessing} {
+// recheckInterval is how often tasks waiting for resources are reconsidered,
+// when the queue doesn't change in the meantime. The resources available to a
+// runner can change outside of the queue.
+const recheckInterval = 30 * time.Second
+
+// NewQueue creates a queue backed by the given storage, loading the active
+// tasks it holds through converter. outcome decodes the outcome of completed
+// tasks, to decide whether the tasks depending on them can be scheduled; if
+// nil, completed tasks are considered successful.
+func NewQueue(ts TaskStore, max int, converter func([]byte) (*Task, error), outcome func(*Task) (Outcome, error)) (*Queue, error) {
+	tq := &taskQueue{served: make(map[string]uint64)}
+	for _, state := range []State{StateScheduled, StateProcessing} {
 		// read the active tasks into the queue
-		iter := ts.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
-		for iter.Next() {
-			tsk, err := converter(iter.Value())
+		docs, err := ts.Documents(state)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			tsk, err := converter(doc)
 			if err != nil {
 				return nil, err
 			}
 			heap.Push(tq, tsk)
 		}
-		iter.Release()
 	}
 	// correct the eviction order so we will evict oldest items first
 	return &Queue{
-		tq:  tq,
-		ts:  ts,
-		max: max,
+		tq:      tq,
+		ts:      ts,
+		max:     max,
+		outcome: outcome,
+		running: make(map[string]*Task),
+		reasons: make(map[string]string),
+		changed: make(chan struct{}),
 	}, nil
 }
 
+// Limits caps the number of tasks processed at once. Zero values denote no
+// limit.
+type Limits struct {
+	// PerRunner is the maximum number of tasks processed at once by each
+	// runner, keyed by runner ID.
+	PerRunner map[string]int
+	// PerUser is the maximum number of tasks processed at once for each user.
+	PerUser int
+	// PerRepo is the maximum number of tasks processed at once for each
+	// repository.
+	PerRepo int
+}
+
+// Admission controls which tasks may start, based on the resources they need
+// and those in use by the tasks already started.
+type Admission interface {
+	// Admit returns whether the task can start now, reserving the resources
+	// it needs if so.
+	Admit(tsk *Task) bool
+
+	// Release frees the resources reserved for the task.
+	Release(tsk *Task)
+}
+
 // Queue is a priority queue for tasks.
 type Queue struct {
 	sync.Mutex
 	tq *taskQueue
-	ts *Storage
+	ts TaskStore
 
 	max int // the maximum number of tasks to keep in the database
+
+	outcome   func(*Task) (Outcome, error) // decodes the outcome of prerequisites
+	admission Admission                    // admits tasks based on resources, if set
+	limits    Limits                       // caps the tasks processed at once
+
+	running map[string]*Task  // tasks popped and not yet released, by ID
+	reasons map[string]string // why scheduled tasks are still waiting, by ID
+	served  uint64            // sequence number of the last task popped
+
+	changed chan struct{} // closed and replaced on every change of the queue
+	wakeAt  time.Time     // when waiting tasks may be ready, as of the last pop
+}
+
+// SetAdmission sets the admission control applied to popped tasks.
+func (q *Queue) SetAdmission(a Admission) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.admission = a
+}
+
+// SetLimits sets the concurrency limits applied to popped tasks.
+func (q *Queue) SetLimits(l Limits) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.limits = l
+}
+
+// Changed returns a channel closed on the next change of the queue: a task
+// pushed, popped, requeued, released or canceled, or a popped task changing
+// state. Obtain the channel before inspecting the queue or its tasks, so that
+// no change goes unnoticed.
+func (q *Queue) Changed() <-chan struct{} {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.changed
+}
+
+// Notify wakes up those waiting for a change of the queue. It must be called
+// when the state of a popped task changes.
+func (q *Queue) Notify() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.notify()
+}
+
+// notify wakes up those waiting for a change of the queue. q must be locked.
+func (q *Queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Release marks a popped task as done, freeing its slot in the concurrency
+// limits and the resources reserved by the admission control. It must be
+// called once the task is done.
+func (q *Queue) Release(tsk *Task) {
+	q.Lock()
+	delete(q.running, tsk.ID)
+	a := q.admission
+	q.Unlock()
+
+	if a != nil {
+		a.Release(tsk)
+	}
+
+	// the slot and resources of the task are free, and the tasks depending
+	// on it may be ready.
+	q.Notify()
+}
+
+// Requeue schedules a popped task again, in its original position: the task
+// keeps its creation time. The task is released from the concurrency limits
+// and admission control.
+func (q *Queue) Requeue(tsk *Task) error {
+	q.Lock()
+	defer q.Unlock()
+
+	delete(q.running, tsk.ID)
+	if q.admission != nil {
+		q.admission.Release(tsk)
+	}
+
+	tsk.States = append(tsk.States, DatedState{
+		State:   StateScheduled,
+		Created: time.Now().UTC(),
+	})
+	if err := q.ts.RequeueTask(tsk); err != nil {
+		return err
+	}
+	heap.Push(q.tq, tsk)
+	q.notify()
+	return nil
+}
+
+// Running returns the tasks popped and not yet released.
+func (q *Queue) Running() []*Task {
+	q.Lock()
+	defer q.Unlock()
+
+	ret := make([]*Task, 0, len(q.running))
+	for _, tsk := range q.running {
+		ret = append(ret, tsk)
+	}
+	return ret
+}
+
+// Scheduled returns the scheduled tasks, in the order they are considered for
+// processing.
+func (q *Queue) Scheduled() []*Task {
+	q.Lock()
+	defer q.Unlock()
+
+	tq := &taskQueue{
+		tasks:  append([]*Task(nil), q.tq.tasks...),
+		served: q.tq.served,
+	}
+	sort.Sort(tq)
+	return tq.tasks
+}
+
+// WaitingReason returns why the scheduled task with the given ID wasn't
+// popped yet, as of the last attempt. It returns an empty string if the task
+// was not considered yet, or isn't scheduled.
+func (q *Queue) WaitingReason(id string) string {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.reasons[id]
 }
 
 // Add an item to the priority queue
@@ -72,6 +244,7 @@ func (q *Queue) pushUnsafe(tsk *Task) error {
 	}
 	// Push this task to the queue
 	heap.Push(q.tq, tsk)
+	q.notify()
 
 	return nil
 }
@@ -84,7 +257,7 @@ func (q *Queue) PushUniqueByBranch(tsk *Task) error {
 	// Remove existing tasks from same branch end repo before pushing a new task
 	var err error
 	if tsk.CreatedBy.Repo != "" && tsk.CreatedBy.Branch != "" {
-		err = q.removeExisting(tsk.CreatedBy.Branch, tsk.CreatedBy.Repo)
+		err = q.removeExisting(tsk)
 	}
 
 	if err != nil {
@@ -100,30 +273,239 @@ func (q *Queue) PushUniqueByBranch(tsk *Task) error {
 // Pop the task off of the queue
 // The task remains in the database, but is no longer in the heap.
 // As the state of the task changes
+//
+// Tasks of the same priority are popped in turns across users, oldest first
+// for each user.
+//
+// Tasks being retried are only popped once their backoff elapsed. Tasks
+// depending on other tasks are only popped once all their prerequisites
+// completed successfully; until then, they are skipped in favour of the next
+// task in priority order. Tasks whose prerequisites failed or were canceled
+// are canceled. Tasks whose runner, user or repository reached its
+// concurrency limit are skipped too.
+//
+// If an admission control is set, tasks are only popped once admitted. A task
+// that isn't admitted holds back the lower priority tasks for the same runner,
+// so that it isn't starved by smaller tasks. ErrQueueEmpty is returned if no
+// task is ready.
+//
+// The reason each skipped task is still waiting is available through
+// WaitingReason.
 func (q *Queue) Pop() (*Task, error) {
 	q.Lock()
 	defer q.Unlock()
+
+	q.wakeAt = time.Time{}
 	if q.tq.Len() == 0 {
 		return nil, ErrQueueEmpty
 	}
 	logging.S().Debugw("queue.pop", "len", q.tq.Len())
-	tsk := heap.Pop(q.tq).(*Task)
 
-	logging.S().Debugw("queue.pop.got-task", "id", tsk.ID, "taskname", tsk.Name())
-	err := q.ts.ProcessTask(tsk)
-	if err != nil {
-		return nil, err
+	// the turns of users change as tasks are popped; restore the order.
+	heap.Init(q.tq)
+
+	// tasks waiting for their prerequisites, a slot or resources go back into
+	// the heap.
+	var (
+		waiting []*Task
+		blocked = make(map[string]string) // task held back, by runner
+	)
+	defer func() {
+		for _, tsk := range waiting {
+			heap.Push(q.tq, tsk)
+		}
+	}()
+	wait := func(tsk *Task, reason string) {
+		q.reasons[tsk.ID] = reason
+		waiting = append(waiting, tsk)
 	}
-	return tsk, nil
+	wakeAt := func(t time.Time) {
+		if q.wakeAt.IsZero() || t.Before(q.wakeAt) {
+			q.wakeAt = t
+		}
+	}
+
+	now := time.Now()
+	for q.tq.Len() > 0 {
+		tsk := heap.Pop(q.tq).(*Task)
+
+		if tsk.RetryAt.After(now) {
+			wakeAt(tsk.RetryAt)
+			wait(tsk, fmt.Sprintf("waiting to retry at %s", tsk.RetryAt.Format(time.RFC3339)))
+			continue
+		}
+
+		ready, err := q.checkPrerequisites(tsk)
+		if err != nil {
+			logging.S().Infow("queue.pop.canceling-dependant", "id", tsk.ID, "err", err)
+			tsk.Error = err.Error()
+			delete(q.reasons, tsk.ID)
+			if err := q.cancelTask(tsk); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !ready {
+			wait(tsk, "waiting for prerequisite tasks to complete")
+			continue
+		}
+		if reason := q.checkLimits(tsk); reason != "" {
+			wait(tsk, reason)
+			continue
+		}
+		if q.admission != nil {
+			if id, ok := blocked[tsk.Runner]; ok {
+				wait(tsk, fmt.Sprintf("waiting behind task %s for resources on runner %s", id, tsk.Runner))
+				continue
+			}
+			if !q.admission.Admit(tsk) {
+				wakeAt(now.Add(recheckInterval))
+				blocked[tsk.Runner] = tsk.ID
+				wait(tsk, fmt.Sprintf("waiting for resources on runner %s", tsk.Runner))
+				continue
+			}
+		}
+
+		logging.S().Debugw("queue.pop.got-task", "id", tsk.ID, "taskname", tsk.Name())
+		err = q.ts.ProcessTask(tsk)
+		if err != nil {
+			if q.admission != nil {
+				q.admission.Release(tsk)
+			}
+			return nil, err
+		}
+
+		delete(q.reasons, tsk.ID)
+		q.running[tsk.ID] = tsk
+		q.served++
+		q.tq.served[tsk.CreatedBy.User] = q.served
+		q.notify()
+		return tsk, nil
+	}
+	return nil, ErrQueueEmpty
 }
 
-// Remove all existing tasks from the queue that match the given branch/string
-func (q *Queue) removeExisting(branch string, repo string) error {
-	var err error
+// PopWait pops the next task ready to be processed, like Pop, waiting until
+// one is: it tries again whenever the queue changes, and when a task waiting
+// to retry or for resources may be ready. It returns the error of the context
+// if it's done first.
+func (q *Queue) PopWait(ctx context.Context) (*Task, error) {
+	for {
+		changed := q.Changed()
+		tsk, err := q.Pop()
+		if err != ErrQueueEmpty {
+			return tsk, err
+		}
+
+		if err := q.wait(ctx, changed); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait blocks until the changed channel is closed, or until the tasks left
+// waiting by the last pop may be ready. It returns the error of the context if
+// it's done first.
+func (q *Queue) wait(ctx context.Context, changed <-chan struct{}) error {
+	q.Lock()
+	wakeAt := q.wakeAt
+	q.Unlock()
+
+	var due <-chan time.Time
+	if !wakeAt.IsZero() {
+		timer := time.NewTimer(time.Until(wakeAt))
+		defer timer.Stop()
+		due = timer.C
+	}
+
+	select {
+	case <-changed:
+	case <-due:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// checkLimits returns why the task can't be processed without exceeding the
+// concurrency limits, or an empty string if it can.
+func (q *Queue) checkLimits(tsk *Task) string {
+	var (
+		user, repo = tsk.CreatedBy.User, tsk.CreatedBy.Repo
+		runners    int
+		users      int
+		repos      int
+	)
+	for _, r := range q.running {
+		if r.Runner == tsk.Runner {
+			runners++
+		}
+		if user != "" && r.CreatedBy.User == user {
+			users++
+		}
+		if repo != "" && r.CreatedBy.Repo == repo {
+			repos++
+		}
+	}
+
+	switch max := q.limits.PerRunner[tsk.Runner]; {
+	case max > 0 && runners >= max:
+		return fmt.Sprintf("runner %s is at its limit of %d concurrent tasks", tsk.Runner, max)
+	case user != "" && q.limits.PerUser > 0 && users >= q.limits.PerUser:
+		return fmt.Sprintf("user %s is at the limit of %d concurrent tasks", user, q.limits.PerUser)
+	case repo != "" && q.limits.PerRepo > 0 && repos >= q.limits.PerRepo:
+		return fmt.Sprintf("repo %s is at the limit of %d concurrent tasks", repo, q.limits.PerRepo)
+	}
+	return ""
+}
+
+// checkPrerequisites returns whether all the tasks the given task depends on
+// completed successfully. It returns an error if any of them failed, was
+// canceled, or doesn't exist.
+func (q *Queue) checkPrerequisites(tsk *Task) (bool, error) {
+	for _, id := range tsk.DependsOn {
+		pre, err := q.ts.Get(id)
+		if err == ErrNotFound {
+			return false, fmt.Errorf("prerequisite task %s not found", id)
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch pre.State().State {
+		case StateScheduled, StateProcessing:
+			return false, nil
+		case StateCanceled:
+			return false, fmt.Errorf("prerequisite task %s was canceled", id)
+		}
+
+		if q.outcome == nil {
+			continue
+		}
+		outcome, err := q.outcome(pre)
+		if err != nil {
+			return false, fmt.Errorf("failed to decode outcome of prerequisite task %s: %w", id, err)
+		}
+		if outcome != OutcomeSuccess {
+			return false, fmt.Errorf("prerequisite task %s did not succeed; outcome: %s", id, outcome)
+		}
+	}
+	return true, nil
+}
+
+// Remove all existing tasks from the queue that match the branch/repo of the given task.
+// Tasks belonging to the same sweep or dependency graph as the given task are kept.
+func (q *Queue) removeExisting(tsk *Task) error {
+	var (
+		err    error
+		branch = tsk.CreatedBy.Branch
+		repo   = tsk.CreatedBy.Repo
+	)
+	graph := q.graphOf(tsk)
 	keep_indexes := make([]int, 0)
-	for index, qTask := range *q.tq {
+	for index, qTask := range q.tq.tasks {
 		// if task matches both branch and repo, cancel it
-		if qTask.CreatedBy.Repo == repo && qTask.CreatedBy.Branch == branch {
+		if qTask.CreatedBy.Repo == repo && qTask.CreatedBy.Branch == branch && !qTask.InSameSweep(tsk) && !graph[qTask.ID] {
 			err = q.cancelTask(qTask)
 			if err != nil {
 				return err
@@ -135,14 +517,39 @@ func (q *Queue) removeExisting(branch string, repo string) error {
 	}
 	keep_tasks := make([]*Task, len(keep_indexes))
 	for index, value := range keep_indexes {
-		keep_tasks[index] = (*q.tq)[value]
+		keep_tasks[index] = q.tq.tasks[value]
 	}
 
-	*q.tq = keep_tasks
+	q.tq.tasks = keep_tasks
 
 	return nil
 }
 
+// graphOf returns the IDs of the tasks connected to the given task through
+// dependencies, directly or transitively, among the queued tasks.
+func (q *Queue) graphOf(tsk *Task) map[string]bool {
+	edges := make(map[string][]string)
+	for _, t := range append([]*Task{tsk}, q.tq.tasks...) {
+		for _, id := range t.DependsOn {
+			edges[t.ID] = append(edges[t.ID], id)
+			edges[id] = append(edges[id], t.ID)
+		}
+	}
+
+	graph := map[string]bool{tsk.ID: true}
+	for next := []string{tsk.ID}; len(next) > 0; {
+		id := next[0]
+		next = next[1:]
+		for _, other := range edges[id] {
+			if !graph[other] {
+				graph[other] = true
+				next = append(next, other)
+			}
+		}
+	}
+	return graph
+}
+
 // Cancels the given task:
 // 1. Changes the state to Canceled
 // 2. Persists changes to the queue storage
@@ -160,6 +567,7 @@ func (q *Queue) cancelTask(tsk *Task) error {
 		State:   StateCanceled,
 	}
 	tsk.States = append(tsk.States, newState)
+	delete(q.reasons, tsk.ID)
 	// Apply state changes
 	err = q.ts.PersistProcessing(tsk)
 	if err != nil {
@@ -168,39 +576,56 @@ func (q *Queue) cancelTask(tsk *Task) error {
 
 	// Move task to "archived" state
 	err = q.ts.ArchiveTask(tsk)
-	return err
+	if err != nil {
+		return err
+	}
+
+	q.notify()
+	return nil
 }
 
 // This is a priority queue which implements container/heap.Interface
-// Tasks are sorted by priority and then timestamp.
-type taskQueue []*Task
+// Tasks are sorted by priority, then by the turn of the user who created them,
+// and then timestamp.
+type taskQueue struct {
+	tasks []*Task
+
+	// served records when a task of each user was last popped, as a sequence
+	// number. Users served least recently take their turn first.
+	served map[string]uint64
+}
 
 func (q taskQueue) Len() int {
-	return len(q)
+	return len(q.tasks)
 }
 
 func (q taskQueue) Less(i, j int) bool {
-	if q[i].Priority != q[j].Priority {
-		return q[i].Priority > q[j].Priority
+	ti, tj := q.tasks[i], q.tasks[j]
+	if ti.Priority != tj.Priority {
+		return ti.Priority > tj.Priority
+	}
+
+	if si, sj := q.served[ti.CreatedBy.User], q.served[tj.CreatedBy.User]; si != sj {
+		return si < sj
 	}
 
 	// This will silently work incorrectly! using default time.Time{} will cause the queue to be
 	// mis-sorted among tasks of the same priority.
 
-	return q[i].Created().Before(q[j].Created())
+	return ti.Created().Before(tj.Created())
 }
 
 func (q taskQueue) Swap(i, j int) {
-	q[j], q[i] = q[i], q[j]
+	q.tasks[j], q.tasks[i] = q.tasks[i], q.tasks[j]
 }
 
 func (q *taskQueue) Push(x interface{}) {
 	t := x.(*Task)
-	*q = append(*q, t)
+	q.tasks = append(q.tasks, t)
 }
 
 func (q *taskQueue) Pop() interface{} {
-	t := (*q)[len(*q)-1]
-	*q = (*q)[:len(*q)-1]
+	t := q.tasks[len(q.tasks)-1]
+	q.tasks = q.tasks[:len(q.tasks)-1]
 	return t
 }
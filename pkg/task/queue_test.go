@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 	"time"
@@ -18,7 +19,7 @@ func TestQueueIsPersistent(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	q, err := NewQueue(&Storage{db}, 1, convertTask)
+	q, err := NewQueue(&Storage{db}, 1, convertTask, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,7 +32,7 @@ func TestQueueIsPersistent(t *testing.T) {
 		t.Fatal(err)
 	}
 	// read the object from the backend
-	tsk2, err := q.ts.get(prefixScheduled, tsk.ID)
+	tsk2, err := q.ts.(*Storage).get(prefixScheduled, tsk.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -51,7 +52,7 @@ func TestQueueReloads(t *testing.T) {
 	ts := &Storage{db}
 
 	// open q1 and push an item into the queue
-	q1, err := NewQueue(ts, 1, convertTask)
+	q1, err := NewQueue(ts, 1, convertTask, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -63,7 +64,7 @@ func TestQueueReloads(t *testing.T) {
 	}
 
 	// open q2 with the same storage
-	q2, err := NewQueue(ts, 1, convertTask)
+	q2, err := NewQueue(ts, 1, convertTask, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -89,7 +90,7 @@ func TestQueueRemovesTasksPerBranch(t *testing.T) {
 	ts := &Storage{db}
 
 	// open queue and push an item into the queue
-	q, err := NewQueue(ts, 100, convertTask)
+	q, err := NewQueue(ts, 100, convertTask, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -201,7 +202,7 @@ func TestQueueDoesNotRemoveTasksWithoutBranchOrRepo(t *testing.T) {
 	ts := &Storage{db}
 
 	// open queue and push an item into the queue
-	q, err := NewQueue(ts, 100, convertTask)
+	q, err := NewQueue(ts, 100, convertTask, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -242,6 +243,49 @@ func TestQueueDoesNotRemoveTasksWithoutBranchOrRepo(t *testing.T) {
 	assert.Equal(t, 2, q.tq.Len())
 }
 
+func TestQueueDoesNotRemoveTasksFromSameSweep(t *testing.T) {
+	inmem := storage.NewMemStorage()
+	db, err := leveldb.Open(inmem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &Storage{db}
+
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cby := CreatedBy{Branch: "test_branch", Repo: "test_repo"}
+	states := []DatedState{{State: StateScheduled, Created: time.Now()}}
+
+	// two tasks from the same sweep, pushed by the same branch.
+	for i, id := range []string{"ab4brhjpc98qra498sg0", "cd4brhjpc98qra498sg1"} {
+		err = q.PushUniqueByBranch(&Task{
+			ID:        id,
+			CreatedBy: cby,
+			States:    states,
+			Sweep:     &Sweep{ID: "sweep1", Index: i, Total: 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 2, q.tq.Len())
+
+	// a task from another sweep on the same branch replaces both.
+	err = q.PushUniqueByBranch(&Task{
+		ID:        "cc4brhjpc98qra498sg2",
+		CreatedBy: cby,
+		States:    states,
+		Sweep:     &Sweep{ID: "sweep2", Index: 0, Total: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, q.tq.Len())
+}
+
 func convertTask(taskData []byte) (*Task, error) {
 	tsk := &Task{}
 	err := json.Unmarshal(taskData, tsk)
@@ -250,3 +294,432 @@ func convertTask(taskData []byte) (*Task, error) {
 	}
 	return tsk, nil
 }
+
+// complete moves a popped task to the archive, in the given state.
+func complete(t *testing.T, ts *Storage, tsk *Task, state State) {
+	t.Helper()
+	tsk.States = append(tsk.States, DatedState{State: state, Created: time.Now()})
+	if err := ts.PersistProcessing(tsk); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.ArchiveTask(tsk); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueSchedulesDependantsAfterPrerequisites(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// runs of case "bad" fail.
+	outcome := func(tsk *Task) (Outcome, error) {
+		if tsk.Case == "bad" {
+			return OutcomeFailure, nil
+		}
+		return OutcomeSuccess, nil
+	}
+	q, err := NewQueue(ts, 100, convertTask, outcome)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		cby    = CreatedBy{Branch: "test_branch", Repo: "test_repo"}
+		states = []DatedState{{State: StateScheduled, Created: time.Now()}}
+		build  = &Task{ID: "ab4brhjpc98qra498sg0", Type: TypeBuild, States: states, CreatedBy: cby}
+		run1   = &Task{ID: "cd4brhjpc98qra498sg1", Type: TypeRun, Case: "bad", States: states, CreatedBy: cby, Priority: 10, DependsOn: []string{build.ID}}
+		run2   = &Task{ID: "cc4brhjpc98qra498sg2", Type: TypeRun, States: states, CreatedBy: cby, Priority: 10, DependsOn: []string{build.ID}}
+		after  = &Task{ID: "hg4brhjpc98qra566sg3", Type: TypeRun, States: states, CreatedBy: cby, Priority: 20, DependsOn: []string{run1.ID}}
+	)
+
+	// tasks of the same graph don't replace each other.
+	for _, tsk := range []*Task{build, run1, run2, after} {
+		if err := q.PushUniqueByBranch(tsk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 4, q.tq.Len())
+
+	// dependants have a higher priority, but wait for the build.
+	tsk, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, build.ID, tsk.ID)
+	assert.Equal(t, 3, q.tq.Len())
+
+	_, err = q.Pop()
+	assert.Equal(t, ErrQueueEmpty, err)
+	assert.Equal(t, 3, q.tq.Len())
+
+	complete(t, ts, tsk, StateComplete)
+
+	run, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, run1.ID, run.ID)
+	complete(t, ts, run, StateComplete)
+
+	// run1 failed, so the task depending on it is canceled.
+	tsk, err = q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, run2.ID, tsk.ID)
+	assert.Equal(t, 0, q.tq.Len())
+
+	canceled, err := ts.Get(after.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StateCanceled, canceled.State().State)
+	assert.Contains(t, canceled.Error, run1.ID)
+}
+
+func TestQueueCancelsTasksWithMissingPrerequisites(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := []DatedState{{State: StateScheduled, Created: time.Now()}}
+	if err := q.Push(&Task{ID: "ab4brhjpc98qra498sg0", States: states, DependsOn: []string{"cd4brhjpc98qra498sg1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = q.Pop()
+	assert.Equal(t, ErrQueueEmpty, err)
+
+	tsk, err := ts.Get("ab4brhjpc98qra498sg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StateCanceled, tsk.State().State)
+}
+
+// slots admits a number of tasks per runner at once.
+type slots map[string]int
+
+func (s slots) Admit(tsk *Task) bool {
+	if s[tsk.Runner] == 0 {
+		return false
+	}
+	s[tsk.Runner]--
+	return true
+}
+
+func (s slots) Release(tsk *Task) {
+	s[tsk.Runner]++
+}
+
+func TestQueuePopsAdmittedTasks(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.SetAdmission(slots{"a": 1, "b": 1})
+
+	var (
+		states = []DatedState{{State: StateScheduled, Created: time.Now()}}
+		a1     = &Task{ID: "ab4brhjpc98qra498sg0", Runner: "a", Priority: 30, States: states}
+		a2     = &Task{ID: "cd4brhjpc98qra498sg1", Runner: "a", Priority: 20, States: states}
+		b1     = &Task{ID: "cc4brhjpc98qra498sg2", Runner: "b", Priority: 10, States: states}
+	)
+	for _, tsk := range []*Task{a1, a2, b1} {
+		if err := q.Push(tsk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tsk, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a1.ID, tsk.ID)
+
+	// a2 waits for a1 to release its slot; b1 fits on its own runner.
+	tsk, err = q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b1.ID, tsk.ID)
+
+	_, err = q.Pop()
+	assert.Equal(t, ErrQueueEmpty, err)
+	assert.Equal(t, 1, q.tq.Len())
+
+	q.Release(a1)
+
+	tsk, err = q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a2.ID, tsk.ID)
+}
+
+func TestQueueEnforcesConcurrencyLimits(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.SetLimits(Limits{PerRunner: map[string]int{"a": 1}, PerUser: 2, PerRepo: 2})
+
+	var (
+		states = []DatedState{{State: StateScheduled, Created: time.Now()}}
+		alice  = CreatedBy{User: "alice", Repo: "r1"}
+		bob    = CreatedBy{User: "bob", Repo: "r1"}
+		a1     = &Task{ID: "ab4brhjpc98qra498sg0", Runner: "a", Priority: 40, States: states, CreatedBy: alice}
+		a2     = &Task{ID: "cd4brhjpc98qra498sg1", Runner: "a", Priority: 30, States: states, CreatedBy: bob}
+		b1     = &Task{ID: "cc4brhjpc98qra498sg2", Runner: "b", Priority: 20, States: states, CreatedBy: bob}
+		b2     = &Task{ID: "hg4brhjpc98qra566sg3", Runner: "b", Priority: 10, States: states, CreatedBy: alice}
+	)
+	for _, tsk := range []*Task{a1, a2, b1, b2} {
+		if err := q.Push(tsk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tsk, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a1.ID, tsk.ID)
+
+	// runner a is at its limit.
+	tsk, err = q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b1.ID, tsk.ID)
+	assert.Contains(t, q.WaitingReason(a2.ID), "runner a")
+
+	// repo r1 is at its limit.
+	_, err = q.Pop()
+	assert.Equal(t, ErrQueueEmpty, err)
+	assert.Contains(t, q.WaitingReason(b2.ID), "repo r1")
+
+	q.Release(a1)
+
+	tsk, err = q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a2.ID, tsk.ID)
+	assert.Empty(t, q.WaitingReason(a2.ID))
+}
+
+func TestQueueTakesTurnsAcrossUsers(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice floods the queue before bob and carol submit their tasks.
+	var (
+		now   = time.Now()
+		ids   = []string{"ab4brhjpc98qra498sg0", "cd4brhjpc98qra498sg1", "cc4brhjpc98qra498sg2", "hg4brhjpc98qra566sg3", "ij4brhjpc98qra566sg4"}
+		users = []string{"alice", "alice", "alice", "bob", "carol"}
+	)
+	for i, id := range ids {
+		tsk := &Task{
+			ID:        id,
+			States:    []DatedState{{State: StateScheduled, Created: now.Add(time.Duration(i) * time.Second)}},
+			CreatedBy: CreatedBy{User: users[i]},
+		}
+		if err := q.Push(tsk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var popped []string
+	for range ids {
+		tsk, err := q.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		popped = append(popped, tsk.CreatedBy.User)
+	}
+	assert.Equal(t, []string{"alice", "bob", "carol", "alice", "alice"}, popped)
+}
+
+func TestQueueRequeueKeepsCreationTime(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		created = time.Now().Add(-time.Hour)
+		older   = &Task{ID: "ab4brhjpc98qra498sg0", States: []DatedState{{State: StateScheduled, Created: created}}}
+		newer   = &Task{ID: "cd4brhjpc98qra498sg1", States: []DatedState{{State: StateScheduled, Created: time.Now()}}}
+	)
+	if err := q.Push(older); err != nil {
+		t.Fatal(err)
+	}
+
+	tsk, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, q.Running(), 1)
+
+	if err := q.Push(newer); err != nil {
+		t.Fatal(err)
+	}
+
+	tsk.States = append(tsk.States, DatedState{State: StatePreempted, Created: time.Now()})
+	if err := q.Requeue(tsk); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, q.Running())
+
+	stored, err := ts.Get(older.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StateScheduled, stored.State().State)
+	assert.Equal(t, 1, stored.Preemptions())
+	assert.True(t, stored.Created().Equal(created))
+
+	// the requeued task goes ahead of the task queued after it.
+	tsk, err = q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, older.ID, tsk.ID)
+}
+
+func TestQueueWaitsForRetryBackoff(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tsk := &Task{
+		ID:      "ab4brhjpc98qra498sg0",
+		States:  []DatedState{{State: StateScheduled, Created: time.Now()}},
+		RetryAt: time.Now().Add(time.Hour),
+	}
+	if err := q.Push(tsk); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = q.Pop()
+	assert.Equal(t, ErrQueueEmpty, err)
+	assert.Contains(t, q.WaitingReason(tsk.ID), "waiting to retry")
+
+	tsk.RetryAt = time.Now().Add(-time.Second)
+	popped, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tsk.ID, popped.ID)
+}
+
+func TestQueuePopWaitWakesOnChanges(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type popped struct {
+		tsk *Task
+		err error
+	}
+	ch := make(chan popped, 1)
+	go func() {
+		tsk, err := q.PopWait(ctx)
+		ch <- popped{tsk, err}
+	}()
+
+	changed := q.Changed()
+	tsk := &Task{
+		ID:     "ab4brhjpc98qra498sg0",
+		States: []DatedState{{State: StateScheduled, Created: time.Now()}},
+	}
+	if err := q.Push(tsk); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected pushing a task to notify of a change")
+	}
+
+	p := <-ch
+	if p.err != nil {
+		t.Fatal(p.err)
+	}
+	assert.Equal(t, tsk.ID, p.tsk.ID)
+
+	// nothing else is queued.
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	_, err = q.PopWait(short)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestQueuePopWaitWakesWhenRetryIsDue(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 100, convertTask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tsk := &Task{
+		ID:      "ab4brhjpc98qra498sg0",
+		States:  []DatedState{{State: StateScheduled, Created: time.Now()}},
+		RetryAt: time.Now().Add(100 * time.Millisecond),
+	}
+	if err := q.Push(tsk); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	popped, err := q.PopWait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tsk.ID, popped.ID)
+	assert.False(t, time.Now().Before(tsk.RetryAt))
+}
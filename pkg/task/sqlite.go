@@ -0,0 +1,448 @@
+package task
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+
+	// registers the sqlite driver, written in pure Go so that the daemon
+	// is built without cgo.
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the SQLite storage. Tasks are stored as
+// JSON documents, along with the columns they're queried by, which are
+// derived from the documents on every write.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tasks (
+	id      TEXT PRIMARY KEY,
+	state   TEXT NOT NULL,
+	created INTEGER NOT NULL,
+	type    TEXT NOT NULL,
+	plan    TEXT NOT NULL,
+	tcase   TEXT NOT NULL,
+	runner  TEXT NOT NULL,
+	outcome TEXT NOT NULL,
+	repo    TEXT NOT NULL,
+	branch  TEXT NOT NULL,
+	commit_ TEXT NOT NULL,
+	user    TEXT NOT NULL,
+	doc     BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tasks_state   ON tasks (state, created);
+CREATE INDEX IF NOT EXISTS tasks_plan    ON tasks (plan, tcase);
+CREATE INDEX IF NOT EXISTS tasks_runner  ON tasks (runner);
+CREATE INDEX IF NOT EXISTS tasks_outcome ON tasks (outcome);
+CREATE INDEX IF NOT EXISTS tasks_branch  ON tasks (repo, branch, type);
+CREATE INDEX IF NOT EXISTS tasks_commit  ON tasks (commit_);
+CREATE INDEX IF NOT EXISTS tasks_user    ON tasks (user);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// taskColumns are the columns written along with the document of a task.
+const taskColumns = "id, state, created, type, plan, tcase, runner, outcome, repo, branch, commit_, user, doc"
+
+// SQLiteStorage stores tasks in an SQLite database, which can be queried
+// relationally.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+var _ TaskStore = (*SQLiteStorage)(nil)
+
+// NewSQLiteTaskStorage opens the SQLite database at the given path, creating
+// it if needed, and upgrades the tasks it stores to the current schema
+// version.
+func NewSQLiteTaskStorage(path string) (*SQLiteStorage, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("error while opening storage: %w", err)
+	}
+	// a single connection serializes writes, like LevelDB transactions, and
+	// keeps in-memory databases alive.
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStorage{db}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error while creating storage schema: %w", err)
+	}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error while upgrading storage: %w", err)
+	}
+	return s, nil
+}
+
+// NewMemorySQLiteTaskStorage returns an SQLite storage held in memory.
+func NewMemorySQLiteTaskStorage() (*SQLiteStorage, error) {
+	return NewSQLiteTaskStorage(":memory:")
+}
+
+// migrate upgrades the stored tasks to CurrentVersion, atomically. It fails
+// without changing anything if any task was written by a newer release.
+func (s *SQLiteStorage) migrate() error {
+	return s.tx(func(tx *sql.Tx) error {
+		var v string
+		err := tx.QueryRow("SELECT value FROM meta WHERE key = 'schema_version'").Scan(&v)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return err
+		default:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid storage schema version: %s", v)
+			}
+			if n > CurrentVersion {
+				return fmt.Errorf("%w: storage has version %d; this release supports up to %d", ErrFutureVersion, n, CurrentVersion)
+			}
+			if n == CurrentVersion {
+				return nil
+			}
+		}
+
+		rows, err := tx.Query("SELECT state, doc FROM tasks")
+		if err != nil {
+			return err
+		}
+		type upgrade struct {
+			state string
+			doc   []byte
+		}
+		var upgrades []upgrade
+		for rows.Next() {
+			var (
+				state string
+				doc   []byte
+			)
+			if err := rows.Scan(&state, &doc); err != nil {
+				rows.Close()
+				return err
+			}
+			val, err := Migrate(doc)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if string(val) != string(doc) {
+				upgrades = append(upgrades, upgrade{state, val})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, u := range upgrades {
+			tsk := &Task{}
+			if err := json.Unmarshal(u.doc, tsk); err != nil {
+				return err
+			}
+			if err := upsert(tx, u.state, tsk, u.doc); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('schema_version', ?)", strconv.Itoa(CurrentVersion))
+		return err
+	})
+}
+
+// tx runs fn in a transaction, committed if fn succeeds.
+func (s *SQLiteStorage) tx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsert writes the task, stored as doc, in the given state.
+func upsert(tx *sql.Tx, state string, tsk *Task, doc []byte) error {
+	u, err := xid.FromString(tsk.ID)
+	if err != nil {
+		return fmt.Errorf("task key must be a xid id")
+	}
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO tasks ("+taskColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		tsk.ID, state, u.Time().Unix(), string(tsk.Type), tsk.Plan, tsk.Case, tsk.Runner, string(tsk.indexedOutcome()),
+		tsk.CreatedBy.Repo, tsk.CreatedBy.Branch, tsk.CreatedBy.Commit, tsk.CreatedBy.User, doc,
+	)
+	return err
+}
+
+func (s *SQLiteStorage) put(state State, tsk *Task) error {
+	doc, err := json.Marshal(tsk)
+	if err != nil {
+		return err
+	}
+	return s.tx(func(tx *sql.Tx) error {
+		return upsert(tx, string(state), tsk, doc)
+	})
+}
+
+// move moves the task with the given ID from the src state to dst.
+func (s *SQLiteStorage) move(dst State, src State, id string) error {
+	res, err := s.db.Exec("UPDATE tasks SET state = ? WHERE id = ? AND state = ?", string(dst), id, string(src))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) PersistScheduled(tsk *Task) error {
+	return s.put(StateScheduled, tsk)
+}
+
+func (s *SQLiteStorage) PersistProcessing(tsk *Task) error {
+	return s.put(StateProcessing, tsk)
+}
+
+func (s *SQLiteStorage) PersistComplete(tsk *Task) error {
+	return s.put(StateComplete, tsk)
+}
+
+func (s *SQLiteStorage) ProcessTask(tsk *Task) error {
+	return s.move(StateProcessing, StateScheduled, tsk.ID)
+}
+
+func (s *SQLiteStorage) ArchiveTask(tsk *Task) error {
+	return s.move(StateComplete, StateProcessing, tsk.ID)
+}
+
+// RequeueTask persists a task being processed, and moves it back to the
+// scheduled tasks.
+func (s *SQLiteStorage) RequeueTask(tsk *Task) error {
+	doc, err := json.Marshal(tsk)
+	if err != nil {
+		return err
+	}
+	return s.tx(func(tx *sql.Tx) error {
+		var state string
+		err := tx.QueryRow("SELECT state FROM tasks WHERE id = ?", tsk.ID).Scan(&state)
+		if err == sql.ErrNoRows || (err == nil && state != string(StateProcessing)) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return upsert(tx, string(StateScheduled), tsk, doc)
+	})
+}
+
+func (s *SQLiteStorage) Get(id string) (*Task, error) {
+	var doc []byte
+	err := s.db.QueryRow("SELECT doc FROM tasks WHERE id = ?", id).Scan(&doc)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	tsk := &Task{}
+	if err := json.Unmarshal(doc, tsk); err != nil {
+		return nil, err
+	}
+	return tsk, nil
+}
+
+func (s *SQLiteStorage) Delete(id string) error {
+	res, err := s.db.Exec("DELETE FROM tasks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) Filter(state State, start time.Time, end time.Time) ([]*Task, error) {
+	return s.tasks("SELECT doc FROM tasks WHERE state = ? AND created >= ? AND created < ? ORDER BY id",
+		string(state), start.Unix(), end.Unix())
+}
+
+// Query returns the tasks matching the query, sorted by creation time.
+func (s *SQLiteStorage) Query(q Query) ([]*Task, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	in := func(column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		where = append(where, column+" IN (?"+strings.Repeat(", ?", len(values)-1)+")")
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	eq := func(column string, value string) {
+		if value != "" {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+
+	states := make([]string, 0, len(q.States))
+	for _, state := range q.States {
+		states = append(states, string(state))
+	}
+	in("state", states)
+	types := make([]string, 0, len(q.Types))
+	for _, tp := range q.Types {
+		types = append(types, string(tp))
+	}
+	in("type", types)
+
+	if !q.After.IsZero() {
+		where = append(where, "created >= ?")
+		args = append(args, q.After.Unix())
+	}
+	if !q.Before.IsZero() {
+		where = append(where, "created < ?")
+		args = append(args, q.Before.Unix())
+	}
+	eq("plan", q.Plan)
+	eq("tcase", q.Case)
+	eq("runner", q.Runner)
+	eq("outcome", string(q.Outcome))
+	eq("repo", q.Repo)
+	eq("branch", q.Branch)
+	eq("commit_", q.Commit)
+	eq("user", q.User)
+
+	query := "SELECT doc FROM tasks"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// task IDs are sortable by creation time.
+	if q.Ascending {
+		query += " ORDER BY id ASC"
+	} else {
+		query += " ORDER BY id DESC"
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	query += " LIMIT ? OFFSET ?"
+	args = append(args, limit, q.Offset)
+
+	return s.tasks(query, args...)
+}
+
+// Documents returns the JSON documents of the tasks in the given state,
+// oldest first.
+func (s *SQLiteStorage) Documents(state State) ([][]byte, error) {
+	rows, err := s.db.Query("SELECT doc FROM tasks WHERE state = ? ORDER BY id", string(state))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs [][]byte
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// Branches summarizes the runs created from each branch of a repository,
+// most recently run first.
+func (s *SQLiteStorage) Branches(repo string) ([]BranchRuns, error) {
+	rows, err := s.db.Query(`
+SELECT b.branch, b.runs, b.succeeded, b.failed, l.doc
+FROM (
+	SELECT branch,
+		COUNT(*) AS runs,
+		SUM(outcome = ?) AS succeeded,
+		SUM(outcome IN (?, ?)) AS failed,
+		MAX(id) AS last
+	FROM tasks
+	WHERE repo = ? AND type = ? AND branch != ''
+	GROUP BY branch
+) b
+JOIN tasks l ON l.id = b.last
+ORDER BY b.last DESC`,
+		string(OutcomeSuccess), string(OutcomeFailure), string(OutcomeTimeout), repo, string(TypeRun))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []BranchRuns
+	for rows.Next() {
+		var (
+			br  = BranchRuns{Repo: repo}
+			doc []byte
+		)
+		if err := rows.Scan(&br.Branch, &br.Runs, &br.Succeeded, &br.Failed, &doc); err != nil {
+			return nil, err
+		}
+		last := &Task{}
+		if err := json.Unmarshal(doc, last); err != nil {
+			return nil, err
+		}
+		br.LastRun, br.LastCommit = last.Created(), last.CreatedBy.Commit
+		res = append(res, br)
+	}
+	return res, rows.Err()
+}
+
+// LastGreen returns the most recent run created from a branch of a
+// repository, and of the given test plan if any, that completed successfully.
+func (s *SQLiteStorage) LastGreen(repo string, branch string, plan string) (*Task, error) {
+	return lastGreen(s, repo, branch, plan)
+}
+
+// Close releases the storage.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// tasks returns the tasks whose documents are selected by the query.
+func (s *SQLiteStorage) tasks(query string, args ...interface{}) ([]*Task, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tsks := make([]*Task, 0)
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		tsk := &Task{}
+		if err := json.Unmarshal(doc, tsk); err != nil {
+			return nil, err
+		}
+		tsks = append(tsks, tsk)
+	}
+	return tsks, rows.Err()
+}
@@ -30,6 +30,8 @@ type Storage struct {
 	db *leveldb.DB
 }
 
+var _ TaskStore = (*Storage)(nil)
+
 // derive the key from the database prefix and the ID of the task we are searching for.
 // In order to do time-based range searches and searches for tasks in a particular phase of execution,
 // keys are stored under a prefix which represents the state of the task and a timestamp.
@@ -41,13 +43,35 @@ type Storage struct {
 // This way we can easily range over periods of time and, at the same time, get specific tasks from
 // the storage.
 func taskKey(prefix string, id string) ([]byte, error) {
+	tskey, err := taskKeySuffix(id)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join([]string{prefix, tskey}, ":")), nil
+}
+
+// taskKeySuffix returns the key of the task without its prefix: its creation
+// timestamp and its ID.
+func taskKeySuffix(id string) (string, error) {
 	u, err := xid.FromString(id)
 	if err != nil {
-		return nil, errors.New("task key must be a xid id")
+		return "", errors.New("task key must be a xid id")
 	}
+	return strconv.FormatInt(u.Time().Unix(), 10) + "_" + u.String(), nil
+}
 
-	tskey := strconv.FormatInt(u.Time().Unix(), 10) + "_" + u.String()
-	return []byte(strings.Join([]string{prefix, tskey}, ":")), nil
+// statePrefix returns the database prefix tasks in the given state are stored
+// under.
+func statePrefix(state State) string {
+	switch state {
+	case StateScheduled:
+		return prefixScheduled
+	case StateProcessing:
+		return prefixProcessing
+	case StateComplete:
+		return prefixComplete
+	}
+	return ""
 }
 
 func (s *Storage) get(prefix string, id string) (tsk *Task, err error) {
@@ -79,11 +103,35 @@ func (s *Storage) put(prefix string, tsk *Task) error {
 	if err != nil {
 		return err
 	}
-	return s.db.Put(key, val, &opt.WriteOptions{
-		Sync: true,
+	return s.update(func(trans *leveldb.Transaction, b *leveldb.Batch) error {
+		prev, err := trans.Get(key, nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			return err
+		}
+		b.Put(key, val)
+		return reindex(b, prev, val, prefix)
 	})
 }
 
+// update applies the changes recorded by fn atomically, so that the tasks and
+// their index entries are always consistent.
+func (s *Storage) update(fn func(trans *leveldb.Transaction, b *leveldb.Batch) error) error {
+	trans, err := s.db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+	b := new(leveldb.Batch)
+	if err := fn(trans, b); err != nil {
+		trans.Discard()
+		return err
+	}
+	if err := trans.Write(b, &opt.WriteOptions{Sync: true}); err != nil {
+		trans.Discard()
+		return err
+	}
+	return trans.Commit()
+}
+
 func (s *Storage) Delete(id string) error {
 	tsk, err := s.get(prefixComplete, id)
 	if err == nil {
@@ -114,8 +162,13 @@ func (s *Storage) delete(prefix string, tsk *Task) error {
 	if err != nil {
 		return err
 	}
-	return s.db.Delete(key, &opt.WriteOptions{
-		Sync: true,
+	return s.update(func(trans *leveldb.Transaction, b *leveldb.Batch) error {
+		prev, err := trans.Get(key, nil)
+		if err != nil {
+			return err
+		}
+		b.Delete(key)
+		return reindex(b, prev, nil, prefix)
 	})
 }
 
@@ -145,6 +198,10 @@ func (s *Storage) PersistScheduled(tsk *Task) error {
 	return s.put(prefixScheduled, tsk)
 }
 
+func (s *Storage) PersistComplete(tsk *Task) error {
+	return s.put(prefixComplete, tsk)
+}
+
 func (s *Storage) ProcessTask(tsk *Task) error {
 	return s.changePrefix(prefixProcessing, prefixScheduled, tsk.ID)
 }
@@ -153,6 +210,15 @@ func (s *Storage) ArchiveTask(tsk *Task) error {
 	return s.changePrefix(prefixComplete, prefixProcessing, tsk.ID)
 }
 
+// RequeueTask persists a task being processed, and moves it back to the
+// scheduled tasks.
+func (s *Storage) RequeueTask(tsk *Task) error {
+	if err := s.PersistProcessing(tsk); err != nil {
+		return err
+	}
+	return s.changePrefix(prefixScheduled, prefixProcessing, tsk.ID)
+}
+
 // Change the prefix of a task
 func (s *Storage) changePrefix(dst string, src string, id string) error {
 	oldkey, err := taskKey(src, id)
@@ -163,41 +229,19 @@ func (s *Storage) changePrefix(dst string, src string, id string) error {
 	if err != nil {
 		return err
 	}
-	trans, err := s.db.OpenTransaction()
-	if err != nil {
-		return err
-	}
-	val, err := trans.Get(oldkey, nil)
-	if err != nil {
-		trans.Discard()
-		return err
-	}
-	err = trans.Put(newkey, val, &opt.WriteOptions{Sync: true})
-	if err != nil {
-		trans.Discard()
-		return err
-	}
-	err = trans.Delete(oldkey, &opt.WriteOptions{Sync: true})
-	if err != nil {
-		trans.Discard()
-		return err
-	}
-	return trans.Commit()
+	return s.update(func(trans *leveldb.Transaction, b *leveldb.Batch) error {
+		val, err := trans.Get(oldkey, nil)
+		if err != nil {
+			return err
+		}
+		b.Put(newkey, val)
+		b.Delete(oldkey)
+		return reindex(b, val, val, dst)
+	})
 }
 
 func (s *Storage) Filter(state State, start time.Time, end time.Time) (tasks []*Task, err error) {
-	var prefix string
-
-	switch state {
-	case StateScheduled:
-		prefix = prefixScheduled
-	case StateProcessing:
-		prefix = prefixProcessing
-	case StateComplete:
-		prefix = prefixComplete
-	}
-
-	return s.rangeIter(prefix, start, end)
+	return s.rangeIter(statePrefix(state), start, end)
 }
 
 // rangeIter returns []*Task with all tasks between the given time ranges.
@@ -212,10 +256,14 @@ func (s *Storage) rangeIter(prefix string, start time.Time, end time.Time) (task
 			strconv.FormatInt(end.Unix(), 10),
 		}, ":")),
 	}
+	return s.iter(&rng)
+}
 
+// iter returns []*Task with all tasks in the given key range.
+func (s *Storage) iter(rng *util.Range) (tasks []*Task, err error) {
 	tasks = make([]*Task, 0)
 
-	iter := s.db.NewIterator(&rng, nil)
+	iter := s.db.NewIterator(rng, nil)
 	defer iter.Release()
 
 	for iter.Next() {
@@ -227,7 +275,70 @@ func (s *Storage) rangeIter(prefix string, start time.Time, end time.Time) (task
 		}
 		tasks = append(tasks, tsk)
 	}
-	return tasks, nil
+	return tasks, iter.Error()
+}
+
+// Documents returns the JSON documents of the tasks in the given state,
+// oldest first.
+func (s *Storage) Documents(state State) ([][]byte, error) {
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(statePrefix(state)+":")), nil)
+	defer iter.Release()
+
+	var docs [][]byte
+	for iter.Next() {
+		docs = append(docs, append([]byte(nil), iter.Value()...))
+	}
+	return docs, iter.Error()
+}
+
+// Branches summarizes the runs created from each branch of a repository,
+// most recently run first.
+func (s *Storage) Branches(repo string) ([]BranchRuns, error) {
+	tsks, err := s.Query(Query{Repo: repo, Types: []Type{TypeRun}})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		res      []BranchRuns
+		branches = make(map[string]int)
+	)
+	// tasks are listed newest first.
+	for _, tsk := range tsks {
+		if tsk.CreatedBy.Branch == "" {
+			continue
+		}
+		i, ok := branches[tsk.CreatedBy.Branch]
+		if !ok {
+			i = len(res)
+			branches[tsk.CreatedBy.Branch] = i
+			res = append(res, BranchRuns{
+				Repo:       repo,
+				Branch:     tsk.CreatedBy.Branch,
+				LastRun:    tsk.Created(),
+				LastCommit: tsk.CreatedBy.Commit,
+			})
+		}
+		res[i].Runs++
+		switch outcome := tsk.indexedOutcome(); {
+		case outcome == OutcomeSuccess:
+			res[i].Succeeded++
+		case failed(outcome):
+			res[i].Failed++
+		}
+	}
+	return res, nil
+}
+
+// LastGreen returns the most recent run created from a branch of a
+// repository, and of the given test plan if any, that completed successfully.
+func (s *Storage) LastGreen(repo string, branch string, plan string) (*Task, error) {
+	return lastGreen(s, repo, branch, plan)
+}
+
+// Close releases the storage.
+func (s *Storage) Close() error {
+	return s.db.Close()
 }
 
 func NewMemoryTaskStorage() (*Storage, error) {
@@ -236,7 +347,7 @@ func NewMemoryTaskStorage() (*Storage, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Storage{db}, nil
+	return open(db)
 }
 
 func NewTaskStorage(path string) (*Storage, error) {
@@ -244,5 +355,20 @@ func NewTaskStorage(path string) (*Storage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error while opening storage: %v", err)
 	}
-	return &Storage{db}, nil
+	return open(db)
+}
+
+// open upgrades the tasks stored in the database to the current schema
+// version, and indexes them.
+func open(db *leveldb.DB) (*Storage, error) {
+	s := &Storage{db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error while upgrading storage: %w", err)
+	}
+	if err := s.ensureIndexes(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error while indexing storage: %w", err)
+	}
+	return s, nil
 }
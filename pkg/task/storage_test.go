@@ -1,9 +1,11 @@
 package task
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/rs/xid"
 	"github.com/stretchr/testify/assert"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/storage"
@@ -132,3 +134,97 @@ func TestArchive(t *testing.T) {
 
 	assert.Equal(t, 3, len(between))
 }
+
+func TestQueryByIndexes(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	newTask := func(minute int, plan string, user string) *Task {
+		created := base.Add(time.Duration(minute) * time.Minute)
+		return &Task{
+			ID:        xid.NewWithTime(created).String(),
+			Type:      TypeRun,
+			Plan:      plan,
+			Case:      "case",
+			Runner:    "local:docker",
+			States:    []DatedState{{Created: created, State: StateScheduled}},
+			CreatedBy: CreatedBy{User: user},
+		}
+	}
+
+	var (
+		first  = newTask(0, "ping", "alice")
+		second = newTask(1, "ping", "bob")
+		third  = newTask(2, "pong", "alice")
+		fourth = newTask(3, "ping", "alice")
+	)
+	for _, tsk := range []*Task{first, second, third, fourth} {
+		if err := ts.PersistScheduled(tsk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first task fails; its outcome is indexed once archived.
+	if err := ts.ProcessTask(first); err != nil {
+		t.Fatal(err)
+	}
+	first.States = append(first.States, DatedState{Created: base.Add(time.Hour), State: StateComplete})
+	first.Result = map[string]interface{}{"outcome": OutcomeFailure}
+	if err := ts.PersistProcessing(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.ArchiveTask(first); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(q Query) []string {
+		tsks, err := ts.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make([]string, 0, len(tsks))
+		for _, tsk := range tsks {
+			res = append(res, tsk.ID)
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{fourth.ID, third.ID, second.ID, first.ID}, ids(Query{}))
+	assert.Equal(t, []string{fourth.ID, first.ID}, ids(Query{Plan: "ping", User: "alice"}))
+	assert.Equal(t, []string{fourth.ID, second.ID}, ids(Query{Plan: "ping", States: []State{StateScheduled}}))
+	assert.Equal(t, []string{first.ID}, ids(Query{Outcome: OutcomeFailure, States: []State{StateComplete}}))
+	assert.Equal(t, []string{fourth.ID, third.ID, second.ID}, ids(Query{Outcome: OutcomeUnknown}))
+	assert.Empty(t, ids(Query{Runner: "cluster:k8s"}))
+	assert.Empty(t, ids(Query{Types: []Type{TypeBuild}}))
+
+	// time ranges, sort order and pagination.
+	assert.Equal(t, []string{second.ID, third.ID}, ids(Query{After: base.Add(time.Minute), Before: base.Add(3 * time.Minute), Ascending: true}))
+	assert.Equal(t, []string{third.ID}, ids(Query{User: "alice", Offset: 1, Limit: 1}))
+	assert.Empty(t, ids(Query{Offset: 4}))
+
+	// deleted tasks are removed from the indexes.
+	if err := ts.Delete(fourth.ID); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{first.ID}, ids(Query{Plan: "ping", User: "alice"}))
+
+	// indexes missing from databases written by older versions are rebuilt.
+	iter := ts.db.NewIterator(nil, nil)
+	for iter.Next() {
+		if key := string(iter.Key()); strings.HasPrefix(key, prefixIndex+":") || key == string(keyIndexVersion) {
+			if err := ts.db.Delete(iter.Key(), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	iter.Release()
+	assert.Empty(t, ids(Query{Plan: "ping"}))
+
+	if err := ts.ensureIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{second.ID, first.ID}, ids(Query{Plan: "ping"}))
+}
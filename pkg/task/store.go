@@ -0,0 +1,84 @@
+package task
+
+import "time"
+
+// TaskStore persists tasks through their lifecycle: tasks are scheduled, then
+// processed, then complete. Implementations must be safe for concurrent use.
+type TaskStore interface {
+	// PersistScheduled stores a task as scheduled.
+	PersistScheduled(tsk *Task) error
+	// PersistProcessing stores a task as being processed.
+	PersistProcessing(tsk *Task) error
+	// PersistComplete stores a task as complete, such as a task imported
+	// from another storage.
+	PersistComplete(tsk *Task) error
+	// ProcessTask moves a scheduled task to the tasks being processed.
+	ProcessTask(tsk *Task) error
+	// ArchiveTask moves a task being processed to the complete tasks.
+	ArchiveTask(tsk *Task) error
+	// RequeueTask persists a task being processed, and moves it back to the
+	// scheduled tasks.
+	RequeueTask(tsk *Task) error
+
+	// Get returns the task with the given ID, or ErrNotFound.
+	Get(id string) (*Task, error)
+	// Delete deletes the task with the given ID.
+	Delete(id string) error
+
+	// Filter returns the tasks in the given state created between start and
+	// end, at second precision, excluding end.
+	Filter(state State, start time.Time, end time.Time) ([]*Task, error)
+	// Query returns the tasks matching the query, sorted by creation time.
+	Query(q Query) ([]*Task, error)
+	// Documents returns the JSON documents of the tasks in the given state,
+	// oldest first.
+	Documents(state State) ([][]byte, error)
+
+	// Branches summarizes the runs created from each branch of a
+	// repository, most recently run first.
+	Branches(repo string) ([]BranchRuns, error)
+	// LastGreen returns the most recent run created from a branch of a
+	// repository, and of the given test plan if any, that completed
+	// successfully; or ErrNotFound.
+	LastGreen(repo string, branch string, plan string) (*Task, error)
+
+	// Close releases the storage.
+	Close() error
+}
+
+// BranchRuns (kind: struct) summarizes the runs created from a branch of a repository.
+type BranchRuns struct {
+	Repo       string    `json:"repo"`
+	Branch     string    `json:"branch"`
+	Runs       int       `json:"runs"`        // Number of runs
+	Succeeded  int       `json:"succeeded"`   // Number of runs that completed successfully
+	Failed     int       `json:"failed"`      // Number of runs that failed or timed out
+	LastRun    time.Time `json:"last_run"`    // When the most recent run was created
+	LastCommit string    `json:"last_commit"` // Commit of the most recent run
+}
+
+// failed returns whether the outcome is a failure of the test plan.
+func failed(outcome Outcome) bool {
+	return outcome == OutcomeFailure || outcome == OutcomeTimeout
+}
+
+// lastGreen returns the most recent run matching the arguments of
+// TaskStore.LastGreen, queried from the store.
+func lastGreen(s TaskStore, repo string, branch string, plan string) (*Task, error) {
+	tsks, err := s.Query(Query{
+		States:  []State{StateComplete},
+		Types:   []Type{TypeRun},
+		Repo:    repo,
+		Branch:  branch,
+		Plan:    plan,
+		Outcome: OutcomeSuccess,
+		Limit:   1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tsks) == 0 {
+		return nil, ErrNotFound
+	}
+	return tsks[0], nil
+}
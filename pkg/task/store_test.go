@@ -0,0 +1,154 @@
+package task
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stores opens an empty store of each backend.
+var stores = map[string]func() (TaskStore, error){
+	"leveldb": func() (TaskStore, error) { return NewMemoryTaskStorage() },
+	"sqlite":  func() (TaskStore, error) { return NewMemorySQLiteTaskStorage() },
+}
+
+func TestTaskStores(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s, err := open()
+			require.NoError(t, err)
+			defer s.Close()
+
+			testTaskStore(t, s)
+		})
+	}
+}
+
+func testTaskStore(t *testing.T, s TaskStore) {
+	base := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// newRun stores a run created from a branch of the repository; unless the
+	// outcome is empty, the run is complete.
+	newRun := func(minute int, branch string, commit string, plan string, outcome Outcome) *Task {
+		created := base.Add(time.Duration(minute) * time.Minute)
+		tsk := &Task{
+			Version:   CurrentVersion,
+			ID:        xid.NewWithTime(created).String(),
+			Type:      TypeRun,
+			Plan:      plan,
+			Case:      "case",
+			States:    []DatedState{{Created: created, State: StateScheduled}},
+			CreatedBy: CreatedBy{Repo: "testground/testground", Branch: branch, Commit: commit},
+		}
+		require.NoError(t, s.PersistScheduled(tsk))
+		if outcome == "" {
+			return tsk
+		}
+		require.NoError(t, s.ProcessTask(tsk))
+		tsk.States = append(tsk.States, DatedState{Created: created.Add(time.Minute), State: StateComplete})
+		tsk.Result = map[string]interface{}{"outcome": outcome}
+		require.NoError(t, s.PersistProcessing(tsk))
+		require.NoError(t, s.ArchiveTask(tsk))
+		return tsk
+	}
+
+	var (
+		green   = newRun(0, "master", "c0", "ping", OutcomeSuccess)
+		red     = newRun(1, "master", "c1", "ping", OutcomeFailure)
+		other   = newRun(2, "master", "c2", "pong", OutcomeSuccess)
+		feature = newRun(3, "feature", "c3", "ping", OutcomeTimeout)
+		queued  = newRun(4, "master", "c4", "ping", "")
+	)
+
+	// lifecycle.
+	got, err := s.Get(green.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeSuccess, got.indexedOutcome())
+	assert.Equal(t, StateComplete, got.State().State)
+
+	require.NoError(t, s.ProcessTask(queued))
+	require.NoError(t, s.RequeueTask(queued))
+	docs, err := s.Documents(StateScheduled)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	docs, err = s.Documents(StateComplete)
+	require.NoError(t, err)
+	require.Len(t, docs, 4)
+
+	// tasks must be in the state they're moved from.
+	assert.Error(t, s.ArchiveTask(queued))
+
+	tsks, err := s.Filter(StateComplete, base, base.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, tsks, 2)
+	assert.Equal(t, green.ID, tsks[0].ID)
+	assert.Equal(t, red.ID, tsks[1].ID)
+
+	tsks, err = s.Query(Query{Branch: "master", Plan: "ping", Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, tsks, 2)
+	assert.Equal(t, red.ID, tsks[0].ID)
+	assert.Equal(t, green.ID, tsks[1].ID)
+
+	// relational queries.
+	branches, err := s.Branches("testground/testground")
+	require.NoError(t, err)
+	assert.Equal(t, []BranchRuns{
+		{Repo: "testground/testground", Branch: "master", Runs: 4, Succeeded: 2, Failed: 1, LastRun: queued.Created(), LastCommit: "c4"},
+		{Repo: "testground/testground", Branch: "feature", Runs: 1, Failed: 1, LastRun: feature.Created(), LastCommit: "c3"},
+	}, branches)
+
+	last, err := s.LastGreen("testground/testground", "master", "")
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, last.ID)
+	last, err = s.LastGreen("testground/testground", "master", "ping")
+	require.NoError(t, err)
+	assert.Equal(t, "c0", last.CreatedBy.Commit)
+	_, err = s.LastGreen("testground/testground", "feature", "")
+	assert.Equal(t, ErrNotFound, err)
+
+	// deleted tasks are gone.
+	require.NoError(t, s.Delete(other.ID))
+	_, err = s.Get(other.ID)
+	assert.Equal(t, ErrNotFound, err)
+	last, err = s.LastGreen("testground/testground", "master", "")
+	require.NoError(t, err)
+	assert.Equal(t, green.ID, last.ID)
+}
+
+func TestSQLiteTaskStorageFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.sqlite")
+
+	s, err := NewSQLiteTaskStorage(path)
+	require.NoError(t, err)
+
+	// concurrent readers of the file wait for writers.
+	var mode string
+	require.NoError(t, s.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	require.Equal(t, "wal", mode)
+	var timeout int
+	require.NoError(t, s.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout))
+	require.Equal(t, 5000, timeout)
+
+	tsk := &Task{
+		Version: CurrentVersion,
+		ID:      xid.New().String(),
+		Type:    TypeRun,
+		States:  []DatedState{{Created: time.Now().UTC(), State: StateScheduled}},
+	}
+	require.NoError(t, s.PersistScheduled(tsk))
+	require.NoError(t, s.Close())
+
+	// tasks are kept across restarts.
+	s, err = NewSQLiteTaskStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	got, err := s.Get(tsk.ID)
+	require.NoError(t, err)
+	require.Equal(t, tsk.ID, got.ID)
+}
@@ -10,6 +10,8 @@ import (
 // StateScheduled: this is the initial state of the task when it enters the queue.
 // StateProcessing: once work begins on the task, it is put into this state.
 // StateComplete: work is no longer being done on this task. client should check task result.
+// StatePreempted: work was interrupted in favour of a higher priority task; the task is then scheduled again.
+// StateRetrying: work failed because of an infrastructure error; the task is then scheduled again.
 type State string
 
 const (
@@ -17,6 +19,8 @@ const (
 	StateProcessing State = "processing"
 	StateComplete   State = "complete"
 	StateCanceled   State = "canceled"
+	StatePreempted  State = "preempted"
+	StateRetrying   State = "retrying"
 )
 
 type Outcome string
@@ -26,6 +30,7 @@ const (
 	OutcomeSuccess  Outcome = "success"
 	OutcomeFailure  Outcome = "failure"
 	OutcomeCanceled Outcome = "canceled"
+	OutcomeTimeout  Outcome = "timeout"
 )
 
 // Type (kind: string) represents the kind of activity the daemon asked to perform. In alignment
@@ -40,6 +45,17 @@ const (
 	TypeRun   Type = "run"
 )
 
+// Attempt (kind: struct) records an attempt at processing a task. The output of
+// all attempts is appended to the log of the task.
+type Attempt struct {
+	Started    time.Time `json:"started"`
+	Ended      time.Time `json:"ended"`
+	State      State     `json:"state"`                 // State the attempt left the task in
+	Error      string    `json:"error,omitempty"`       // Error the attempt failed with, if any
+	ErrorClass string    `json:"error_class,omitempty"` // Class of the infrastructure error, if any
+	LogOffset  int64     `json:"log_offset"`            // Offset of the output of the attempt in the task log
+}
+
 // DatedState (kind: struct) is a State with a timestamp.
 type DatedState struct {
 	Created time.Time `json:"created"`
@@ -53,6 +69,15 @@ type CreatedBy struct {
 	Commit string `json:"commit,omitempty"`
 }
 
+// Sweep (kind: struct) links together the tasks resulting from the expansion of a composition
+// matrix, and records the coordinates of a task within it.
+type Sweep struct {
+	ID          string            `json:"id"`          // Identifier shared by all tasks in the sweep
+	Index       int               `json:"index"`       // Position of this task in the sweep
+	Total       int               `json:"total"`       // Number of tasks in the sweep
+	Coordinates map[string]string `json:"coordinates"` // Matrix values this task runs with
+}
+
 // Task (kind: struct) contains metadata about a testground task. This schema is used to store
 // metadata in our task storage database as well as the wire format returned when clients get the
 // state of a running or scheduled task.
@@ -70,6 +95,28 @@ type Task struct {
 	Result      interface{}  `json:"result"`      // Result of the task, when terminal.
 	Error       string       `json:"error"`       // Error from Testground
 	CreatedBy   CreatedBy    `json:"created_by"`  // Who created the task
+	Sweep       *Sweep       `json:"sweep"`       // Sweep this task belongs to, if any
+	DependsOn   []string     `json:"depends_on"`  // Tasks that must succeed before this one is scheduled
+	Preemptible bool         `json:"preemptible"` // Whether the task may be interrupted for higher priority tasks
+	Attempts    []Attempt    `json:"attempts"`    // Attempts at processing the task
+	RetryAt     time.Time    `json:"retry_at"`    // When the task may be retried, if it failed an attempt
+
+	// Waiting is why the task is still scheduled, as reported by the queue
+	// when the task is retrieved. It is not persisted.
+	Waiting string `json:"waiting,omitempty"`
+
+	// Queue is the position of the task in the queue, if scheduled, as
+	// reported when the task is retrieved. It is not persisted.
+	Queue *QueueInfo `json:"queue,omitempty"`
+}
+
+// QueueInfo (kind: struct) describes the position of a scheduled task in the queue, and when it
+// is expected to be processed.
+type QueueInfo struct {
+	Position       int       `json:"position"`        // Position in the queue, starting at 1
+	Ahead          []string  `json:"ahead"`           // Scheduled tasks ahead of this one, in order
+	EstimatedStart time.Time `json:"estimated_start"` // When the task is expected to start; zero if unknown
+	EstimatedEnd   time.Time `json:"estimated_end"`   // When the task is expected to complete; zero if unknown
 }
 
 func (t *Task) Created() time.Time {
@@ -84,6 +131,28 @@ func (t *Task) IsCanceled() bool {
 	return t.State().State == StateCanceled
 }
 
+// Retries returns the number of times the task was retried.
+func (t *Task) Retries() int {
+	var n int
+	for _, a := range t.Attempts {
+		if a.State == StateRetrying {
+			n++
+		}
+	}
+	return n
+}
+
+// Preemptions returns the number of times the task was preempted.
+func (t *Task) Preemptions() int {
+	var n int
+	for _, s := range t.States {
+		if s.State == StatePreempted {
+			n++
+		}
+	}
+	return n
+}
+
 func (t *Task) Name() string {
 	switch t.Type {
 	case TypeBuild:
@@ -99,6 +168,18 @@ func (t *Task) Took() time.Duration {
 	return t.State().Created.Sub(t.Created()).Truncate(time.Second)
 }
 
+// ProcessingTime returns how long the task has been processed for: from the
+// time it was first processed until its last state change. Unlike Took, it
+// excludes the time spent waiting in the queue before being processed.
+func (t *Task) ProcessingTime() time.Duration {
+	for _, s := range t.States {
+		if s.State == StateProcessing {
+			return t.State().Created.Sub(s.Created)
+		}
+	}
+	return t.Took()
+}
+
 func (t *Task) State() DatedState {
 	if len(t.States) == 0 {
 		panic("task must have a state")
@@ -106,6 +187,11 @@ func (t *Task) State() DatedState {
 	return t.States[len(t.States)-1]
 }
 
+// InSameSweep returns whether both tasks were expanded from the same matrix.
+func (t *Task) InSameSweep(other *Task) bool {
+	return t.Sweep != nil && other.Sweep != nil && t.Sweep.ID == other.Sweep.ID
+}
+
 func (t *Task) CreatedByCI() bool {
 	return t.CreatedBy.Repo != "" && t.CreatedBy.Commit != "" && t.CreatedBy.Branch != ""
 }
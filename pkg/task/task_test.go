@@ -13,7 +13,7 @@ func TestQueueSortsPriorityAndTime(t *testing.T) {
 	later := "brfdo1rpc98r0s6e2dv0"
 
 	// Add tasks to the queue with different priorities
-	tq := make(taskQueue, 0)
+	tq := taskQueue{}
 	for i := 0; i <= 10; i++ {
 		tsk := Task{
 			ID:       earlier,
@@ -44,7 +44,7 @@ func TestQueueSortsPriorityAndTime(t *testing.T) {
 
 	// verify the sort is by priority (high->low) and time (oldest->newest)
 	head := heap.Pop(&tq).(*Task)
-	for len(tq) > 0 {
+	for tq.Len() > 0 {
 		next := heap.Pop(&tq).(*Task)
 		t.Logf("priority %d > %d?", head.Priority, next.Priority)
 		if head.Priority != next.Priority {